@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// runAnalyze implements the "analyze" subcommand: it reports the constants
+// in documents such as PDF and docx files, which are never rewritten. Plain
+// text files are analyzed as a whole. It accepts the formatter flags.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: PowerShiftFormatter analyze [flags] FILE...\n")
+		fs.PrintDefaults()
+	}
+	cli := defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "analyze", err, "")
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "analyze", "", "no files given")
+	}
+
+	format := cli.reportFormat
+	if format == "" {
+		format = reportJSON
+	}
+	report, err := cli.newReport(format)
+	if err != nil {
+		return err
+	}
+	formatter, err := powershift.New(append(cli.formatterOptions(), powershift.WithResultFunc(report.add))...)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return readError(path, err)
+		}
+		units := []docUnit{{Text: string(data)}}
+		if extract := documentKind(path); extract != nil {
+			if units, err = extract(data); err != nil {
+				return powershift.NewError(powershift.ErrReadFailed, "extract", path, err, "")
+			}
+		}
+		report.file = path
+		for _, u := range units {
+			report.unit = u.Kind
+			report.unitN = u.N
+			if _, err := formatter.Transform(io.Discard, strings.NewReader(u.Text)); err != nil {
+				return err
+			}
+		}
+	}
+	// The report is the result here, so it goes to stdout by default
+	if cli.reportFile == "" {
+		return report.encode(os.Stdout)
+	}
+	return report.write(cli.reportFile)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// runApply implements the "apply" subcommand: it makes the rewrites of the
+// selected findings of a JSON report, and no others, in the files they were
+// found in.
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: PowerShiftFormatter apply -report FILE -ids ID,...\n")
+		fs.PrintDefaults()
+	}
+	reportFile := fs.String("report", "", "JSON report written by -report json")
+	idList := fs.String("ids", "", "Comma-separated IDs of the findings to apply")
+	writeStrategy := fs.String("write-strategy", writeRename, "How files are replaced: "+strings.Join(writeStrategies, ", "))
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "apply", err, "")
+	}
+	if *reportFile == "" || *idList == "" {
+		fs.Usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "apply", "", "-report and -ids are required")
+	}
+	if err := checkWriteStrategy(*writeStrategy); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-write-strategy", err, "")
+	}
+
+	data, err := os.ReadFile(*reportFile)
+	if err != nil {
+		return readError(*reportFile, err)
+	}
+	var doc reportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", *reportFile, err,
+			"pass a report written by -report json")
+	}
+	byID := map[int]finding{}
+	for _, f := range doc.Findings {
+		byID[f.ID] = f
+	}
+
+	// Group the selected findings by file, keeping the order files first appear in
+	byFile := map[string][]finding{}
+	var files []string
+	for _, s := range strings.Split(*idList, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return powershift.Errorf(powershift.ErrInvalidOption, "parse", "-ids", "", "invalid ID %q", s)
+		}
+		f, ok := byID[id]
+		switch {
+		case !ok:
+			return powershift.Errorf(powershift.ErrInvalidOption, "apply", fmt.Sprintf("ID %d", id), "", "not in the report")
+		case f.Kept:
+			return powershift.Errorf(powershift.ErrInvalidOption, "apply", fmt.Sprintf("ID %d", id), "", "the number was kept, there is no rewrite to apply")
+		case f.Page != 0 || f.Paragraph != 0:
+			return powershift.Errorf(powershift.ErrInvalidOption, "apply", fmt.Sprintf("ID %d", id), "", "findings in documents cannot be applied")
+		}
+		if _, seen := byFile[f.File]; !seen {
+			files = append(files, f.File)
+		}
+		if !slices.ContainsFunc(byFile[f.File], func(g finding) bool { return g.ID == id }) {
+			byFile[f.File] = append(byFile[f.File], f)
+		}
+	}
+
+	for _, path := range files {
+		n, err := applyFindings(path, byFile[path], *writeStrategy)
+		if err != nil {
+			return err
+		}
+		logf("Applied %d rewrites to %s", n, path)
+	}
+	return nil
+}
+
+// applyFindings makes the rewrites of findings in path. Every finding must
+// still match the file, so a file that changed since the report was written
+// is left alone.
+func applyFindings(path string, findings []finding, strategy string) (int, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return 0, readError(path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, readError(path, err)
+	}
+	slices.SortFunc(findings, func(a, b finding) int { return int(a.Offset - b.Offset) })
+
+	var out bytes.Buffer
+	var last int64
+	for _, f := range findings {
+		end := f.Offset + int64(len(f.Original))
+		if f.Offset < last || end > int64(len(in)) || string(in[f.Offset:end]) != f.Original {
+			return 0, powershift.Errorf(powershift.ErrInvalidOption, "apply", path,
+				"run the report again on the current files",
+				"finding %d no longer matches line %d (%q)", f.ID, f.Line, f.Original)
+		}
+		out.Write(in[last:f.Offset])
+		out.WriteString(f.Expression)
+		last = end
+	}
+	out.Write(in[last:])
+	return len(findings), replaceFile(path, out.Bytes(), info.Mode().Perm(), strategy)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// defaultStateFile is the batch journal used by -resume when -state is not given.
+const defaultStateFile = ".powershift-state"
+
+// batchJournal is an append-only list of completed files. Every entry is
+// synced to disk before the next file starts, so after a crash or interrupt
+// the journal never claims more than was actually written.
+type batchJournal struct {
+	path string
+	file *os.File
+	done map[string]bool
+}
+
+// openJournal opens the journal at path. With resume the entries of a previous
+// run are kept; otherwise the journal starts empty.
+func openJournal(path string, resume bool) (*batchJournal, error) {
+	j := &batchJournal{path: path, done: map[string]bool{}}
+	if resume {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, writeError("open", path, err)
+	}
+	j.file = file
+	return j, nil
+}
+
+func (j *batchJournal) load() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // Nothing to resume
+	}
+	if err != nil {
+		return readError(j.path, err)
+	}
+	defer file.Close()
+
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			j.done[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return powershift.NewError(powershift.ErrReadFailed, "read", j.path, err,
+			"delete the state file to start the batch from scratch")
+	}
+	return nil
+}
+
+// journalKey identifies a file independently of the working directory.
+func journalKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Done reports whether path was completed by a previous run. A nil journal
+// has no entries.
+func (j *batchJournal) Done(path string) bool {
+	return j != nil && j.done[journalKey(path)]
+}
+
+// Record marks path as completed and syncs the journal.
+func (j *batchJournal) Record(path string) error {
+	if j == nil {
+		return nil
+	}
+	key := journalKey(path)
+	j.done[key] = true
+	if _, err := j.file.WriteString(key + "\n"); err != nil {
+		return writeError("write", j.path, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return writeError("sync", j.path, err)
+	}
+	return nil
+}
+
+// Finish removes the journal after the whole batch succeeded.
+func (j *batchJournal) Finish() error {
+	if j == nil {
+		return nil
+	}
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return writeError("remove", j.path, err)
+	}
+	return nil
+}
+
+// Close releases the journal file; it is safe to call after Finish.
+func (j *batchJournal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// cacheFileSize is the number of decompositions a -cache-file keeps.
+const cacheFileSize = 1 << 20
+
+// loadCacheFile opens the decomposition cache saved at path. A missing file
+// starts an empty cache, and so does one saved by another strategy version.
+func loadCacheFile(path string, size int) (*powershift.Cache, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return powershift.NewCache(size), nil
+	}
+	if err != nil {
+		return nil, readError(path, err)
+	}
+	defer f.Close()
+	cache, err := powershift.LoadCache(f, size)
+	if errors.Is(err, powershift.ErrCacheStale) {
+		logf("Discarding %s: %v", path, err)
+		return cache, nil
+	}
+	var e *powershift.Error
+	if errors.As(err, &e) {
+		// Name the file rather than the cache it holds
+		return nil, powershift.NewError(e.Kind, e.Op, path, e.Err, "delete the cache file to start over")
+	}
+	return cache, err
+}
+
+// saveCacheFile replaces the cache file at path, so an interrupted run leaves
+// the previous cache intact.
+func saveCacheFile(path string, cache *powershift.Cache) error {
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		return err
+	}
+	return replaceFile(path, buf.Bytes(), 0o644, writeRename)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// clipboardTool is an external program that reads or writes the clipboard.
+type clipboardTool struct {
+	paste []string // Command printing the clipboard to stdout
+	copy  []string // Command setting the clipboard from stdin
+}
+
+// formatClipboard transforms the text on the system clipboard and puts the
+// result back.
+func formatClipboard(formatter *powershift.Formatter) error {
+	tool, err := findClipboardTool()
+	if err != nil {
+		return err
+	}
+	var text bytes.Buffer
+	paste := exec.Command(tool.paste[0], tool.paste[1:]...)
+	paste.Stdout = &text
+	if err := paste.Run(); err != nil {
+		return powershift.NewError(powershift.ErrReadFailed, "read", "clipboard", err, commandHint(paste))
+	}
+
+	var out bytes.Buffer
+	stats, err := formatter.Transform(&out, &text)
+	if err != nil {
+		return err
+	}
+	if !stats.Changed() {
+		logf("Nothing to rewrite on the clipboard (%d numbers found)", stats.Matches)
+		return nil // Leave the clipboard untouched, including its formatting
+	}
+
+	cp := exec.Command(tool.copy[0], tool.copy[1:]...)
+	cp.Stdin = &out
+	if err := cp.Run(); err != nil {
+		return powershift.NewError(powershift.ErrWriteFailed, "write", "clipboard", err, commandHint(cp))
+	}
+	logf("Rewrote %d of %d numbers on the clipboard", stats.Replaced, stats.Matches)
+	return nil
+}
+
+// firstInstalled returns the first tool whose programs are all on PATH.
+func firstInstalled(tools []clipboardTool) (clipboardTool, error) {
+	var names []string
+	for _, t := range tools {
+		_, errPaste := exec.LookPath(t.paste[0])
+		_, errCopy := exec.LookPath(t.copy[0])
+		if errPaste == nil && errCopy == nil {
+			return t, nil
+		}
+		name := t.paste[0]
+		if t.copy[0] != name {
+			name += "/" + t.copy[0]
+		}
+		names = append(names, name)
+	}
+	return clipboardTool{}, powershift.NewError(powershift.ErrInvalidOption, "open", "clipboard",
+		errors.New("no clipboard tool found"), "install one of "+strings.Join(names, ", "))
+}
+
+func commandHint(cmd *exec.Cmd) string {
+	return "check that " + cmd.Path + " can access the clipboard, e.g. that a display is available"
+}
@@ -0,0 +1,5 @@
+package main
+
+func findClipboardTool() (clipboardTool, error) {
+	return firstInstalled([]clipboardTool{{paste: []string{"pbpaste"}, copy: []string{"pbcopy"}}})
+}
@@ -0,0 +1,18 @@
+//go:build !darwin && !windows
+
+package main
+
+import "os"
+
+// findClipboardTool prefers the Wayland tools when a Wayland session is
+// running and falls back to the X11 ones.
+func findClipboardTool() (clipboardTool, error) {
+	tools := []clipboardTool{
+		{paste: []string{"xclip", "-selection", "clipboard", "-o"}, copy: []string{"xclip", "-selection", "clipboard", "-i"}},
+		{paste: []string{"xsel", "--clipboard", "--output"}, copy: []string{"xsel", "--clipboard", "--input"}},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		tools = append([]clipboardTool{{paste: []string{"wl-paste", "--no-newline"}, copy: []string{"wl-copy"}}}, tools...)
+	}
+	return firstInstalled(tools)
+}
@@ -0,0 +1,10 @@
+package main
+
+// PowerShell handles Unicode text both ways, unlike clip.exe which reads the
+// console code page.
+func findClipboardTool() (clipboardTool, error) {
+	return firstInstalled([]clipboardTool{{
+		paste: []string{"powershell.exe", "-NoProfile", "-Command", "[Console]::OutputEncoding = [Text.Encoding]::UTF8; Get-Clipboard -Raw"},
+		copy:  []string{"powershell.exe", "-NoProfile", "-Command", "[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+	}})
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// defaultConfigName is the config file looked for when none is given.
+const defaultConfigName = "powershift.json"
+
+// configField maps a key of the config file to the command-line flag it sets.
+// Flags given explicitly on the command line always win over the config file.
+type configField struct {
+	Key         string
+	Flag        string
+	Type        string // JSON Schema type: "string", "integer" or "boolean"
+	Description string
+	Big         bool                     // An integer of any size rather than an int64
+	Enum        func() []string          // Allowed values, nil if unrestricted
+	Check       func(value string) error // Extra validation, nil if none
+}
+
+var configFields = []configField{
+	{Key: "threshold", Flag: "t", Type: "integer", Big: true,
+		Description: "Process numbers strictly greater than this threshold"},
+	{Key: "min_digits", Flag: "min-digits", Type: "integer",
+		Description: "Only match runs of at least this many digits"},
+	{Key: "max", Flag: "max", Type: "integer", Big: true,
+		Description: "Leave numbers strictly greater than this ceiling alone"},
+	{Key: "emit", Flag: "emit", Type: "string",
+		Description: "Replacement style", Enum: emitNames},
+	{Key: "expr_style", Flag: "expr-style", Type: "string",
+		Description: "Notation of the powers", Enum: exprStyleNames},
+	{Key: "expr_template", Flag: "expr-template", Type: "string",
+		Description: "Go text/template that renders every expression",
+		Check: func(v string) error {
+			_, err := powershift.New(powershift.WithExprTemplate(v))
+			return err
+		}},
+	{Key: "lang", Flag: "lang", Type: "string",
+		Description: "Target language profile", Enum: powershift.ProfileNames},
+	{Key: "int_type", Flag: "int-type", Type: "string",
+		Description: "Integer type of every literal in languages with type suffixes"},
+	{Key: "named_constants", Flag: "named-constants", Type: "boolean",
+		Description: "Write the maximum values of the integer types by name"},
+	{Key: "write_strategy", Flag: "write-strategy", Type: "string",
+		Description: "How -w replaces files", Enum: func() []string { return writeStrategies }},
+	{Key: "skip_secrets", Flag: "skip-secrets", Type: "boolean",
+		Description: "Leave secret-looking files untouched"},
+	{Key: "report", Flag: "report", Type: "string",
+		Description: "Report format", Enum: func() []string { return reportFormats }},
+	{Key: "report_template", Flag: "report-template", Type: "string",
+		Description: "File with a Go text/template that writes the report instead of a format"},
+	{Key: "report_bits", Flag: "report-bits", Type: "boolean",
+		Description: "Add base conversions to reports and include kept numbers"},
+	{Key: "report_suspicious", Flag: "report-suspicious", Type: "boolean",
+		Description: "List the numbers a safeguard kept in reports, with the reason"},
+	{Key: "redact_context", Flag: "redact-context", Type: "boolean",
+		Description: "Leave source lines out of reports"},
+	{Key: "ranges", Flag: "ranges", Type: "boolean",
+		Description: "Rewrite power-of-two ranges on a line as a pair"},
+	{Key: "annotate_ranges", Flag: "annotate-ranges", Type: "boolean",
+		Description: "Note the interval after the end of a range"},
+	{Key: "skip_arithmetic", Flag: "skip-arithmetic", Type: "boolean",
+		Description: "Keep literals that are operands of arithmetic operators"},
+	{Key: "fold", Flag: "fold", Type: "boolean",
+		Description: "Rewrite constant arithmetic around large literals as its value"},
+	{Key: "continuations", Flag: "continuations", Type: "boolean",
+		Description: "Treat backslash-continued lines as one line"},
+	{Key: "pattern", Flag: "pattern", Type: "string",
+		Description: "Regular expression that finds numbers"},
+	{Key: "match_timeout", Flag: "match-timeout", Type: "string",
+		Description: "Longest time the pattern may take to find one match, e.g. 500ms",
+		Check: func(v string) error {
+			_, err := time.ParseDuration(v)
+			return err
+		}},
+	{Key: "tag", Flag: "tag", Type: "boolean",
+		Description: "Mark every rewrite with a psfmt comment"},
+	{Key: "words", Flag: "words", Type: "boolean",
+		Description: "Experimental: match roman numerals and numbers spelled out in English, with emit annotate"},
+	{Key: "scientific", Flag: "scientific", Type: "boolean",
+		Description: "Rewrite numbers in scientific notation whose value is an integer"},
+	{Key: "shifted_neighbors", Flag: "shifted-neighbors", Type: "boolean",
+		Description: "Rewrite small literals on lines that already hold a shift expression"},
+	{Key: "min_savings", Flag: "min-savings", Type: "string",
+		Description: "Fraction by which an expression must be shorter than the literal, e.g. 0.2",
+		Check:       func(v string) error { return new(ratioFlag).Set(v) }},
+	{Key: "max_growth", Flag: "max-growth", Type: "string",
+		Description: "Fraction by which an expression may be longer than the literal, e.g. 0.5",
+		Check:       func(v string) error { return new(ratioFlag).Set(v) }},
+	{Key: "max_replacements", Flag: "max-replacements", Type: "integer",
+		Description: "Most literals rewritten in each file, 0 for no limit"},
+	{Key: "sample", Flag: "sample", Type: "string",
+		Description: "Fraction of the literals to rewrite, chosen deterministically, e.g. 0.1",
+		Check:       func(v string) error { return new(ratioFlag).Set(v) }},
+	{Key: "per_line", Flag: "per-line", Type: "string",
+		Description: "Which literals of each line may be rewritten: all, first or last",
+		Check: func(v string) error {
+			_, err := powershift.New(powershift.WithPerLine(powershift.PerLine(v)))
+			return err
+		}},
+	{Key: "forms", Flag: "forms", Type: "string",
+		Description: "Comma-separated forms to try, in order",
+		Check: func(v string) error {
+			var forms formsFlag
+			return forms.Set(v)
+		}},
+	{Key: "scoring", Flag: "scoring", Type: "string",
+		Description: "How to pick among the forms that apply", Enum: scoringNames},
+	{Key: "form_weights", Flag: "form-weights", Type: "string",
+		Description: "Comma-separated FORM=N weights added to the scores of the forms, e.g. plus-one=2",
+		Check: func(v string) error {
+			var w weightsFlag
+			return w.Set(v)
+		}},
+	{Key: "max_terms", Flag: "max-terms", Type: "integer",
+		Description: "Maximum number of powers in the sum-of-powers form"},
+	{Key: "max_multiplier", Flag: "max-multiplier", Type: "integer",
+		Description: "Largest odd multiplier of the multiple form"},
+	{Key: "approx", Flag: "approx", Type: "string",
+		Description: "Fraction of a power of two within which numbers no form decomposes are rewritten, e.g. 0.1%",
+		Check:       func(v string) error { return new(ratioFlag).Set(v) }},
+	{Key: "approx_mode", Flag: "approx-mode", Type: "string",
+		Description: "How approx writes a near miss", Enum: approxModeNames},
+	{Key: "fail_on", Flag: "fail-on", Type: "string",
+		Description: "Lowest severity of the numbers check finds that fails the run", Enum: failOnNames},
+	{Key: "severity", Flag: "severity", Type: "string",
+		Description: "Comma-separated FORM=LEVEL severities of the numbers check finds, e.g. plus-one=note",
+		Check: func(v string) error {
+			var s severitiesFlag
+			return s.Set(v)
+		}},
+	{Key: "tiers", Flag: "tiers", Type: "string",
+		Description: "Emit mode and forms by value, e.g. 1000:annotate,1e6:minus-one,1e9",
+		Check: func(v string) error {
+			_, err := powershift.ParseTiers(v)
+			return err
+		}},
+	{Key: "include", Flag: "include", Type: "string",
+		Description: "Comma-separated globs of the files to format in directories"},
+	{Key: "exclude", Flag: "exclude", Type: "string",
+		Description: "Comma-separated globs of the files and directories to skip"},
+	{Key: "cache_file", Flag: "cache-file", Type: "string",
+		Description: "File keeping decompositions across runs"},
+	{Key: "boundary", Flag: "boundary", Type: "string",
+		Description: "What ends a literal: letters, word, whitespace or custom",
+		Check: func(v string) error {
+			var b boundaryFlag
+			return b.Set(v)
+		}},
+	{Key: "glue_before", Flag: "glue-before", Type: "string",
+		Description: "With boundary custom, regexp of preceding characters that keep a number",
+		Check: func(v string) error {
+			_, err := regexp.Compile(v)
+			return err
+		}},
+	{Key: "glue_after", Flag: "glue-after", Type: "string",
+		Description: "With boundary custom, regexp of following characters that keep a number",
+		Check: func(v string) error {
+			_, err := regexp.Compile(v)
+			return err
+		}},
+	{Key: "stream", Flag: "stream", Type: "boolean",
+		Description: "Process inputs in chunks so memory use stays bounded"},
+	{Key: "max_memory", Flag: "max-memory", Type: "string",
+		Description: "Soft memory limit such as 512MiB, enables streaming",
+		Check: func(v string) error {
+			_, err := parseByteSize(v)
+			return err
+		}},
+}
+
+func emitNames() []string {
+	var names []string
+	for _, e := range powershift.EmitNames() {
+		names = append(names, string(e))
+	}
+	return names
+}
+
+func scoringNames() []string {
+	var names []string
+	for _, s := range powershift.ScoringNames() {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+func approxModeNames() []string {
+	var names []string
+	for _, m := range powershift.ApproxModeNames() {
+		names = append(names, string(m))
+	}
+	return names
+}
+
+func exprStyleNames() []string {
+	var names []string
+	for _, s := range powershift.ExprStyleNames() {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+func lookupConfigField(key string) (configField, bool) {
+	for _, f := range configFields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return configField{}, false
+}
+
+// configValue is one validated setting, already converted to flag syntax.
+type configValue struct {
+	Field configField
+	Value string
+}
+
+// findProjectConfig looks for a config file in dir and its parents, so that
+// a checked-in config applies anywhere inside the project.
+func findProjectConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, defaultConfigName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads and validates a config file.
+func loadConfig(path string) ([]configValue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, readError(path, err)
+	}
+	values, problems := parseConfig(data)
+	if len(problems) > 0 {
+		return nil, powershift.NewError(powershift.ErrConfigInvalid, "load", path,
+			errors.New(strings.Join(problems, "; ")),
+			"run \"PowerShiftFormatter config validate\" for details, or \"config schema\" for the expected format")
+	}
+	return values, nil
+}
+
+// parseConfig checks a config document and returns the settings it contains,
+// or a list of problems, each prefixed with its line and column.
+func parseConfig(data []byte) ([]configValue, []string) {
+	var problems []string
+	report := func(offset int64, format string, args ...any) {
+		line, col := lineCol(data, offset)
+		problems = append(problems, fmt.Sprintf("%d:%d: %s", line, col, fmt.Sprintf(format, args...)))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		report(dec.InputOffset(), "config must be a JSON object")
+		return nil, problems
+	}
+
+	var values []configValue
+	seen := map[string]bool{}
+	for dec.More() {
+		keyOffset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			report(syntaxOffset(err, dec), "%v", err)
+			return nil, problems
+		}
+		key := tok.(string)
+		// InputOffset points at the separator before the key, skip to the key itself
+		keyOffset = skipSeparators(data, keyOffset)
+
+		var raw any
+		valueOffset := skipSeparators(data, dec.InputOffset())
+		if err := dec.Decode(&raw); err != nil {
+			report(syntaxOffset(err, dec), "%v", err)
+			return nil, problems
+		}
+
+		field, ok := lookupConfigField(key)
+		if !ok {
+			report(keyOffset, "unknown key %q (known keys: %s)", key, strings.Join(configKeys(), ", "))
+			continue
+		}
+		if seen[key] {
+			report(keyOffset, "duplicate key %q", key)
+			continue
+		}
+		seen[key] = true
+
+		value, err := field.convert(raw)
+		if err != nil {
+			report(valueOffset, "%s: %v", key, err)
+			continue
+		}
+		values = append(values, configValue{Field: field, Value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		report(syntaxOffset(err, dec), "%v", err)
+		return nil, problems
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		report(dec.InputOffset(), "unexpected data after the config object")
+	}
+	return values, problems
+}
+
+// convert type-checks a decoded JSON value and renders it in flag syntax.
+func (f configField) convert(raw any) (string, error) {
+	var value string
+	switch f.Type {
+	case "integer":
+		n, ok := raw.(json.Number)
+		if !ok {
+			return "", fmt.Errorf("expected an integer, got %s", jsonKind(raw))
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, 64); err != nil && !f.Big {
+			return "", fmt.Errorf("expected an integer, got %s", n)
+		}
+		if _, ok := new(big.Int).SetString(n.String(), 10); !ok {
+			return "", fmt.Errorf("expected an integer, got %s", n)
+		}
+		value = n.String()
+	case "boolean":
+		b, ok := raw.(bool)
+		if !ok {
+			return "", fmt.Errorf("expected true or false, got %s", jsonKind(raw))
+		}
+		value = strconv.FormatBool(b)
+	default:
+		s, ok := raw.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string, got %s", jsonKind(raw))
+		}
+		value = s
+	}
+	if f.Enum != nil {
+		allowed := f.Enum()
+		found := false
+		for _, a := range allowed {
+			found = found || a == value
+		}
+		if !found {
+			return "", fmt.Errorf("%q is not one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+	if f.Check != nil {
+		if err := f.Check(value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+func configKeys() []string {
+	keys := make([]string, len(configFields))
+	for i, f := range configFields {
+		keys[i] = f.Key
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyConfig sets every config value whose flag was not given on the command line.
+func applyConfig(fs *flag.FlagSet, values []configValue) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[canonicalFlag(f.Name)] = true })
+	for _, v := range values {
+		if explicit[v.Field.Flag] {
+			continue
+		}
+		if err := fs.Set(v.Field.Flag, v.Value); err != nil {
+			return powershift.NewError(powershift.ErrConfigInvalid, "apply", v.Field.Key, err, "")
+		}
+	}
+	return nil
+}
+
+// flagsWith returns the formatter flags set to base, a set of flags given on
+// a command line, with config values applied on top. Unlike applyConfig the
+// config values win, as they are more specific than the base.
+func flagsWith(base []*flag.Flag, values []configValue) (*cliFlags, error) {
+	fs := flag.NewFlagSet("options", flag.ContinueOnError)
+	cli := defineFlags(fs)
+	for _, f := range base {
+		if fs.Lookup(f.Name) != nil {
+			fs.Set(f.Name, f.Value.String())
+		}
+	}
+	for _, v := range values {
+		if err := fs.Set(v.Field.Flag, v.Value); err != nil {
+			return nil, powershift.NewError(powershift.ErrConfigInvalid, "apply", v.Field.Key, err, "")
+		}
+	}
+	return cli, nil
+}
+
+// runConfig implements the "config" subcommand.
+func runConfig(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  PowerShiftFormatter config validate [file]   Check a config file (default %s)\n", defaultConfigName)
+		fmt.Fprintf(os.Stderr, "  PowerShiftFormatter config schema            Print the JSON Schema of the config file\n")
+		fmt.Fprintf(os.Stderr, "  PowerShiftFormatter config init [-o file] [-force] --from-flags FLAGS...\n")
+		fmt.Fprintf(os.Stderr, "                                               Write a config file equivalent to FLAGS\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "config", "", "missing config subcommand")
+	}
+	switch args[0] {
+	case "validate":
+		path := defaultConfigName
+		if len(args) > 1 {
+			path = args[1]
+		}
+		return validateConfigFile(os.Stdout, path)
+	case "schema":
+		return writeJSON(os.Stdout, configSchema())
+	case "init":
+		return initConfig(args[1:])
+	}
+	usage()
+	return powershift.Errorf(powershift.ErrInvalidOption, "run", "config", "", "unknown config subcommand %q", args[0])
+}
+
+// validateConfigFile prints every problem found in path, one per line.
+func validateConfigFile(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return readError(path, err)
+	}
+	_, problems := parseConfig(data)
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s:%s\n", path, p)
+	}
+	if len(problems) > 0 {
+		return powershift.Errorf(powershift.ErrConfigInvalid, "validate", path,
+			"fix the problems listed above", "%d problem(s) found", len(problems))
+	}
+	fmt.Fprintf(w, "%s: OK\n", path)
+	return nil
+}
+
+// initConfig implements "config init": the flags after --from-flags are parsed
+// exactly like the formatter's own flags and written out as a config file.
+func initConfig(args []string) error {
+	// Everything after --from-flags belongs to the formatter, not to "config init"
+	var formatterArgs []string
+	fromFlags := false
+	for i, a := range args {
+		if a == "--from-flags" || a == "-from-flags" {
+			args, formatterArgs, fromFlags = args[:i], args[i+1:], true
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	out := fs.String("o", defaultConfigName, "Config file to write")
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "config init", err, "")
+	}
+	if fs.NArg() > 0 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "parse", "config init",
+			"put formatter flags after --from-flags", "unexpected arguments %v", fs.Args())
+	}
+
+	settings := map[string]any{}
+	if fromFlags {
+		formatterFlags := flag.NewFlagSet("formatter", flag.ContinueOnError)
+		defineFlags(formatterFlags)
+		if err := formatterFlags.Parse(formatterArgs); err != nil {
+			return powershift.NewError(powershift.ErrInvalidOption, "parse", "--from-flags", err,
+				"pass the same flags you would give the formatter, e.g. --from-flags -t 1000 -emit both")
+		}
+		var skipped []string
+		formatterFlags.Visit(func(f *flag.Flag) {
+			field, ok := configFieldForFlag(f.Name)
+			if !ok {
+				skipped = append(skipped, "-"+f.Name)
+				return
+			}
+			settings[field.Key] = field.jsonValue(f.Value.String())
+		})
+		if len(skipped) > 0 {
+			logf("Note: not written to the config (per-run flags): %s", strings.Join(skipped, ", "))
+		}
+	}
+
+	if !*force {
+		if _, err := os.Stat(*out); err == nil {
+			return powershift.Errorf(powershift.ErrWriteFailed, "create", *out,
+				"pass -force to overwrite it", "config file already exists")
+		}
+	}
+	return writeJSONFile(*out, settings)
+}
+
+func configFieldForFlag(name string) (configField, bool) {
+	for _, f := range configFields {
+		if f.Flag == canonicalFlag(name) {
+			return f, true
+		}
+	}
+	return configField{}, false
+}
+
+// jsonValue converts a flag value back to the JSON type of the field.
+func (f configField) jsonValue(value string) any {
+	switch f.Type {
+	case "integer":
+		return json.Number(value)
+	case "boolean":
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return value
+}
+
+// configSchema builds a JSON Schema document describing the config file.
+func configSchema() map[string]any {
+	props := map[string]any{}
+	for _, f := range configFields {
+		p := map[string]any{"type": f.Type, "description": f.Description}
+		if f.Enum != nil {
+			p["enum"] = f.Enum()
+		}
+		props[f.Key] = p
+	}
+	return map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "PowerShiftFormatter configuration",
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// writeJSON writes v as indented JSON without HTML escaping.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return writeError("write", "", err)
+	}
+	return nil
+}
+
+// lineCol converts a byte offset into a 1-based line and column.
+func lineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// skipSeparators advances offset past whitespace, commas and colons.
+func skipSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// syntaxOffset finds the best position to report a decoding error at.
+func syntaxOffset(err error, dec *json.Decoder) int64 {
+	var se *json.SyntaxError
+	if errors.As(err, &se) {
+		return se.Offset
+	}
+	return dec.InputOffset()
+}
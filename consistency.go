@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// use is one place a value is written, either as a literal or as a shift
+// expression.
+type use struct {
+	path       string
+	offset     int
+	line, col  int
+	text       string
+	expr       bool
+	arithmetic bool   // A literal that is an operand of an operator
+	plain      string // A grouped literal without its digit separators
+}
+
+// spelling is one way a value is written: the text of its first use with
+// blanks and outer parentheses removed, and all uses written that way.
+type spelling struct {
+	key  string
+	uses []use
+}
+
+// valueUses collects the spellings of one value, in the order they appear.
+type valueUses struct {
+	value     string
+	spellings []*spelling
+}
+
+// runConsistency implements the "consistency" subcommand: it reports values
+// that are written both as literals and as expressions, or as different
+// expressions, across a set of files, and with -fix rewrites them all the way
+// most of them are written. It accepts the formatter flags.
+func runConsistency(args []string) error {
+	fs := flag.NewFlagSet("consistency", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: PowerShiftFormatter consistency [flags] FILE|DIR...\n")
+		fs.PrintDefaults()
+	}
+	fix := fs.Bool("fix", false, "Rewrite every value the way most of its uses are written")
+	cli := defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "consistency", err, "")
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "consistency", "", "no files given")
+	}
+	if err := checkWriteStrategy(cli.writeStrategy); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-write-strategy", err, "")
+	}
+
+	paths, err := expandInputs(fs.Args(), nil, nil)
+	if err != nil {
+		return err
+	}
+	values := map[string]*valueUses{}
+	var order []*valueUses
+	for _, path := range paths {
+		uses, err := fileUses(cli, path)
+		if err != nil {
+			return err
+		}
+		for _, u := range uses {
+			v := values[u.value]
+			if v == nil {
+				v = &valueUses{value: u.value}
+				values[u.value] = v
+				order = append(order, v)
+			}
+			v.add(u.use)
+		}
+	}
+
+	edits := map[string][]powershift.Edit{}
+	inconsistent := 0
+	for _, v := range order {
+		if len(v.spellings) < 2 || !v.hasExpr() {
+			continue
+		}
+		inconsistent++
+		major := v.majority()
+		for _, s := range v.spellings {
+			if s == major {
+				continue
+			}
+			for _, u := range s.uses {
+				fmt.Printf("%s:%d:%d: %s is written %s here and %s in %d of %d uses\n",
+					u.path, u.line, u.col, v.value, u.text, major.uses[0].text, len(major.uses), v.count())
+				edits[u.path] = append(edits[u.path], powershift.Edit{
+					Offset: int64(u.offset), Length: int64(len(u.text)),
+					Original: u.text, Replacement: respell(u, major.uses[0]),
+				})
+			}
+		}
+	}
+	if inconsistent == 0 {
+		return nil
+	}
+	if !*fix {
+		return fmt.Errorf("found %d values written in more than one way; -fix uses the most common spelling everywhere", inconsistent)
+	}
+	for _, path := range paths {
+		if len(edits[path]) == 0 {
+			continue
+		}
+		if err := applyEdits(path, edits[path], cli.writeStrategy); err != nil {
+			return err
+		}
+		logf("Normalized %d uses in %s", len(edits[path]), path)
+	}
+	return nil
+}
+
+// valuedUse is a use together with the decimal value it stands for.
+type valuedUse struct {
+	use
+	value string
+}
+
+// fileUses returns the literals and shift expressions of a file, using the
+// language its extension implies unless -lang names one. Binary files and documents have none.
+func fileUses(cli *cliFlags, path string) ([]valuedUse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, readError(path, err)
+	}
+	if isBinary(data) || documentKind(path) != nil {
+		return nil, nil
+	}
+	fileCli := *cli
+	fileCli.lang = languageFor(path, cli.lang)
+	var literals []powershift.Result
+	opts := append(fileCli.formatterOptions(), powershift.WithResultFunc(func(res powershift.Result) {
+		literals = append(literals, res)
+	}))
+	formatter, err := powershift.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := formatter.Transform(io.Discard, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	// The formatter sees the digit groups of 1_000_000 as numbers of their
+	// own, so grouped literals are taken from what Normalize would ungroup
+	var uses []valuedUse
+	var grouped []powershift.Edit
+	_, plain := formatter.Normalize(string(data), powershift.NormalizeOptions{Grouping: powershift.GroupPlain})
+	for _, e := range plain {
+		v, ok := new(big.Int).SetString(e.Replacement, 10)
+		if !ok {
+			continue // A hex literal
+		}
+		grouped = append(grouped, e)
+		line, col := lineCol(data, e.Offset)
+		uses = append(uses, valuedUse{
+			use:   use{path: path, offset: int(e.Offset), line: line, col: col, text: e.Original, plain: e.Replacement},
+			value: v.String(),
+		})
+	}
+	inGrouped := func(offset int) bool {
+		return slices.ContainsFunc(grouped, func(e powershift.Edit) bool {
+			return int64(offset) >= e.Offset && int64(offset) < e.Offset+e.Length
+		})
+	}
+
+	exprs := formatter.Expressions(string(data))
+	exprs = slices.DeleteFunc(exprs, func(e powershift.ExprMatch) bool {
+		return inGrouped(e.Offset) || inGrouped(e.Offset+len(e.Text)-1)
+	})
+	for _, e := range exprs {
+		line, col := lineCol(data, int64(e.Offset))
+		uses = append(uses, valuedUse{
+			use:   use{path: path, offset: e.Offset, line: line, col: col, text: e.Text, expr: true},
+			value: e.Value.String(),
+		})
+	}
+	for _, res := range literals {
+		// Operands such as the 1024 of 1024<<10 belong to the expression
+		inside := slices.ContainsFunc(exprs, func(e powershift.ExprMatch) bool {
+			return int(res.Offset) >= e.Offset && int(res.Offset) < e.Offset+len(e.Text)
+		})
+		if inside || inGrouped(int(res.Offset)) {
+			continue
+		}
+		uses = append(uses, valuedUse{
+			use: use{path: path, offset: int(res.Offset), line: res.Line, col: res.Column,
+				text: res.Text, arithmetic: res.Arithmetic},
+			value: res.Value.String(),
+		})
+	}
+	slices.SortFunc(uses, func(a, b valuedUse) int { return a.offset - b.offset })
+	return uses, nil
+}
+
+func (v *valueUses) add(u use) {
+	// Blanks, outer parentheses and digit separators do not make a
+	// different spelling
+	key := strings.Join(strings.Fields(u.text), "")
+	if u.plain != "" {
+		key = u.plain
+	}
+	for parenthesized(key) {
+		key = key[1 : len(key)-1]
+	}
+	for _, s := range v.spellings {
+		if s.key == key {
+			s.uses = append(s.uses, u)
+			return
+		}
+	}
+	v.spellings = append(v.spellings, &spelling{key: key, uses: []use{u}})
+}
+
+func (v *valueUses) hasExpr() bool {
+	return slices.ContainsFunc(v.spellings, func(s *spelling) bool { return s.uses[0].expr })
+}
+
+func (v *valueUses) count() int {
+	n := 0
+	for _, s := range v.spellings {
+		n += len(s.uses)
+	}
+	return n
+}
+
+// majority returns the spelling with the most uses. Ties go to expressions,
+// then to the spelling seen first.
+func (v *valueUses) majority() *spelling {
+	best := v.spellings[0]
+	for _, s := range v.spellings[1:] {
+		if len(s.uses) > len(best.uses) || len(s.uses) == len(best.uses) && s.uses[0].expr && !best.uses[0].expr {
+			best = s
+		}
+	}
+	return best
+}
+
+// respell returns the text that writes u the way target is written. An
+// expression replacing an operand is parenthesized.
+func respell(u, target use) string {
+	text := target.text
+	if target.expr && u.arithmetic && !parenthesized(text) {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// applyEdits makes edits, which must not overlap, in path.
+func applyEdits(path string, edits []powershift.Edit, strategy string) error {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return readError(path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return readError(path, err)
+	}
+	slices.SortFunc(edits, func(a, b powershift.Edit) int { return int(a.Offset - b.Offset) })
+	var out bytes.Buffer
+	var last int64
+	for _, e := range edits {
+		out.Write(in[last:e.Offset])
+		out.WriteString(e.Replacement)
+		last = e.Offset + e.Length
+	}
+	out.Write(in[last:])
+	return replaceFile(path, out.Bytes(), info.Mode().Perm(), strategy)
+}
+
+// parenthesized reports whether s is wrapped in a single pair of parentheses.
+func parenthesized(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i == len(s)-1
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConsistencyDigitSeparators(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sizes.go")
+	src := "const (\n\tA = 1_048_576\n\tB = 1048576\n\tC = 1 << 20\n)\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("consistency", flag.ContinueOnError)
+	cli := defineFlags(fs)
+	if err := fs.Parse([]string{"-no-config"}); err != nil {
+		t.Fatal(err)
+	}
+	uses, err := fileUses(cli, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &valueUses{value: "1048576"}
+	for _, u := range uses {
+		if u.value != v.value {
+			t.Errorf("%s is read as %s", u.text, u.value)
+			continue
+		}
+		v.add(u.use)
+	}
+	if len(v.spellings) != 2 || len(v.spellings[0].uses) != 2 || v.spellings[0].uses[0].text != "1_048_576" {
+		t.Errorf("the literals are not one spelling: %+v", v.spellings)
+	}
+}
+
+func TestConsistencyLongerTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "masks.go")
+	src := "var (\n\tA = a1 << 2\n\tB = 0x1 << 5\n\tC = 1 << 5\n)\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("consistency", flag.ContinueOnError)
+	cli := defineFlags(fs)
+	if err := fs.Parse([]string{"-no-config"}); err != nil {
+		t.Fatal(err)
+	}
+	uses, err := fileUses(cli, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range uses {
+		if u.expr && u.text != "1 << 5" {
+			t.Errorf("%s at line %d is read as %s", u.text, u.line, u.value)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift/client"
+)
+
+// daemon keeps Formatters for every project it has served warm, together
+// with a decomposition cache shared by all of them.
+type daemon struct {
+	flags []*flag.Flag // Formatter flags given on the command line
+	cache *powershift.Cache
+
+	mu         sync.Mutex
+	formatters map[projectKey]*powershift.Formatter
+	lastActive time.Time
+}
+
+// projectKey identifies a Formatter: the config file it was built from (empty
+// if there is none), that file's modification time, so edits take effect
+// without a restart, and the language implied by the file extension.
+type projectKey struct {
+	config  string
+	modTime time.Time
+	lang    string
+}
+
+// runDaemon implements the "daemon" subcommand.
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	socket := fs.String("socket", client.DefaultSocketPath(), "Unix socket to listen on")
+	idle := fs.Duration("idle-timeout", 30*time.Minute, "Exit after this long without requests (0 keeps running)")
+	cacheSize := fs.Int("cache-size", 1<<16, "Number of decompositions kept in memory")
+	defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "daemon", err, "")
+	}
+
+	d := &daemon{
+		cache:      powershift.NewCache(*cacheSize),
+		formatters: map[projectKey]*powershift.Formatter{},
+		lastActive: time.Now(),
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "cache-file" {
+			d.flags = append(d.flags, f)
+		}
+	})
+	// The cache outlives the daemon in -cache-file, which project configs
+	// cannot override since all projects share it
+	if path := fs.Lookup("cache-file").Value.String(); path != "" {
+		var err error
+		if d.cache, err = loadCacheFile(path, *cacheSize); err != nil {
+			return err
+		}
+		defer func() {
+			if err := saveCacheFile(path, d.cache); err != nil {
+				logf("Saving the cache: %v", err)
+			}
+		}()
+	}
+	// Fail on bad formatter flags now rather than on the first request
+	if _, err := d.formatter(client.FormatParams{}); err != nil {
+		return err
+	}
+
+	ln, err := listenSocket(*socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(*socket)
+	defer ln.Close()
+	logf("Listening on %s", *socket)
+
+	if *idle > 0 {
+		go d.exitWhenIdle(ln, *idle)
+	}
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil // Closed by a shutdown request or the idle timer
+		}
+		if err != nil {
+			return err
+		}
+		go d.serve(conn, func() { ln.Close() })
+	}
+}
+
+// listenSocket listens on path, replacing a socket left behind by a daemon
+// that did not shut down cleanly but refusing to take over a live one.
+func listenSocket(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, powershift.Errorf(powershift.ErrInvalidOption, "listen", path,
+			"stop the running daemon or pick another -socket", "a daemon is already listening")
+	}
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, writeError("create", filepath.Dir(path), err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, writeError("listen", path, err)
+	}
+	// Only the owner may talk to the daemon; on Windows the socket inherits
+	// the ACL of the per-user directory it is in
+	if err := os.Chmod(path, 0o600); err != nil && runtime.GOOS != "windows" {
+		ln.Close()
+		return nil, writeError("chmod", path, err)
+	}
+	return ln, nil
+}
+
+func (d *daemon) exitWhenIdle(ln net.Listener, idle time.Duration) {
+	for range time.Tick(idle / 10) {
+		d.mu.Lock()
+		since := time.Since(d.lastActive)
+		d.mu.Unlock()
+		if since >= idle {
+			logf("Idle for %s, exiting", idle.Round(time.Second))
+			ln.Close()
+			return
+		}
+	}
+}
+
+// serve answers the requests of one connection in order.
+func (d *daemon) serve(conn net.Conn, shutdown func()) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		var req client.Request
+		if err := client.ReadFrame(r, &req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logf("Reading request: %v", err)
+			}
+			return
+		}
+		d.mu.Lock()
+		d.lastActive = time.Now()
+		d.mu.Unlock()
+
+		resp := client.Response{ID: req.ID}
+		result, err := d.call(req)
+		if err == nil {
+			resp.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			resp.Error = &client.Error{Message: err.Error(), Hint: powershift.Hint(err)}
+		}
+		if err := client.WriteFrame(w, resp); err != nil || w.Flush() != nil {
+			return
+		}
+		if req.Method == "shutdown" && err == nil {
+			shutdown()
+			return
+		}
+	}
+}
+
+func (d *daemon) call(req client.Request) (any, error) {
+	switch req.Method {
+	case "ping":
+		return map[string]string{"version": currentBuildInfo().Version}, nil
+	case "format":
+		var p client.FormatParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, powershift.NewError(powershift.ErrInvalidOption, "parse", "params", err, "")
+		}
+		f, err := d.formatter(p)
+		if err != nil {
+			return nil, err
+		}
+		out, stats, err := f.String(p.Text)
+		if err != nil {
+			return nil, err
+		}
+		return client.FormatResult{Text: out, Matches: stats.Matches, Replaced: stats.Replaced}, nil
+	case "stats":
+		d.mu.Lock()
+		projects := len(d.formatters)
+		d.mu.Unlock()
+		cs := d.cache.Stats()
+		return client.Stats{Formatters: projects, CacheEntries: cs.Entries, CacheHits: cs.Hits, CacheMisses: cs.Misses}, nil
+	case "shutdown":
+		return map[string]bool{"ok": true}, nil
+	}
+	return nil, powershift.Errorf(powershift.ErrInvalidOption, "call", req.Method,
+		"known methods are format, ping, stats and shutdown", "unknown method")
+}
+
+// formatter returns the warm Formatter for the project of p.Path, building it
+// from the project's config file on first use or after the file changed.
+func (d *daemon) formatter(p client.FormatParams) (*powershift.Formatter, error) {
+	key := projectKey{}
+	if p.Path != "" {
+		if config, ok := findProjectConfig(filepath.Dir(p.Path)); ok {
+			info, err := os.Stat(config)
+			if err != nil {
+				return nil, readError(config, err)
+			}
+			key.config, key.modTime = config, info.ModTime()
+		}
+	}
+
+	// The extension picks the language unless the config or flags name one
+	key.lang = languageForPath(p.Path, "")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if f, ok := d.formatters[key]; ok {
+		return f, nil
+	}
+
+	var values []configValue
+	if key.config != "" {
+		var err error
+		if values, err = loadConfig(key.config); err != nil {
+			return nil, err
+		}
+	}
+	cli, err := flagsWith(d.flags, values)
+	if err != nil {
+		return nil, err
+	}
+	if key.lang != "" {
+		cli.lang = languageFor(p.Path, cli.lang)
+	}
+	f, err := powershift.New(append(cli.formatterOptions(), powershift.WithCache(d.cache))...)
+	if err != nil {
+		return nil, err
+	}
+	for k := range d.formatters {
+		if k.config == key.config && k.modTime != key.modTime {
+			delete(d.formatters, k) // Built from an older version of the config
+		}
+	}
+	d.formatters[key] = f
+	return f, nil
+}
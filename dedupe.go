@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// duplicates groups the inputs of a batch that have the same content, such as
+// vendored copies of a file, so that each content is formatted only once.
+type duplicates struct {
+	groups map[string]*dupGroup // By the path of every member
+}
+
+// dupGroup is a set of identical inputs. The first of them in input order is
+// formatted, and the others wait for its result.
+type dupGroup struct {
+	hash  [sha256.Size]byte
+	first string
+	once  sync.Once
+	ready chan struct{} // Closed when the first is done, with or without a result
+	res   *formatted
+}
+
+// formatted is the result of formatting one content in full.
+type formatted struct {
+	output  []byte
+	stats   powershift.Stats
+	edits   []powershift.Edit
+	results []powershift.Result
+}
+
+// findDuplicates hashes the inputs that share their size with another and
+// groups those with the same content. It returns nil if there are none.
+// Inputs that cannot be read are left to fail when they are processed.
+func findDuplicates(paths []string) *duplicates {
+	bySize := map[int64][]string{}
+	for _, path := range paths {
+		if path == stdinPath {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+			bySize[info.Size()] = append(bySize[info.Size()], path)
+		}
+	}
+	d := &duplicates{groups: map[string]*dupGroup{}}
+	for _, same := range bySize {
+		if len(same) < 2 {
+			continue
+		}
+		byHash := map[[sha256.Size]byte]*dupGroup{}
+		for _, path := range same {
+			hash, err := hashFile(path)
+			if err != nil {
+				continue
+			}
+			g := byHash[hash]
+			if g == nil {
+				g = &dupGroup{hash: hash, first: path, ready: make(chan struct{})}
+				byHash[hash] = g
+				continue
+			}
+			d.groups[g.first] = g
+			d.groups[path] = g
+		}
+	}
+	if len(d.groups) == 0 {
+		return nil
+	}
+	return d
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	acquireFile()
+	defer releaseFile()
+	var hash [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return hash, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return hash, err
+	}
+	h.Sum(hash[:0])
+	return hash, nil
+}
+
+// group returns the group of the input path if data, its content, is still
+// what was hashed.
+func (d *duplicates) group(path string, data []byte) *dupGroup {
+	if d == nil {
+		return nil
+	}
+	g := d.groups[path]
+	if g == nil || sha256.Sum256(data) != g.hash {
+		return nil
+	}
+	return g
+}
+
+// done marks the input path as processed, so that the members of its group
+// stop waiting for it even if it failed.
+func (d *duplicates) done(path string) {
+	if d == nil {
+		return
+	}
+	if g := d.groups[path]; g != nil && g.first == path {
+		g.publish(nil)
+	}
+}
+
+// wait returns the result of the first member for the input path, or nil if
+// path is the first or the first was not formatted.
+func (g *dupGroup) wait(path string) *formatted {
+	if path == g.first {
+		return nil
+	}
+	<-g.ready
+	return g.res
+}
+
+// publish hands the result of the first member to the others.
+func (g *dupGroup) publish(res *formatted) {
+	g.once.Do(func() {
+		g.res = res
+		close(g.ready)
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// diffContext is the number of unchanged lines around each hunk, as in diff -u.
+const diffContext = 3
+
+// diffOp is one line of an edit script: kept, deleted from a or inserted
+// from b.
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line []byte
+}
+
+// writeDiff writes a unified diff from a to b, the content of path before and
+// after formatting, in the form patch -p1 and git apply accept. Nothing is
+// written if they are equal.
+func writeDiff(w io.Writer, path string, a, b []byte) error {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", path, path)
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk, which runs on while
+		// changes are closer than twice the context
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		end, kept := first, 0
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end, kept = i+1, 0
+			} else if kept++; kept > 2*diffContext {
+				break
+			}
+		}
+		from := max(first-diffContext, start)
+		to := min(end+diffContext, len(ops))
+		writeHunk(&buf, ops, from, to)
+		start = to
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeHunk writes ops[from:to] as one hunk.
+func writeHunk(buf *bytes.Buffer, ops []diffOp, from, to int) {
+	aLine, bLine := 1, 1
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			aLine++
+		}
+		if op.kind != '-' {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			aCount++
+		}
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+	for _, op := range ops[from:to] {
+		buf.WriteByte(op.kind)
+		buf.Write(op.line)
+		if !bytes.HasSuffix(op.line, []byte("\n")) {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side starts at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits data after every newline.
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+// diffLines returns an edit script from a to b. Formatting rewrites lines
+// without adding or removing any, so when both have as many lines they are
+// compared pairwise; otherwise a shortest script is found with Myers'
+// algorithm.
+func diffLines(a, b [][]byte) []diffOp {
+	var ops []diffOp
+	if len(a) == len(b) {
+		for i := range a {
+			if bytes.Equal(a[i], b[i]) {
+				ops = append(ops, diffOp{' ', a[i]})
+			} else {
+				ops = append(ops, diffOp{'-', a[i]}, diffOp{'+', b[i]})
+			}
+		}
+		return groupChanges(ops)
+	}
+	return groupChanges(myers(a, b))
+}
+
+// groupChanges moves the deletions of every run of changes before its
+// insertions, as diff -u prints them.
+func groupChanges(ops []diffOp) []diffOp {
+	for i := 0; i < len(ops); i++ {
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		slices.SortStableFunc(ops[i:j], func(x, y diffOp) int {
+			return cmp.Compare(changeRank(x.kind), changeRank(y.kind))
+		})
+		i = j
+	}
+	return ops
+}
+
+func changeRank(kind byte) int {
+	if kind == '-' {
+		return 0
+	}
+	return 1
+}
+
+// myers returns a shortest edit script from a to b. It keeps the furthest
+// points of every round to walk back from the end, which takes memory for
+// the square of the number of changes.
+func myers(a, b [][]byte) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int // The points of the round before each round, from diagonal -d on
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1] // Down: an insertion
+			} else {
+				x = v[offset+k-1] + 1 // Right: a deletion
+			}
+			y := x - k
+			for x < n && y < m && bytes.Equal(a[x], b[y]) {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack recovers the edit script of myers, which finished in round d.
+func backtrack(a, b [][]byte, trace [][]int, d int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 {
+		x--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	slices.Reverse(ops)
+	return ops
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "io/fs"
+
+// freeSpace reports false: free space is not checked on this platform.
+func freeSpace(dir string) (uint64, bool) {
+	return 0, false
+}
+
+// deviceOf returns 0: every file counts as being on the same filesystem.
+func deviceOf(info fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// docUnit is a piece of text extracted from a document, with its location.
+type docUnit struct {
+	Kind string // "page" or "paragraph"
+	N    int    // 1-based page or paragraph number
+	Text string
+}
+
+// documentKind returns the extractor for a document format that can only be
+// analyzed, or nil for ordinary text files.
+func documentKind(path string) func([]byte) ([]docUnit, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return extractPDF
+	case ".docx":
+		return extractDocx
+	}
+	return nil
+}
+
+// extractDocx returns the paragraphs of the main part of a Word document.
+func extractDocx(data []byte) ([]docUnit, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return docxParagraphs(rc)
+	}
+	return nil, errors.New("word/document.xml not found; not a Word document")
+}
+
+func docxParagraphs(r io.Reader) ([]docUnit, error) {
+	const ns = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	dec := xml.NewDecoder(r)
+	var units []docUnit
+	var text strings.Builder
+	inText, n := false, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return units, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != ns {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				n++
+				text.Reset()
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Space != ns {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if text.Len() > 0 {
+					units = append(units, docUnit{Kind: "paragraph", N: n, Text: text.String()})
+				}
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+// pdfObject is an object of a PDF file: its dictionary (or other value) as
+// source text, and its decoded stream, if any.
+type pdfObject struct {
+	dict   string
+	stream []byte
+}
+
+var (
+	pdfObjPattern  = regexp.MustCompile(`(?s)(\d+)\s+\d+\s+obj\b(.*?)\bendobj`)
+	pdfRefPattern  = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfRootPattern = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+)
+
+// extractPDF returns the text of every page of a PDF file. Only what PDF
+// readers would need no font program for is recovered: strings shown with
+// the text operators in (possibly Flate-compressed) content streams. Text in
+// fonts with custom encodings, typically CID fonts, comes out garbled or not
+// at all; such documents need a full PDF library.
+func extractPDF(data []byte) ([]docUnit, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	objects := map[int]pdfObject{}
+	for _, m := range pdfObjPattern.FindAllSubmatch(data, -1) {
+		num, _ := strconv.Atoi(string(m[1]))
+		objects[num] = parsePDFObject(m[2])
+	}
+	// PDF 1.5 files keep most objects inside compressed object streams
+	for _, obj := range objects {
+		if strings.Contains(obj.dict, "/ObjStm") {
+			expandObjectStream(obj, objects)
+		}
+	}
+
+	var root int
+	for _, obj := range objects {
+		if m := pdfRootPattern.FindStringSubmatch(obj.dict); m != nil {
+			root, _ = strconv.Atoi(m[1])
+		}
+	}
+	if root == 0 {
+		// Classic files name the root in the trailer, outside any object
+		if m := pdfRootPattern.FindSubmatch(data); m != nil {
+			root, _ = strconv.Atoi(string(m[1]))
+		}
+	}
+	catalog, ok := objects[root]
+	if !ok {
+		return nil, errors.New("document catalog not found")
+	}
+	pages, ok := refAfter(catalog.dict, "/Pages")
+	if !ok {
+		return nil, errors.New("page tree not found")
+	}
+
+	var units []docUnit
+	visited := map[int]bool{} // A malformed tree may list a node more than once, or in a cycle
+	var walk func(num, depth int)
+	walk = func(num, depth int) {
+		obj, ok := objects[num]
+		if !ok || depth > 64 || visited[num] {
+			return
+		}
+		visited[num] = true
+		if kids, ok := arrayAfter(obj.dict, "/Kids"); ok {
+			for _, kid := range pdfRefPattern.FindAllStringSubmatch(kids, -1) {
+				n, _ := strconv.Atoi(kid[1])
+				walk(n, depth+1)
+			}
+			return
+		}
+		var text strings.Builder
+		for _, c := range pageContents(obj.dict) {
+			text.WriteString(pdfText(objects[c].stream))
+		}
+		units = append(units, docUnit{Kind: "page", N: len(units) + 1, Text: text.String()})
+	}
+	walk(pages, 0)
+	return units, nil
+}
+
+func parsePDFObject(body []byte) pdfObject {
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return pdfObject{dict: string(body)}
+	}
+	obj := pdfObject{dict: string(body[:i])}
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+	if j := bytes.LastIndex(raw, []byte("endstream")); j >= 0 {
+		raw = raw[:j]
+	}
+	obj.stream = raw
+	if strings.Contains(obj.dict, "/FlateDecode") {
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			// A stream cut short by trailing EOL bytes still inflates up to the error
+			obj.stream, _ = io.ReadAll(zr)
+		}
+	}
+	return obj
+}
+
+// expandObjectStream adds the objects stored in an object stream.
+func expandObjectStream(objStm pdfObject, objects map[int]pdfObject) {
+	n := intAfter(objStm.dict, "/N")
+	first := intAfter(objStm.dict, "/First")
+	if first <= 0 || first > len(objStm.stream) {
+		return
+	}
+	header := strings.Fields(string(objStm.stream[:first]))
+	for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+		num, _ := strconv.Atoi(header[i])
+		start, _ := strconv.Atoi(header[i+1])
+		end := len(objStm.stream) - first
+		if i+3 < len(header) {
+			end, _ = strconv.Atoi(header[i+3])
+		}
+		if start < 0 || start > end || first+end > len(objStm.stream) {
+			continue
+		}
+		if _, ok := objects[num]; !ok {
+			objects[num] = pdfObject{dict: string(objStm.stream[first+start : first+end])}
+		}
+	}
+}
+
+func pageContents(dict string) []int {
+	var refs []int
+	if arr, ok := arrayAfter(dict, "/Contents"); ok {
+		for _, m := range pdfRefPattern.FindAllStringSubmatch(arr, -1) {
+			n, _ := strconv.Atoi(m[1])
+			refs = append(refs, n)
+		}
+	} else if n, ok := refAfter(dict, "/Contents"); ok {
+		refs = append(refs, n)
+	}
+	return refs
+}
+
+func refAfter(dict, key string) (int, bool) {
+	m := regexp.MustCompile(regexp.QuoteMeta(key) + `\s+(\d+)\s+\d+\s+R`).FindStringSubmatch(dict)
+	if m == nil {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n, true
+}
+
+func arrayAfter(dict, key string) (string, bool) {
+	m := regexp.MustCompile(`(?s)` + regexp.QuoteMeta(key) + `\s*\[(.*?)\]`).FindStringSubmatch(dict)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+func intAfter(dict, key string) int {
+	m := regexp.MustCompile(regexp.QuoteMeta(key) + `\s+(\d+)\b`).FindStringSubmatch(dict)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// pdfText returns the strings a content stream shows, with a line break for
+// every operator that moves to a new line.
+func pdfText(content []byte) string {
+	var out strings.Builder
+	var operands []string // Strings since the last operator
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteralString(content[i:])
+			operands = append(operands, s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			j := bytes.IndexByte(content[i:], '>')
+			if j < 0 {
+				return out.String()
+			}
+			digits := strings.Join(strings.Fields(string(content[i+1:i+j])), "")
+			if len(digits)%2 == 1 {
+				digits += "0"
+			}
+			b, _ := hex.DecodeString(digits)
+			operands = append(operands, string(b))
+			i += j + 1
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			j := i
+			for j < len(content) && isPDFRegular(content[j]) {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "Tj", "TJ":
+				out.WriteString(strings.Join(operands, ""))
+			case "Td", "TD", "T*", "ET":
+				out.WriteString("\n")
+			}
+			if j > i && !isPDFNumber(content[i:j]) {
+				operands = operands[:0]
+			}
+			i = j
+		default:
+			if c == '\'' || c == '"' {
+				// Move to the next line and show a string
+				out.WriteString("\n" + strings.Join(operands, ""))
+				operands = operands[:0]
+			}
+			i++
+		}
+	}
+	return collapseBlankLines(out.String())
+}
+
+// pdfLiteralString decodes a (string) at the start of b and returns it along
+// with the number of bytes it took up.
+func pdfLiteralString(b []byte) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; c {
+		case '(':
+			if depth > 0 {
+				sb.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			sb.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(b) {
+				return sb.String(), i
+			}
+			switch e := b[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if '0' <= e && e <= '7' {
+					v, j := 0, i
+					for ; j < len(b) && j < i+3 && '0' <= b[j] && b[j] <= '7'; j++ {
+						v = v*8 + int(b[j]-'0')
+					}
+					sb.WriteByte(byte(v))
+					i = j - 1
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), len(b)
+}
+
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return c != '\'' && c != '"'
+}
+
+func isPDFNumber(tok []byte) bool {
+	_, err := strconv.ParseFloat(string(tok), 64)
+	return err == nil
+}
+
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			kept = append(kept, l)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// documentHint is the hint shown when a document is passed to the
+// rewriting modes.
+func documentHint(path string) string {
+	return fmt.Sprintf("%s files are analyzed, never rewritten; run \"PowerShiftFormatter analyze %s\"",
+		strings.ToUpper(strings.TrimPrefix(filepath.Ext(path), ".")), path)
+}
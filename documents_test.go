@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractPDFPageTreeCycle(t *testing.T) {
+	// The root lists its own node and page 4 twice, and node 5 lists the root
+	// and itself: every node must be visited once
+	pdf := strings.Join([]string{
+		"%PDF-1.4",
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj",
+		"2 0 obj << /Type /Pages /Kids [4 0 R 2 0 R 5 0 R 4 0 R] >> endobj",
+		"3 0 obj << /Length 27 >> stream\nBT (size 1048576) Tj ET\nendstream endobj",
+		"4 0 obj << /Type /Page /Contents 3 0 R >> endobj",
+		"5 0 obj << /Type /Pages /Kids [2 0 R 5 0 R 6 0 R] >> endobj",
+		"6 0 obj << /Type /Page /Contents 7 0 R >> endobj",
+		"7 0 obj << /Length 24 >> stream\nBT (mask 65535) Tj ET\nendstream endobj",
+		"trailer << /Root 1 0 R >>",
+		"%%EOF",
+	}, "\n")
+	units, err := extractPDF([]byte(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, u := range units {
+		texts = append(texts, strings.TrimSpace(u.Text))
+	}
+	if got, want := strings.Join(texts, "|"), "size 1048576|mask 65535"; got != want {
+		t.Errorf("pages are %q, want %q", got, want)
+	}
+}
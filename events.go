@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// Kinds of -events records.
+const (
+	eventFileStart = "file-start"
+	eventMatch     = "match"     // A number was found
+	eventReplace   = "replace"   // The number just matched was rewritten
+	eventSkip      = "skip"      // A file was left alone without being formatted
+	eventFileDone  = "file-done" // A file was formatted, or failed with error
+)
+
+// event is one line of the -events stream.
+type event struct {
+	Event      string `json:"event"`
+	File       string `json:"file"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Original   string `json:"original,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Matches    *int   `json:"matches,omitempty"`
+	Replaced   *int   `json:"replaced,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// eventStream writes -events records as NDJSON while a run progresses. It is
+// shared by all workers, and nil when -events is not given.
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false) // Keep the "<<" of expressions readable
+	return &eventStream{enc: enc}
+}
+
+func (s *eventStream) emit(e event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(e)
+}
+
+// results emits a match event for every result of file, followed by a replace
+// event for those that were rewritten.
+func (s *eventStream) results(file string, results []powershift.Result) {
+	if s == nil {
+		return
+	}
+	for _, r := range results {
+		s.emit(event{Event: eventMatch, File: file, Line: r.Line, Column: r.Column, Original: r.Text})
+		if r.Replaced {
+			s.emit(event{Event: eventReplace, File: file, Line: r.Line, Column: r.Column, Original: r.Text, Expression: r.Output})
+		}
+	}
+}
+
+// fileDone emits the event that ends the records of file.
+func (s *eventStream) fileDone(file string, res fileResult) {
+	switch {
+	case s == nil:
+	case res.err != nil:
+		s.emit(event{Event: eventFileDone, File: file, Error: res.err.Error()})
+	case res.skipped:
+		s.emit(event{Event: eventSkip, File: file})
+	default:
+		s.emit(event{Event: eventFileDone, File: file, Matches: &res.totals.Matches, Replaced: &res.totals.Replaced})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// example is a task-oriented invocation shown in usage messages. Every
+// example can be run by "examples -run", and go test runs them all, which
+// checks that each still behaves as documented.
+type example struct {
+	task   string
+	args   []string          // Command-line arguments, after the program name
+	stdin  string            // Piped into the command when not empty
+	files  map[string]string // Created in an empty working directory first
+	stdout string            // Expected output
+	fails  bool              // The command is expected to exit with status 1
+	after  map[string]string // Expected contents of files afterwards
+}
+
+var examples = []example{
+	{
+		task:   "Rewrite a file to stdout",
+		args:   []string{"-i", "limits.h"},
+		files:  map[string]string{"limits.h": "#define MAX_BUF 1048576\n"},
+		stdout: "#define MAX_BUF 1 << 20\n",
+	},
+	{
+		task:  "Write the result to another file",
+		args:  []string{"-i", "limits.h", "-o", "limits.out.h"},
+		files: map[string]string{"limits.h": "#define MAX_BUF 1048576\n"},
+		after: map[string]string{"limits.out.h": "#define MAX_BUF 1 << 20\n"},
+	},
+	{
+		task:   "Review the changes as a diff",
+		args:   []string{"-d", "limits.h"},
+		files:  map[string]string{"limits.h": "#define MAX_BUF 1048576\n"},
+		stdout: "--- a/limits.h\n+++ b/limits.h\n@@ -1 +1 @@\n-#define MAX_BUF 1048576\n+#define MAX_BUF 1 << 20\n",
+	},
+	{
+		task:   "Fail a CI job while any number is left to rewrite",
+		args:   []string{"-check", "src"},
+		files:  map[string]string{"src/limits.h": "#define MAX_BUF 1048576\n", "src/ok.h": "#define MAX_BUF 1 << 20\n"},
+		stdout: "src/limits.h:1:17: 1048576 -> 1 << 20\n",
+		fails:  true,
+	},
+	{
+		task:   "List the files that would change",
+		args:   []string{"-l", "src"},
+		files:  map[string]string{"src/limits.h": "#define MAX_BUF 1048576\n", "src/ok.h": "#define MAX_BUF 1 << 20\n"},
+		stdout: "src/limits.h\n",
+	},
+	{
+		task: "Rewrite several files in place",
+		args: []string{"-w", "-lang", "c", "limits.h", "masks.h"},
+		files: map[string]string{
+			"limits.h": "#define MAX_BUF 1048576\n",
+			"masks.h":  "#define LOW_MASK 65535\n",
+		},
+		after: map[string]string{
+			"limits.h": "#define MAX_BUF 1 << 20\n",
+			"masks.h":  "#define LOW_MASK (1<<16) - 1\n",
+		},
+	},
+	{
+		task:   "Filter stdin, as in a pipe or a vim ! command",
+		stdin:  "size = 1048576\n",
+		stdout: "size = 1 << 20\n",
+	},
+	{
+		task:   "Keep the original value in a comment",
+		args:   []string{"-emit", "both", "-lang", "c", "-i", "-"},
+		stdin:  "size = 1048576;\n",
+		stdout: "size = (1 << 20 /* 1048576 */);\n",
+	},
+	{
+		task:   "Check a tree in CI for values written in more than one way",
+		args:   []string{"consistency", "src"},
+		files:  map[string]string{"src/a.c": "int a = 1<<20;\n", "src/b.c": "int b = 1048576;\n"},
+		stdout: "src/b.c:1:9: 1048576 is written 1048576 here and 1<<20 in 1 of 2 uses\n",
+		fails:  true,
+	},
+	{
+		task:   "Undo an earlier run",
+		args:   []string{"-reverse", "-i", "-"},
+		stdin:  "size = 1<<20\n",
+		stdout: "size = 1048576\n",
+	},
+	{
+		task:   "Decode expressions written in math notation",
+		args:   []string{"decode", "-i", "-"},
+		stdin:  "mask = (2^13 - 1) << 4\n",
+		stdout: "mask = 131056\n",
+	},
+}
+
+// command returns the shell command an example stands for.
+func (e example) command() string {
+	var sb strings.Builder
+	if e.stdin != "" {
+		fmt.Fprintf(&sb, "echo %s | ", shellQuote(strings.TrimSuffix(e.stdin, "\n")))
+	}
+	sb.WriteString("PowerShiftFormatter")
+	for _, arg := range e.args {
+		sb.WriteString(" " + shellQuote(arg))
+	}
+	return sb.String()
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`|&;<>()*?[]#~{}!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// printExamples writes the examples to w, or only those using flag if it is
+// not empty.
+func printExamples(w io.Writer, flag string) {
+	header := false
+	for _, e := range examples {
+		if flag != "" && !slices.Contains(e.args, flag) {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, "Examples:")
+			header = true
+		}
+		fmt.Fprintf(w, "  %s:\n    %s\n", e.task, e.command())
+	}
+}
+
+// printExamplesFor writes the examples that use the option err is about, if
+// err is an invalid combination of options.
+func printExamplesFor(w io.Writer, err error) {
+	var e *powershift.Error
+	if errors.As(err, &e) && errors.Is(e.Kind, powershift.ErrInvalidOption) && strings.HasPrefix(e.Path, "-") {
+		printExamples(w, e.Path)
+	}
+}
+
+// runExamples implements the "examples" subcommand: it prints the examples,
+// and with -run executes each of them in a scratch directory and fails if any
+// no longer does what it shows.
+func runExamples(args []string) error {
+	fs := flag.NewFlagSet("examples", flag.ContinueOnError)
+	run := fs.Bool("run", false, "Run every example and check its output and the files it writes")
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "examples", err, "")
+	}
+	if !*run {
+		printExamples(os.Stdout, "")
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, e := range examples {
+		if err := e.run(self); err != nil {
+			fmt.Printf("FAIL %s: %v\n", e.task, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", e.task)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, len(examples))
+	}
+	return nil
+}
+
+// run executes the example with the binary at self.
+func (e example) run(self string) error {
+	dir, err := os.MkdirTemp("", "powershift-example-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range e.files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(self, e.args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(e.stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err != nil && !errors.As(err, &exit):
+		return err
+	case e.fails && err == nil:
+		return errors.New("expected the command to fail")
+	case !e.fails && err != nil:
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if got := stdout.String(); got != e.stdout {
+		return fmt.Errorf("stdout is %q, want %q", got, e.stdout)
+	}
+	for name, want := range e.after {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if string(got) != want {
+			return fmt.Errorf("%s holds %q, want %q", name, got, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestExamples builds the command and runs every entry of examples with it,
+// as "examples -run" does, so that go test catches an example that no longer
+// behaves as the usage messages show.
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the command")
+	}
+	bin := filepath.Join(t.TempDir(), "PowerShiftFormatter")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	for _, e := range examples {
+		t.Run(e.task, func(t *testing.T) {
+			if err := e.run(bin); err != nil {
+				t.Errorf("%s: %v", e.command(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// cliFlags holds the values of the main command-line flags.
+type cliFlags struct {
+	inputFile        string
+	outputFile       string
+	threshold        bigIntFlag
+	maxMemory        string
+	emit             string
+	lang             string
+	version          bool
+	capabilities     bool
+	json             bool
+	configFile       string
+	editsFile        string
+	write            bool
+	stateFile        string
+	resume           bool
+	writeStrategy    string
+	breakLinks       bool
+	preserveLinks    bool
+	skipSecrets      bool
+	reportFormat     string
+	reportFile       string
+	reportTemplate   string
+	redactContext    bool
+	ranges           bool
+	annotateRanges   bool
+	skipArithmetic   bool
+	clipboard        bool
+	cacheFile        string
+	continuations    bool
+	summaryJSON      bool
+	ifChanged        bool
+	tiers            tiersFlag
+	reportBits       bool
+	reportSuspicious bool
+	tag              bool
+	reverse          bool
+	onlyTagged       bool
+	anyNotation      bool // Set by decode, which reads every -expr-style
+	jobs             int
+	printFilename    bool
+	header           string
+	footer           string
+	minSavings       ratioFlag
+	maxGrowth        ratioFlag
+	shiftedNeighbors bool
+	stream           bool
+	boundary         boundaryFlag
+	glueBefore       regexpFlag
+	glueAfter        regexpFlag
+	maxReplacements  int
+	sample           ratioFlag
+	include          patternsFlag
+	exclude          patternsFlag
+	perLine          string
+	maxOpenFiles     int
+	diff             bool
+	check            bool
+	list             bool
+	fold             bool
+	pattern          string
+	noConfig         bool
+	forms            formsFlag
+	matchTimeout     time.Duration
+	events           bool
+	intType          string
+	ceiling          bigIntFlag
+	minDigits        int
+	namedConstants   bool
+	generate         bool
+	exprStyle        string
+	exprTemplate     string
+	preflight        bool
+	maxTerms         int
+	maxMultiplier    int
+	scoring          string
+	formWeights      weightsFlag
+	approx           ratioFlag
+	approxMode       string
+	failOn           string
+	severities       severitiesFlag
+	scientific       bool
+	words            bool
+}
+
+// tiersFlag is the value of -tiers, parsed when it is set.
+type tiersFlag struct {
+	spec  string
+	tiers []powershift.Tier
+}
+
+func (t *tiersFlag) String() string { return t.spec }
+
+func (t *tiersFlag) Set(s string) error {
+	tiers, err := powershift.ParseTiers(s)
+	if err != nil {
+		return err
+	}
+	t.spec, t.tiers = s, tiers
+	return nil
+}
+
+// ratioFlag is the value of -min-savings or -max-growth, a fraction of the
+// literal's length.
+type ratioFlag struct {
+	spec  string
+	value float64
+	set   bool
+}
+
+func (r *ratioFlag) String() string { return r.spec }
+
+func (r *ratioFlag) Set(s string) error {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("expected a fraction such as 0.2 or a percentage such as 20%%, got %q", s)
+	}
+	if strings.HasSuffix(s, "%") {
+		v /= 100
+	}
+	r.spec, r.value, r.set = s, v, true
+	return nil
+}
+
+// maxLengthRatio returns the ratio -min-savings or -max-growth allows, or 0
+// if neither is set.
+func (c *cliFlags) maxLengthRatio() float64 {
+	switch {
+	case c.minSavings.set:
+		return 1 - c.minSavings.value
+	case c.maxGrowth.set:
+		return 1 + c.maxGrowth.value
+	}
+	return 0
+}
+
+// bigIntFlag is the value of -t and -max. Unlike an int64 it holds bounds
+// above 2^63, such as those of files of cryptographic constants.
+type bigIntFlag struct {
+	v *big.Int
+}
+
+func (b *bigIntFlag) String() string {
+	if b.v == nil {
+		return ""
+	}
+	return b.v.String()
+}
+
+func (b *bigIntFlag) Set(s string) error {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return fmt.Errorf("expected a decimal integer, got %q", s)
+	}
+	b.v = v
+	return nil
+}
+
+// formsFlag is the value of -forms.
+type formsFlag []powershift.Form
+
+func (f *formsFlag) String() string {
+	names := make([]string, len(*f))
+	for i, form := range *f {
+		names[i] = string(form)
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *formsFlag) Set(s string) error {
+	forms := formsFlag{}
+	for _, name := range strings.Split(s, ",") {
+		form, err := powershift.ParseForm(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		forms = append(forms, form)
+	}
+	*f = forms
+	return nil
+}
+
+// weightsFlag is the value of -form-weights.
+type weightsFlag map[powershift.Form]int
+
+func (w weightsFlag) String() string {
+	entries := make([]string, 0, len(w))
+	for form, n := range w {
+		entries = append(entries, fmt.Sprintf("%s=%d", form, n))
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ",")
+}
+
+func (w *weightsFlag) Set(s string) error {
+	weights := weightsFlag{}
+	for _, entry := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil {
+			return powershift.Errorf(powershift.ErrInvalidOption, "parse", "-form-weights", "write FORM=N, e.g. plus-one=2",
+				"bad weight %q", entry)
+		}
+		form, err := powershift.ParseForm(name)
+		if err != nil {
+			return err
+		}
+		weights[form] = n
+	}
+	*w = weights
+	return nil
+}
+
+// Boundaries selectable with -boundary, the rules that decide whether a digit
+// run is glued to its neighbours.
+const (
+	boundaryLetters    = "letters"    // ASCII letters and digits glue (the default)
+	boundaryWord       = "word"       // Letters in any script, digits and underscores glue
+	boundaryWhitespace = "whitespace" // Anything but whitespace glues
+	boundaryCustom     = "custom"     // -glue-before and -glue-after decide
+)
+
+var boundaries = []string{boundaryLetters, boundaryWord, boundaryWhitespace, boundaryCustom}
+
+// boundaryFlag is the value of -boundary.
+type boundaryFlag string
+
+func (b *boundaryFlag) String() string { return string(*b) }
+
+func (b *boundaryFlag) Set(s string) error {
+	if !slices.Contains(boundaries, s) {
+		return fmt.Errorf("%q is not one of %s", s, strings.Join(boundaries, ", "))
+	}
+	*b = boundaryFlag(s)
+	return nil
+}
+
+// regexpFlag is the value of -glue-before or -glue-after.
+type regexpFlag struct {
+	re *regexp.Regexp
+}
+
+func (r *regexpFlag) String() string {
+	if r.re == nil {
+		return ""
+	}
+	return r.re.String()
+}
+
+func (r *regexpFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// adjacency returns the rule -boundary selects, or nil for the default.
+func (c *cliFlags) adjacency() powershift.AdjacencyFunc {
+	switch c.boundary {
+	case boundaryWord:
+		return powershift.WordAdjacent
+	case boundaryWhitespace:
+		return powershift.WhitespaceAdjacent
+	case boundaryCustom:
+		return powershift.PatternAdjacent(c.glueBefore.re, c.glueAfter.re)
+	}
+	return nil
+}
+
+// How -w treats files with more than one hard link.
+const (
+	linksWarn     = ""         // Warn and skip the file
+	linksBreak    = "break"    // Rewrite anyway, detaching the other links
+	linksPreserve = "preserve" // Rewrite through the copy strategy so all links see the change
+)
+
+func (c *cliFlags) links() string {
+	switch {
+	case c.breakLinks:
+		return linksBreak
+	case c.preserveLinks:
+		return linksPreserve
+	}
+	return linksWarn
+}
+
+// formatterOptions returns the Formatter options selected by the flags that
+// every mode shares.
+func (c *cliFlags) formatterOptions() []powershift.Option {
+	opts := []powershift.Option{
+		powershift.WithThreshold(c.threshold.v),
+		powershift.WithEmit(powershift.Emit(c.emit)),
+		powershift.WithLanguage(c.lang),
+	}
+	if c.ranges || c.annotateRanges {
+		opts = append(opts, powershift.WithRanges(c.annotateRanges))
+	}
+	if c.skipArithmetic {
+		opts = append(opts, powershift.WithSkipArithmetic())
+	}
+	if c.fold {
+		opts = append(opts, powershift.WithFolding())
+	}
+	if c.continuations {
+		opts = append(opts, powershift.WithContinuations())
+	}
+	if c.pattern != "" {
+		opts = append(opts, powershift.WithPattern(c.pattern), powershift.WithMatchTimeout(c.matchTimeout))
+	}
+	if len(c.forms) > 0 {
+		opts = append(opts, powershift.WithForms(c.forms...))
+	}
+	if c.scoring != string(powershift.ScoreFirst) {
+		opts = append(opts, powershift.WithScoring(powershift.Scoring(c.scoring)))
+	}
+	if c.formWeights != nil {
+		opts = append(opts, powershift.WithFormWeights(c.formWeights))
+	}
+	if c.approx.set {
+		opts = append(opts, powershift.WithApproximation(c.approx.value, powershift.ApproxMode(c.approxMode)))
+	}
+	if c.maxMultiplier != powershift.DefaultMaxMultiplier {
+		opts = append(opts, powershift.WithMaxMultiplier(c.maxMultiplier))
+	}
+	if c.maxTerms != powershift.DefaultMaxTerms {
+		opts = append(opts, powershift.WithMaxTerms(c.maxTerms))
+	}
+	if c.minDigits != powershift.DefaultMinDigits {
+		opts = append(opts, powershift.WithMinDigits(c.minDigits))
+	}
+	if c.ceiling.v != nil {
+		opts = append(opts, powershift.WithCeiling(c.ceiling.v))
+	}
+	if c.exprStyle != string(powershift.ExprShift) {
+		opts = append(opts, powershift.WithExprStyle(powershift.ExprStyle(c.exprStyle)))
+	}
+	if c.exprTemplate != "" {
+		opts = append(opts, powershift.WithExprTemplate(c.exprTemplate))
+	}
+	if c.namedConstants {
+		opts = append(opts, powershift.WithNamedConstants())
+	}
+	if c.intType != "" {
+		opts = append(opts, powershift.WithIntType(c.intType))
+	}
+	if c.tiers.tiers != nil {
+		opts = append(opts, powershift.WithTiers(c.tiers.tiers...))
+	}
+	if c.tag {
+		opts = append(opts, powershift.WithTag(powershift.DefaultTag))
+	}
+	if c.reverse {
+		opts = append(opts, powershift.WithReverse(c.onlyTagged))
+		if c.anyNotation {
+			opts = append(opts, powershift.WithAnyNotation())
+		}
+	}
+	if c.words {
+		opts = append(opts, powershift.WithLiteralParser(powershift.RomanParser()), powershift.WithLiteralParser(powershift.WordsParser()))
+	}
+	if c.scientific {
+		opts = append(opts, powershift.WithLiteralParser(powershift.ScientificParser()))
+	}
+	if c.shiftedNeighbors {
+		opts = append(opts, powershift.WithShiftedNeighbors())
+	}
+	if r := c.maxLengthRatio(); r != 0 {
+		opts = append(opts, powershift.WithMaxLengthRatio(r))
+	}
+	if c.maxReplacements > 0 {
+		opts = append(opts, powershift.WithMaxReplacements(c.maxReplacements))
+	}
+	if c.sample.set {
+		opts = append(opts, powershift.WithSample(c.sample.value))
+	}
+	if c.perLine != string(powershift.PerLineAll) {
+		opts = append(opts, powershift.WithPerLine(powershift.PerLine(c.perLine)))
+	}
+	if fn := c.adjacency(); fn != nil {
+		opts = append(opts, powershift.WithAdjacency(fn))
+	}
+	return opts
+}
+
+// longFlags are the GNU-style names of the single-letter flags. Both forms
+// set the same value, and configs know them by the single-letter name.
+var longFlags = []struct{ long, short string }{
+	{"input", "i"},
+	{"output", "o"},
+	{"threshold", "t"},
+	{"write", "w"},
+}
+
+// defineLongFlags registers the long names of the single-letter flags on fs,
+// moving the description to the long name.
+func defineLongFlags(fs *flag.FlagSet) {
+	for _, l := range longFlags {
+		f := fs.Lookup(l.short)
+		fs.Var(f.Value, l.long, f.Usage)
+		f.Usage = "Short for --" + l.long
+	}
+}
+
+// canonicalFlag returns the single-letter name of a long flag, or name itself.
+func canonicalFlag(name string) string {
+	for _, l := range longFlags {
+		if l.long == name {
+			return l.short
+		}
+	}
+	return name
+}
+
+// defineFlags registers the main flags on fs. It is shared by the formatter
+// itself and by subcommands that need to understand the same flags.
+func defineFlags(fs *flag.FlagSet) *cliFlags {
+	c := &cliFlags{}
+	fs.StringVar(&c.inputFile, "i", "", "Input file path; - reads standard input, which is also used when no input is given and it is not a terminal")
+	fs.StringVar(&c.outputFile, "o", "", "Output file path (optional, prints to stdout if not provided)")
+	c.threshold.v = big.NewInt(defaultThreshold)
+	fs.Var(&c.threshold, "t", "Process numbers strictly greater than this threshold, a decimal integer `N` of any size")
+	fs.StringVar(&c.maxMemory, "max-memory", "", "Soft memory limit such as 512MiB or 2G (optional, enables streaming)")
+	fs.StringVar(&c.emit, "emit", string(powershift.EmitShift), "Replacement style: shift (expression only), both (expression plus the original value in a comment), grouped (digit separators, no expression), hex (hexadecimal literal) or annotate (the literal plus the expression in a comment)")
+	fs.StringVar(&c.lang, "lang", powershift.DefaultProfile, fmt.Sprintf("Target language, controls comment and digit separator syntax (one of %s)", strings.Join(powershift.ProfileNames(), ", ")))
+	fs.BoolVar(&c.version, "version", false, "Print version and build information and exit")
+	fs.BoolVar(&c.capabilities, "capabilities", false, "List supported forms, languages, report formats and options, then exit")
+	fs.BoolVar(&c.json, "json", false, "Print -capabilities as JSON")
+	fs.StringVar(&c.configFile, "config", "", "Read settings from this JSON config file instead of the nearest powershift.json in the working directory or its parents; flags given on the command line take precedence")
+	fs.StringVar(&c.editsFile, "edits", "", "Write a JSON map of every edit (original offset/length to new offset/length) to this file (optional)")
+	fs.BoolVar(&c.write, "w", false, "Write results back to the input files instead of stdout; file arguments after the flags are processed as a batch")
+	fs.StringVar(&c.stateFile, "state", "", fmt.Sprintf("Record completed files of a batch in this journal (default %s when -resume is given)", defaultStateFile))
+	fs.BoolVar(&c.resume, "resume", false, "Skip files the journal lists as completed by an interrupted run (requires -w)")
+	fs.StringVar(&c.writeStrategy, "write-strategy", writeRename, "How -w replaces files: rename (atomic temp file + rename, new inode), copy (temp file copied into the original, keeps the inode and hard links) or in-place (truncate and rewrite)")
+	fs.BoolVar(&c.breakLinks, "break-links", false, "With -w, rewrite hard-linked files even though renaming detaches the other links")
+	fs.BoolVar(&c.preserveLinks, "preserve-links", false, "With -w, rewrite hard-linked files through -write-strategy copy so every link sees the change")
+	fs.BoolVar(&c.skipSecrets, "skip-secrets", false, "Leave files that look like private keys, .env files or credential stores untouched and keep them out of -edits")
+	fs.StringVar(&c.reportFormat, "report", "", "Write a report of every replacement in this format: "+strings.Join(reportFormats, " or ")+" (optional)")
+	fs.StringVar(&c.reportFile, "report-file", "", "Write the -report to this file instead of stderr")
+	fs.StringVar(&c.reportTemplate, "report-template", "", "Write the report with the Go text/template in this `file` instead of a -report format, e.g. for wiki tables or chat messages")
+	fs.BoolVar(&c.redactContext, "redact-context", false, "Leave the surrounding source line out of reports; only the literal and its expression are included")
+	fs.BoolVar(&c.ranges, "ranges", false, "Rewrite a power-of-two start and a 2^n-1 end on the same line as a pair, e.g. start=1 << 20 end=1<<21 - 1")
+	fs.BoolVar(&c.annotateRanges, "annotate-ranges", false, "With -ranges, note the interval after its end, e.g. [2^20, 2^21)")
+	fs.BoolVar(&c.skipArithmetic, "skip-arithmetic", false, "Keep literals that are already an operand of an arithmetic operator, such as 1048576 * count")
+	fs.BoolVar(&c.clipboard, "clipboard", false, "Transform the text on the system clipboard and put the result back instead of reading files")
+	fs.StringVar(&c.cacheFile, "cache-file", "", "Keep decompositions in this file across runs; it is discarded when the strategies change")
+	fs.BoolVar(&c.continuations, "continuations", false, "Treat lines ending in a backslash as continued, so a literal split across them is rewritten as a whole")
+	fs.BoolVar(&c.summaryJSON, "summary-json", false, "When the run ends, write its totals to stderr as one line of JSON")
+	fs.BoolVar(&c.ifChanged, "if-changed", false, "With -o, leave the output file alone when it already holds the result, so its modification time is kept")
+	fs.Var(&c.tiers, "tiers", "Rewrite values by tier: comma-separated `MIN:SPEC` entries such as 1000:annotate,1e6:minus-one,1e9; values below the first tier are kept")
+	fs.BoolVar(&c.reportBits, "report-bits", false, "Add hex, binary, bit length and popcount to every -report finding, and report numbers that were kept as well")
+	fs.BoolVar(&c.reportSuspicious, "report-suspicious", false, "List the numbers a form decomposes but a safeguard kept in a suspicious section of -report, with the reason")
+	fs.BoolVar(&c.tag, "tag", false, "Mark every rewrite with a "+powershift.DefaultTag+" comment, so tools can tell it from hand-written expressions")
+	fs.BoolVar(&c.reverse, "reverse", false, "Undo an earlier run: turn shift expressions back into decimal literals")
+	fs.BoolVar(&c.onlyTagged, "only-tagged", false, "With -reverse, only undo rewrites marked by -tag and keep hand-written expressions")
+	fs.IntVar(&c.jobs, "jobs", 0, "Number of files processed at once, 0 for one per CPU; output to stdout still comes in input order")
+	fs.BoolVar(&c.printFilename, "print-filename", false, "Start the output of each file with a ==> FILE <== line")
+	fs.StringVar(&c.header, "header", "", "Line written before the output of each file, with {file} replaced by its path; -print-filename is -header '==> {file} <=='")
+	fs.StringVar(&c.footer, "footer", "", "Line written after the output of each file, with {file} replaced by its path")
+	fs.Var(&c.minSavings, "min-savings", "Only rewrite when the expression is at least `FRACTION` shorter than the literal, e.g. 0.2 or 20%")
+	fs.Var(&c.maxGrowth, "max-growth", "Only rewrite when the expression is at most `FRACTION` longer than the literal, e.g. 0.5 or 50%")
+	fs.BoolVar(&c.shiftedNeighbors, "shifted-neighbors", false, "Also rewrite literals at or below -t on lines that already hold a shift expression, to complete half-converted tables")
+	fs.BoolVar(&c.stream, "stream", false, "Process each input in chunks so memory use stays bounded whatever its size; -max-memory implies it")
+	c.boundary = boundaryLetters
+	fs.Var(&c.boundary, "boundary", "What ends a literal: letters (an ASCII letter or digit next to a number keeps it, as in v1234 or 1234px), word (also underscores and letters of any script), whitespace (only whitespace ends a literal) or custom (see -glue-before and -glue-after)")
+	fs.Var(&c.glueBefore, "glue-before", "With -boundary custom, keep numbers whose preceding character matches this `REGEXP`")
+	fs.Var(&c.glueAfter, "glue-after", "With -boundary custom, keep numbers whose following character matches this `REGEXP`")
+	fs.IntVar(&c.maxReplacements, "max-replacements", 0, "Rewrite at most `N` literals in each file, for gradual rollouts (0 for no limit)")
+	fs.Var(&c.sample, "sample", "Only rewrite a deterministic `FRACTION` of the literals, e.g. 0.1 or 10%, for small representative diffs")
+	fs.Var(&c.include, "include", "With a directory or glob input, only format files matching these comma-separated `PATTERNS`, e.g. *.c,src/**/*.h")
+	fs.Var(&c.exclude, "exclude", "With a directory or glob input, skip files and directories matching these comma-separated `PATTERNS`, e.g. vendor,*_gen.go")
+	fs.StringVar(&c.perLine, "per-line", string(powershift.PerLineAll), "Which literals of each line may be rewritten: all, first (e.g. a leading counter) or last (e.g. a trailing size)")
+	fs.IntVar(&c.maxOpenFiles, "max-open-files", defaultMaxOpenFiles, "Most files and directories open at once while walking directories and processing files")
+	fs.BoolVar(&c.diff, "d", false, "Print a unified diff of the changes instead of the rewritten content, like gofmt -d")
+	fs.BoolVar(&c.check, "check", false, "Make no changes; print the FILE:LINE:COL of every number that would be rewritten and exit with status 1 if there is any")
+	fs.BoolVar(&c.list, "l", false, "Print only the names of files that would change, like gofmt -l; with -w, the files rewritten")
+	fs.BoolVar(&c.fold, "fold", false, "Rewrite constant arithmetic such as 1048576 / 1024 as its value when that is a power of two or small, here 1 << 10")
+	fs.StringVar(&c.pattern, "pattern", "", "Regular expression that finds numbers in place of the built-in one; its first group holds the decimal digits (optional)")
+	fs.BoolVar(&c.noConfig, "no-config", false, "Do not look for a powershift.json in the working directory and its parents when -config is not given")
+	fs.Var(&c.forms, "forms", "Comma-separated `FORMS` to try, in order, such as minus-one,plus-one (default: those of the language)")
+	fs.DurationVar(&c.matchTimeout, "match-timeout", powershift.DefaultMatchTimeout, "Longest time -pattern may take to find one match before the file fails")
+	fs.BoolVar(&c.events, "events", false, "Write an NDJSON record to stderr as each file starts, each number is matched or replaced, and each file is skipped or done")
+	fs.StringVar(&c.intType, "int-type", "", "Integer `type` of every literal, such as u64 with -lang rust; inferred from each line if empty")
+	fs.Var(&c.ceiling, "max", "Leave numbers strictly greater than this ceiling alone, a decimal integer `N` of any size; no ceiling if unset")
+	fs.IntVar(&c.minDigits, "min-digits", powershift.DefaultMinDigits, "Only match runs of at least `N` digits")
+	fs.BoolVar(&c.namedConstants, "named-constants", false, "Write the maximum values of the integer types by name, as Long.MAX_VALUE with -lang java or kotlin")
+	fs.BoolVar(&c.generate, "generate", false, "Rewrite the Go file named by GOFILE in place, as a //go:generate directive; only literals of the code are rewritten, and only if the result parses and is stable")
+	fs.StringVar(&c.exprStyle, "expr-style", string(powershift.ExprShift), "Notation of the powers: shift (1<<10 - 1, with the precedence of -lang), math (2^10 - 1) or python (2**10 - 1)")
+	fs.StringVar(&c.exprTemplate, "expr-template", "", "Render every expression with this Go text/template, e.g. ({{.Base}}^{{.Exp}}{{.Sign}}1)<<{{.Shift}} (optional)")
+	fs.BoolVar(&c.preflight, "preflight", false, "With -w, format every file without writing first and stop before any is written if one cannot be written or its filesystem lacks the space")
+	fs.IntVar(&c.maxTerms, "max-terms", powershift.DefaultMaxTerms, "Add up at most `N` powers in the sum-of-powers form")
+	fs.IntVar(&c.maxMultiplier, "max-multiplier", powershift.DefaultMaxMultiplier, "Allow odd multipliers up to `K` in the multiple form")
+	fs.StringVar(&c.scoring, "scoring", string(powershift.ScoreFirst), "How to pick among the forms that apply: first (in the order of -forms), shortest (the shortest expression) or simplest (the fewest operators)")
+	fs.Var(&c.formWeights, "form-weights", "With -scoring shortest or simplest, comma-separated FORM=N `weights` added to the scores of the forms, e.g. plus-one=2,multiple=-1")
+	fs.Var(&c.approx, "approx", "Rewrite numbers within `FRACTION` of a power of two that no form decomposes, e.g. 0.1%, as set by -approx-mode")
+	fs.StringVar(&c.approxMode, "approx-mode", string(powershift.ApproxAnnotate), "How -approx writes a near miss: annotate (the power, with the number in a comment) or adjust (the power plus the difference, keeping the value)")
+	fs.StringVar(&c.failOn, "fail-on", failOnAny, "With -check, the lowest `severity` that fails the run: error, warning or any (every number found)")
+	fs.Var(&c.severities, "severity", "With -check, comma-separated FORM=LEVEL `severities` of error, warning or note, e.g. plus-one=note (power is error and every other form warning by default)")
+	fs.BoolVar(&c.scientific, "scientific", false, "Also rewrite numbers in scientific notation whose value is an integer, such as 1.048576e6, in the -emit style")
+	fs.BoolVar(&c.words, "words", false, "Experimental: also match roman numerals such as MXXIV and numbers spelled out in English, such as sixty-five thousand five hundred thirty-six (requires -emit annotate)")
+	fs.Func("locale", "`LOCALE` of log messages: en or zh-CN (default from LC_ALL, LC_MESSAGES or LANG)", setLocale)
+	defineLongFlags(fs)
+	return c
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// runGenerate implements -generate: it rewrites the Go file that go generate
+// names in GOFILE in place. Only decimal integer literals of the code are
+// rewritten, never those in comments, strings or the directive itself, and
+// the file is left alone unless the result parses and a second run would not
+// change it again.
+func runGenerate(cli *cliFlags, args []string) error {
+	path := os.Getenv("GOFILE")
+	if path == "" {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-generate",
+			"run it from a //go:generate directive, which sets GOFILE", "GOFILE is not set")
+	}
+	if len(args) > 0 || cli.inputFile != "" || cli.outputFile != "" {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-generate",
+			"drop the file arguments; -generate rewrites the file of its directive", "-generate takes no inputs, -i or -o")
+	}
+	if cli.lang == powershift.DefaultProfile {
+		cli.lang = "go"
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return readError(path, err)
+	}
+
+	out, stats, err := generatePass(cli, src)
+	if err != nil {
+		return err
+	}
+	if !stats.Changed() {
+		return nil
+	}
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution); err == nil {
+		if _, err := parser.ParseFile(fset, path, out, parser.SkipObjectResolution); err != nil {
+			return powershift.NewError(powershift.ErrWriteFailed, "verify", path, err,
+				"the file was left alone; keep the literal with a powershift:ignore comment")
+		}
+	}
+	again, stats, err := generatePass(cli, out)
+	if err != nil {
+		return err
+	}
+	if stats.Replaced > 0 {
+		line := 1 + bytes.Count(again[:firstDifference(out, again)], []byte("\n"))
+		return powershift.Errorf(powershift.ErrInvalidOption, "verify", path, "raise -t or -min-digits above the exponents",
+			"the result would be rewritten again at line %d, so the file was left alone", line)
+	}
+	_, err = writeIfChanged(path, out)
+	return err
+}
+
+// generatePass formats src, a Go file, rewriting only the integer literals
+// the Go scanner finds in its code.
+func generatePass(cli *cliFlags, src []byte) ([]byte, powershift.Stats, error) {
+	literals := goIntLiterals(src)
+	f, err := powershift.New(append(cli.formatterOptions(), powershift.WithDecisionFunc(func(m powershift.Match) powershift.Decision {
+		if literals[m.Offset] != m.Text {
+			return powershift.Veto
+		}
+		return powershift.Accept
+	}))...)
+	if err != nil {
+		return nil, powershift.Stats{}, err
+	}
+	var buf bytes.Buffer
+	stats, err := f.Transform(&buf, bytes.NewReader(src))
+	return buf.Bytes(), stats, err
+}
+
+// goIntLiterals maps the byte offsets of the decimal integer literals of src
+// to their text. Octal literals such as 0755 are left out, as are literals
+// with digit separators, which the formatter does not match as a whole.
+func goIntLiterals(src []byte) map[int64]string {
+	literals := map[int64]string{}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return literals
+		}
+		if tok != token.INT || lit[0] == '0' {
+			continue
+		}
+		if strings.IndexFunc(lit, isNotDigit) < 0 {
+			literals[int64(file.Offset(pos))] = lit
+		}
+	}
+}
+
+func isNotDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+// firstDifference returns the index of the first byte at which a and b differ.
+func firstDifference(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// githubSecretEnv names the environment variable holding the webhook secret,
+// which is kept off the command line.
+const githubSecretEnv = "POWERSHIFT_GITHUB_WEBHOOK_SECRET"
+
+// GitHub caps annotations per check run request; review comments are capped
+// by us so that a noisy pull request does not drown in suggestions.
+const (
+	maxAnnotationsPerRequest = 50
+	maxReviewComments        = 50
+)
+
+// Pull requests are reviewed by a fixed number of workers, and deliveries
+// that find the queue full are turned away rather than piling up.
+const (
+	reviewWorkers  = 4
+	maxQueuedPulls = 64
+)
+
+// githubApp answers GitHub webhooks as a GitHub App: for every opened or
+// updated pull request it formats the changed files and reports the results
+// as a check run with annotations and a review with suggested changes.
+type githubApp struct {
+	srv     *server
+	appID   int64
+	key     *rsa.PrivateKey
+	secret  []byte
+	api     string // API base URL, without a trailing slash
+	client  *http.Client
+	timeout time.Duration // Time allowed for handling one event
+	queue   chan pullRequestEvent
+}
+
+func newGitHubApp(srv *server, appID int64, keyFile, api string) (*githubApp, error) {
+	secret := os.Getenv(githubSecretEnv)
+	if secret == "" {
+		return nil, powershift.Errorf(powershift.ErrInvalidOption, "set", "-github-app-id",
+			"set "+githubSecretEnv+" to the webhook secret configured for the app", "no webhook secret")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, readError(keyFile, err)
+	}
+	key, err := parseRSAKey(data)
+	if err != nil {
+		return nil, powershift.NewError(powershift.ErrInvalidOption, "parse", keyFile, err,
+			"use the private key (.pem) downloaded from the app settings")
+	}
+	a := &githubApp{
+		srv:     srv,
+		appID:   appID,
+		key:     key,
+		secret:  []byte(secret),
+		api:     strings.TrimSuffix(api, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		timeout: 5 * time.Minute,
+		queue:   make(chan pullRequestEvent, maxQueuedPulls),
+	}
+	for range reviewWorkers {
+		go a.reviewQueued()
+	}
+	return a, nil
+}
+
+// reviewQueued reviews the pull requests of accepted deliveries one at a time.
+func (a *githubApp) reviewQueued() {
+	for ev := range a.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+		if err := a.review(ctx, ev); err != nil {
+			logf("Reviewing %s#%d: %v", ev.Repository.FullName, ev.Number, err)
+		}
+		cancel()
+	}
+}
+
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// pullRequestEvent holds the parts of a pull_request webhook payload we use.
+type pullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// handleWebhook verifies and accepts a webhook delivery. Pull requests are
+// queued and processed in the background because GitHub gives up on slow
+// deliveries.
+func (a *githubApp) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, a.srv.maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !a.validSignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") != "pull_request" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var ev pullRequestEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch ev.Action {
+	case "opened", "synchronize", "reopened":
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	select {
+	case a.queue <- ev:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "too many pull requests are waiting for review", http.StatusServiceUnavailable)
+	}
+}
+
+func (a *githubApp) validSignature(body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	want, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// prFile is an entry of the pull request files listing.
+type prFile struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"`
+	Patch    string `json:"patch"`
+}
+
+// suggestion is a line the formatter would change.
+type suggestion struct {
+	path     string
+	line     int
+	original string // Replaced literals, for the annotation message
+	newLine  string
+	inDiff   bool // Whether the line can carry a review comment
+}
+
+// review formats the changed files of a pull request and publishes the result.
+func (a *githubApp) review(ctx context.Context, ev pullRequestEvent) error {
+	token, err := a.installationToken(ctx, ev.Installation.ID)
+	if err != nil {
+		return err
+	}
+	repo := ev.Repository.FullName
+	sha := ev.PullRequest.Head.SHA
+
+	var files []prFile
+	for page := 1; ; page++ {
+		var batch []prFile
+		path := fmt.Sprintf("/repos/%s/pulls/%d/files?per_page=100&page=%d", repo, ev.Number, page)
+		if err := a.call(ctx, token, http.MethodGet, path, nil, &batch); err != nil {
+			return err
+		}
+		files = append(files, batch...)
+		if len(batch) < 100 {
+			break
+		}
+	}
+
+	cli, err := a.srv.requestFlags(nil)
+	if err != nil {
+		return err
+	}
+	var suggestions []suggestion
+	for _, f := range files {
+		if f.Status == "removed" {
+			continue
+		}
+		content, err := a.fileContent(ctx, token, repo, f.Filename, sha)
+		if err != nil {
+			logf("Skipping %s: %v", f.Filename, err)
+			continue
+		}
+		found, err := suggest(cli, f, content)
+		if err != nil {
+			logf("Skipping %s: %v", f.Filename, err)
+			continue
+		}
+		suggestions = append(suggestions, found...)
+	}
+
+	if err := a.publishCheckRun(ctx, token, repo, sha, suggestions); err != nil {
+		return err
+	}
+	return a.publishReview(ctx, token, repo, ev.Number, sha, suggestions)
+}
+
+// suggest formats one file, using the language its extension implies unless
+// -lang names one, and
+// returns a suggestion for every changed line.
+func suggest(cli *cliFlags, f prFile, content []byte) ([]suggestion, error) {
+	if isBinary(content) {
+		return nil, nil
+	}
+	fileCli := *cli
+	fileCli.lang = languageFor(f.Filename, cli.lang)
+	replaced := map[int][]string{}
+	opts := append(fileCli.formatterOptions(), powershift.WithResultFunc(func(res powershift.Result) {
+		if res.Replaced {
+			replaced[res.Line] = append(replaced[res.Line], res.Text)
+		}
+	}))
+	formatter, err := powershift.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := formatter.String(string(content))
+	if err != nil {
+		return nil, err
+	}
+	if len(replaced) == 0 {
+		return nil, nil
+	}
+
+	// Replacements never add or remove line breaks, so lines correspond one to one
+	newLines := strings.Split(out, "\n")
+	diffLines := rightSideLines(f.Patch)
+	var found []suggestion
+	for n := 1; n <= len(newLines); n++ {
+		literals, ok := replaced[n]
+		if !ok {
+			continue
+		}
+		found = append(found, suggestion{
+			path:     f.Filename,
+			line:     n,
+			original: strings.Join(literals, ", "),
+			newLine:  strings.TrimSuffix(newLines[n-1], "\r"),
+			inDiff:   diffLines[n],
+		})
+	}
+	return found, nil
+}
+
+// rightSideLines returns the new-file line numbers a unified diff patch shows,
+// which are the lines a review comment may be attached to.
+func rightSideLines(patch string) map[int]bool {
+	lines := map[int]bool{}
+	n := 0
+	for _, l := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(l, "@@"):
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(l)
+			if len(fields) < 3 {
+				continue
+			}
+			start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+			n, _ = strconv.Atoi(start)
+		case strings.HasPrefix(l, "-"), strings.HasPrefix(l, `\`):
+		default:
+			if n > 0 {
+				lines[n] = true
+				n++
+			}
+		}
+	}
+	return lines
+}
+
+func (a *githubApp) publishCheckRun(ctx context.Context, token, repo, sha string, suggestions []suggestion) error {
+	type annotation struct {
+		Path            string `json:"path"`
+		StartLine       int    `json:"start_line"`
+		EndLine         int    `json:"end_line"`
+		AnnotationLevel string `json:"annotation_level"`
+		Message         string `json:"message"`
+	}
+	type output struct {
+		Title       string       `json:"title"`
+		Summary     string       `json:"summary"`
+		Annotations []annotation `json:"annotations"`
+	}
+	var annotations []annotation
+	for _, s := range suggestions {
+		annotations = append(annotations, annotation{
+			Path: s.path, StartLine: s.line, EndLine: s.line, AnnotationLevel: "notice",
+			Message: fmt.Sprintf("%s can be written as a power-of-two expression:\n%s", s.original, strings.TrimSpace(s.newLine)),
+		})
+	}
+	out := output{Title: "No constants to rewrite", Summary: "Every literal is fine as it is."}
+	conclusion := "success"
+	if len(suggestions) > 0 {
+		out.Title = fmt.Sprintf("%d lines with constants that have a power-of-two form", len(suggestions))
+		out.Summary = "Run PowerShiftFormatter -w on the files, or apply the suggested changes of the review."
+		conclusion = "neutral"
+	}
+
+	first := min(len(annotations), maxAnnotationsPerRequest)
+	out.Annotations = annotations[:first]
+	var run struct {
+		ID int64 `json:"id"`
+	}
+	err := a.call(ctx, token, http.MethodPost, "/repos/"+repo+"/check-runs", map[string]any{
+		"name": "PowerShiftFormatter", "head_sha": sha, "status": "completed",
+		"conclusion": conclusion, "output": out,
+	}, &run)
+	if err != nil {
+		return err
+	}
+	for rest := annotations[first:]; len(rest) > 0; {
+		n := min(len(rest), maxAnnotationsPerRequest)
+		out.Annotations = rest[:n]
+		rest = rest[n:]
+		path := fmt.Sprintf("/repos/%s/check-runs/%d", repo, run.ID)
+		if err := a.call(ctx, token, http.MethodPatch, path, map[string]any{"output": out}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *githubApp) publishReview(ctx context.Context, token, repo string, number int, sha string, suggestions []suggestion) error {
+	type comment struct {
+		Path string `json:"path"`
+		Line int    `json:"line"`
+		Side string `json:"side"`
+		Body string `json:"body"`
+	}
+	var comments []comment
+	for _, s := range suggestions {
+		if !s.inDiff || len(comments) == maxReviewComments {
+			continue
+		}
+		comments = append(comments, comment{
+			Path: s.path, Line: s.line, Side: "RIGHT",
+			Body: fmt.Sprintf("`%s` has a power-of-two form:\n```suggestion\n%s\n```", s.original, s.newLine),
+		})
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	return a.call(ctx, token, http.MethodPost, fmt.Sprintf("/repos/%s/pulls/%d/reviews", repo, number), map[string]any{
+		"commit_id": sha, "event": "COMMENT", "comments": comments,
+	}, nil)
+}
+
+// installationToken exchanges the app's JWT for a token of one installation.
+func (a *githubApp) installationToken(ctx context.Context, installation int64) (string, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installation)
+	if err := a.do(ctx, "Bearer "+jwt, http.MethodPost, path, nil, &resp, ""); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+// jwt signs the short-lived token that authenticates the app itself.
+func (a *githubApp) jwt(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(), // Allow for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.appID, 10),
+	})
+	signed := header + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+func (a *githubApp) fileContent(ctx context.Context, token, repo, name, ref string) ([]byte, error) {
+	var raw bytes.Buffer
+	path := fmt.Sprintf("/repos/%s/contents/%s?ref=%s", repo, escapePath(name), url.QueryEscape(ref))
+	if err := a.do(ctx, "token "+token, http.MethodGet, path, nil, &raw, "application/vnd.github.raw+json"); err != nil {
+		return nil, err
+	}
+	return raw.Bytes(), nil
+}
+
+func escapePath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// call sends an API request authenticated with an installation token.
+func (a *githubApp) call(ctx context.Context, token, method, path string, body, result any) error {
+	return a.do(ctx, "token "+token, method, path, body, result, "")
+}
+
+// do sends an API request. A *bytes.Buffer result receives the raw body,
+// any other non-nil result is decoded from JSON.
+func (a *githubApp) do(ctx context.Context, auth, method, path string, body, result any, accept string) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.api+path, payload)
+	if err != nil {
+		return err
+	}
+	if accept == "" {
+		accept = "application/vnd.github+json"
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if result == nil {
+		return nil
+	}
+	// Files are formatted in memory, so they get the limit of a request to
+	// the server, and so do the listings
+	data, err := io.ReadAll(io.LimitReader(resp.Body, a.srv.maxBody+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > a.srv.maxBody {
+		return fmt.Errorf("%s %s: the response is larger than -max-body (%d bytes)", method, path, a.srv.maxBody)
+	}
+	if r, ok := result.(*bytes.Buffer); ok {
+		r.Write(data)
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGitHubResponseLimit(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer api.Close()
+	a := &githubApp{srv: &server{maxBody: 100}, api: api.URL, client: api.Client()}
+
+	var raw bytes.Buffer
+	if err := a.do(context.Background(), "", http.MethodGet, "/", nil, &raw, ""); err != nil || raw.Len() != 100 {
+		t.Fatalf("a response of the limit gave %d bytes, %v", raw.Len(), err)
+	}
+	a.srv.maxBody = 99
+	if err := a.do(context.Background(), "", http.MethodGet, "/", nil, &raw, ""); err == nil {
+		t.Error("a response over the limit was read")
+	}
+}
+
+func TestGitHubQueueFull(t *testing.T) {
+	a := &githubApp{srv: &server{maxBody: 1 << 20}, secret: []byte("secret"), queue: make(chan pullRequestEvent, 1)}
+	body := `{"action": "opened", "number": 1}`
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(body))
+	deliver := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/github/webhook", strings.NewReader(body))
+		r.Header.Set("X-GitHub-Event", "pull_request")
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		a.handleWebhook(w, r)
+		return w.Code
+	}
+	if code := deliver(); code != http.StatusAccepted {
+		t.Fatalf("the first delivery got status %d", code)
+	}
+	if code := deliver(); code != http.StatusServiceUnavailable {
+		t.Errorf("a delivery to a full queue got status %d", code)
+	}
+	if ev := <-a.queue; ev.Number != 1 {
+		t.Errorf("the queued pull request is #%d", ev.Number)
+	}
+}
+
+func TestGitHubReviewSkipsUnreadableFiles(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var review struct {
+		Comments []struct {
+			Path string `json:"path"`
+		} `json:"comments"`
+	}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/app/installations/"):
+			w.Write([]byte(`{"token": "t"}`))
+		case strings.HasSuffix(r.URL.Path, "/pulls/1/files"):
+			patch := `"@@ -0,0 +1,3 @@\n+package p\n+\n+const Size = 1048576"`
+			w.Write([]byte(`[{"filename": "big.go", "patch": ` + patch + `}, {"filename": "small.go", "patch": ` + patch + `}]`))
+		case strings.HasSuffix(r.URL.Path, "/contents/big.go"):
+			w.Write([]byte("package big\n\nconst Size = 1048576 // " + strings.Repeat("x", 1<<10) + "\n"))
+		case strings.HasSuffix(r.URL.Path, "/contents/small.go"):
+			w.Write([]byte("package small\n\nconst Size = 1048576\n"))
+		case strings.HasSuffix(r.URL.Path, "/pulls/1/reviews"):
+			json.NewDecoder(r.Body).Decode(&review)
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer api.Close()
+	a := &githubApp{srv: &server{maxBody: 512}, key: key, api: api.URL, client: api.Client()}
+
+	ev := pullRequestEvent{Number: 1}
+	ev.Repository.FullName = "o/r"
+	if err := a.review(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(review.Comments) != 1 || review.Comments[0].Path != "small.go" {
+		t.Errorf("the review comments on %+v, want only small.go", review.Comments)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// locale is the language of log messages, chosen from the environment at
+// startup and by -locale.
+var locale = envLocale()
+
+// locales are the supported languages. English is the language the messages
+// are written in, and needs no catalog.
+var locales = []string{"en", "zh-CN"}
+
+// catalogs hold the translations of log messages, keyed by the English format
+// string. A message missing from a catalog is printed in English.
+var catalogs = map[string]map[string]string{
+	"zh-CN": {
+		"Error: %v":       "错误：%v",
+		"Hint: %s":        "提示：%s",
+		"Warning: %s: %v": "警告：%s：%v",
+		"Error: Input file path (-i) is required.":               "错误：必须用 -i 指定输入文件路径。",
+		"Applied %d rewrites to %s":                              "已对 %[2]s 应用 %[1]d 处改写",
+		"Discarding %s: %v":                                      "丢弃 %s：%v",
+		"Nothing to rewrite on the clipboard (%d numbers found)": "剪贴板中没有需要改写的内容（找到 %d 个数字）",
+		"Rewrote %d of %d numbers on the clipboard":              "已改写剪贴板中 %[2]d 个数字中的 %[1]d 个",
+		"Note: not written to the config (per-run flags): %s":    "注意：以下单次运行参数未写入配置：%s",
+		"Normalized %d uses in %s":                               "已统一 %[2]s 中的 %[1]d 处用法",
+		"Normalized %d literals in %s":                           "已规范化 %[2]s 中的 %[1]d 个字面量",
+		"Verified %d expressions in %d files":                    "已验证 %[2]d 个文件中的 %[1]d 个表达式",
+		"Saving the cache: %v":                                   "保存缓存：%v",
+		"Listening on %s":                                        "正在监听 %s",
+		"Idle for %s, exiting":                                   "已空闲 %s，退出",
+		"Reading request: %v":                                    "读取请求：%v",
+		"Reviewing %s#%d: %v":                                    "审查 %s#%d：%v",
+		"Skipping %s: %v":                                        "跳过 %s：%v",
+		"Skipping %s (already completed)":                        "跳过 %s（已完成）",
+		"%s is already up to date":                               "%s 已是最新",
+		"Successfully processed %s and wrote output to %s":       "已处理 %s 并将结果写入 %s",
+		"Skipping %s: looks like %s":                             "跳过 %s：疑似机密文件（%s）",
+		"Warning: skipping %s: it has %d hard links and -write-strategy rename would detach them; pass -preserve-links or -break-links": "警告：跳过 %s：它有 %d 个硬链接，-write-strategy rename 会断开它们；请指定 -preserve-links 或 -break-links",
+		"Rejected path %q: %v":                                      "拒绝路径 %q：%v",
+		"%s is identical to %s; reusing its result":                 "%s 与 %s 内容相同，沿用其结果",
+		"Using config file %s":                                      "使用配置文件 %s",
+		"Preflight: %s: %v":                                         "预检：%s：%v",
+		"Preflight: %d of %d files would change, %d bytes to write": "预检：%[2]d 个文件中有 %[1]d 个将被修改，需写入 %[3]d 字节",
+	},
+}
+
+// logf logs a message in the current locale.
+func logf(format string, args ...any) {
+	if t, ok := catalogs[locale][format]; ok {
+		format = t
+	}
+	log.Printf(format, args...)
+}
+
+// envLocale returns the supported locale named by LC_ALL, LC_MESSAGES or
+// LANG, in the order POSIX gives them precedence, or English.
+func envLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			if l, ok := matchLocale(v); ok {
+				return l
+			}
+			return "en"
+		}
+	}
+	return "en"
+}
+
+// matchLocale maps a locale name such as zh_CN.UTF-8 or zh-Hans to a
+// supported locale.
+func matchLocale(name string) (string, bool) {
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	switch name {
+	case "en", "c", "posix":
+		return "en", true
+	case "zh", "zh-cn", "zh-sg", "zh-hans", "zh-hans-cn":
+		return "zh-CN", true
+	}
+	if strings.HasPrefix(name, "en-") {
+		return "en", true
+	}
+	return "", false
+}
+
+// setLocale implements -locale.
+func setLocale(name string) error {
+	l, ok := matchLocale(name)
+	if !ok {
+		return fmt.Errorf("unsupported locale %q (supported: %s)", name, strings.Join(locales, ", "))
+	}
+	locale = l
+	return nil
+}
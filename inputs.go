@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// patternsFlag is the value of -include or -exclude: glob patterns, given
+// comma-separated or by repeating the flag.
+type patternsFlag []string
+
+func (p *patternsFlag) String() string { return strings.Join(*p, ",") }
+
+func (p *patternsFlag) Set(s string) error {
+	for _, pattern := range strings.Split(s, ",") {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return err
+		}
+		*p = append(*p, pattern)
+	}
+	return nil
+}
+
+// match reports whether one of the patterns matches the file rel, a slash
+// separated path relative to the directory or glob it was found under. A
+// pattern without a slash is matched against the base name only.
+func (p patternsFlag) match(rel string) bool {
+	return slices.ContainsFunc(p, func(pattern string) bool {
+		if !strings.Contains(pattern, "/") {
+			return matchPath(pattern, path.Base(rel))
+		}
+		return matchPath(pattern, rel)
+	})
+}
+
+// matchPath matches a slash separated name against pattern, in which a "**"
+// segment stands for any number of directories.
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// expandInputs replaces the directories and glob patterns among args with the
+// files they hold, in lexical order. Files found that way are filtered by
+// include and exclude, and hidden, binary and document files are left out;
+// files named directly are always kept.
+func expandInputs(args []string, include, exclude patternsFlag) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if arg == stdinPath {
+			inputs = append(inputs, arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		switch {
+		case err == nil && !info.IsDir():
+			inputs = append(inputs, arg)
+		case err == nil:
+			files, err := walkInputs(arg, include, exclude)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, files...)
+		case isGlob(arg):
+			files, err := globInputs(arg, include, exclude)
+			if err != nil {
+				return nil, err
+			}
+			if len(files) == 0 {
+				return nil, powershift.Errorf(powershift.ErrInputNotFound, "glob", arg,
+					"quote the pattern so the shell leaves it alone, and check it against the tree", "no files match")
+			}
+			inputs = append(inputs, files...)
+		default:
+			inputs = append(inputs, arg) // Reported when it is opened
+		}
+	}
+	return inputs, nil
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
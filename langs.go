@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// extLanguages maps file extensions to the language profile used for them
+// where files of mixed languages are formatted together.
+var extLanguages = map[string]string{
+	".c":    "c",
+	".h":    "c",
+	".cc":   "cpp",
+	".cpp":  "cpp",
+	".cxx":  "cpp",
+	".hh":   "cpp",
+	".hpp":  "cpp",
+	".go":   "go",
+	".java": "java",
+	".js":   "js",
+	".mjs":  "js",
+	".cjs":  "js",
+	".jsx":  "js",
+	".ts":   "js",
+	".tsx":  "js",
+	".rs":   "rust",
+	".py":   "python",
+	".sh":   "shell",
+	".bash": "shell",
+	".zsh":  "shell",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+}
+
+// languageForPath returns the language profile for name by its extension, or
+// fallback if the extension is not known.
+func languageForPath(name, fallback string) string {
+	if lang, ok := extLanguages[strings.ToLower(filepath.Ext(name))]; ok {
+		return lang
+	}
+	return fallback
+}
+
+// languageFor returns the language to format path in: lang if it was set to
+// something other than the default, as -lang or a config, otherwise the one
+// the extension of path implies.
+func languageFor(path, lang string) string {
+	if lang != powershift.DefaultProfile {
+		return lang
+	}
+	return languageForPath(path, lang)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// linkCount returns 1: hard link counts are not available on this platform.
+func linkCount(info fs.FileInfo) uint64 {
+	return 1
+}
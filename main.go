@@ -1,119 +1,661 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
-	"math/big"
+	"io/fs"
 	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dlclark/regexp2"
-	"github.com/doraemonkeys/doraemon"
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
 )
 
-const defaultThreshold int64 = 100
+const defaultThreshold = powershift.DefaultThreshold
+
+const (
+	minChunkSize = 64 << 10 // Smallest read size used in streaming mode
+	maxChunkSize = 64 << 20 // Largest read size used in streaming mode
+
+	defaultChunkSize = 1 << 20 // Read size of -stream without -max-memory
+)
+
+// errUsage is returned by run once it has printed the usage itself, so main
+// only sets the exit status.
+var errUsage = errors.New("usage printed")
 
 func main() {
+	err := run()
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, errUsage) {
+		logf("Error: %v", err)
+		if hint := powershift.Hint(err); hint != "" {
+			logf("Hint: %s", hint)
+		}
+		printExamplesFor(os.Stderr, err)
+	}
+	os.Exit(1)
+}
+
+func run() (err error) {
+	// Subcommands come before any flags
+	args, decode := os.Args[1:], false
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			return runConfig(os.Args[2:])
+		case "serve":
+			return runServe(os.Args[2:])
+		case "analyze":
+			return runAnalyze(os.Args[2:])
+		case "daemon":
+			return runDaemon(os.Args[2:])
+		case "apply":
+			return runApply(os.Args[2:])
+		case "consistency":
+			return runConsistency(os.Args[2:])
+		case "normalize":
+			return runNormalize(os.Args[2:])
+		case "verify":
+			return runVerify(os.Args[2:])
+		case "examples":
+			return runExamples(os.Args[2:])
+		case "decode":
+			// A run with -reverse, under the name of the inverse operation
+			args, decode = os.Args[2:], true
+		}
+	}
+
 	// Define command-line flags
-	inputFile := flag.String("i", "", "Input file path (required)")
-	outputFile := flag.String("o", "", "Output file path (optional, prints to stdout if not provided)")
-	thresholdVal := flag.Int64("t", defaultThreshold, fmt.Sprintf("Process numbers strictly greater than this threshold (default %d)", defaultThreshold))
+	cli := defineFlags(flag.CommandLine)
+	flag.CommandLine.Parse(args)
+	if decode {
+		flag.CommandLine.Set("reverse", "true")
+		cli.anyNotation = true
+	}
 
-	flag.Parse()
+	// Apply the config file before anything reads the flag values. Without
+	// -config, the project's own is used
+	if cli.configFile == "" && !cli.noConfig {
+		if path, ok := findProjectConfig("."); ok {
+			logf("Using config file %s", path)
+			cli.configFile = path
+		}
+	}
+	if cli.configFile != "" {
+		values, err := loadConfig(cli.configFile)
+		if err != nil {
+			return err
+		}
+		if err := applyConfig(flag.CommandLine, values); err != nil {
+			return err
+		}
+	}
 
-	// Validate required input file flag
-	if *inputFile == "" {
-		log.Println("Error: Input file path (-i) is required.")
-		flag.Usage() // Print usage information
-		os.Exit(1)   // Exit with an error code
+	if cli.version {
+		printVersion(os.Stdout)
+		return nil
+	}
+	if cli.capabilities {
+		if err := printCapabilities(os.Stdout, flag.CommandLine, cli.json); err != nil {
+			return writeError("write", "", err)
+		}
+		return nil
 	}
-	filePath := *inputFile
 
-	// Convert threshold to big.Int
-	thresholdBigInt := big.NewInt(*thresholdVal)
+	if cli.generate {
+		return runGenerate(cli, flag.Args())
+	}
 
-	// Read input file content
-	contentBytes, err := os.ReadFile(filePath)
+	// Collect the inputs: -i and/or file arguments
+	inputs := flag.Args()
+	if cli.inputFile != "" {
+		inputs = append([]string{cli.inputFile}, inputs...)
+	}
+	if cli.maxOpenFiles < 1 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-max-open-files",
+			"use at least 1", "-max-open-files of %d", cli.maxOpenFiles)
+	}
+	setMaxOpenFiles(cli.maxOpenFiles)
+	inputs, err = expandInputs(inputs, cli.include, cli.exclude)
 	if err != nil {
-		log.Fatalf("Failed to read file %s: %v", filePath, err)
+		return err
+	}
+	if cli.clipboard && (len(inputs) > 0 || cli.outputFile != "" || cli.write) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-clipboard",
+			"drop the file arguments", "-clipboard cannot be combined with input files, -o or -w")
+	}
+	// Without inputs the tool works as a filter, unless stdin is a terminal
+	if len(inputs) == 0 && !cli.clipboard && !stdinIsTerminal() {
+		inputs = []string{stdinPath}
+	}
+	if len(inputs) == 0 && !cli.clipboard {
+		if len(os.Args) > 1 {
+			logf("Error: Input file path (-i) is required.")
+		}
+		printExamples(os.Stderr, "")
+		fmt.Fprintf(os.Stderr, "Run %s -h to list every flag.\n", os.Args[0])
+		return errUsage
+	}
+	if cli.outputFile != "" && (len(inputs) > 1 || cli.write) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-o",
+			"use -w to rewrite several files in place", "-o takes exactly one input and cannot be combined with -w")
+	}
+	if cli.write && slices.Contains(inputs, stdinPath) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-w",
+			"drop -w to write the result to stdout", "standard input cannot be rewritten in place")
+	}
+	if cli.diff && cli.write {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-d",
+			"run with -d to review the changes, then with -w to make them", "-d cannot be combined with -w")
+	}
+	if cli.check && (cli.write || cli.diff || cli.outputFile != "" || cli.clipboard) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-check",
+			"drop the other flag; -check only reports", "-check cannot be combined with -w, -d, -o or -clipboard")
+	}
+	if cli.list && (cli.diff || cli.check || cli.outputFile != "" || cli.clipboard) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-l",
+			"drop the other flag; -l only lists files, optionally with -w", "-l cannot be combined with -d, -check, -o or -clipboard")
+	}
+	if cli.ifChanged && cli.outputFile == "" {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-if-changed",
+			"add -o; -w already leaves unchanged files alone", "-if-changed requires -o")
+	}
+	if err := checkWriteStrategy(cli.writeStrategy); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-write-strategy", err, "")
+	}
+	if cli.breakLinks && cli.preserveLinks {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-break-links",
+			"pick one of them", "-break-links and -preserve-links are mutually exclusive")
+	}
+	if cli.onlyTagged && !cli.reverse {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-only-tagged",
+			"add -reverse", "-only-tagged requires -reverse")
+	}
+	if cli.jobs < 0 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-jobs",
+			"use 1 to process files one at a time, or 0 for one job per CPU", "-jobs must not be negative, got %d", cli.jobs)
+	}
+	if cli.jobs == 0 {
+		cli.jobs = runtime.NumCPU()
+	}
+	if cli.printFilename {
+		if cli.header != "" {
+			return powershift.Errorf(powershift.ErrInvalidOption, "check", "-print-filename",
+				"pick one of them", "-print-filename and -header are mutually exclusive")
+		}
+		cli.header = printFilenameHeader
+	}
+	if (cli.header != "" || cli.footer != "") && cli.write {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-header",
+			"drop -w to print the results", "-header, -footer and -print-filename need output to stdout or -o")
+	}
+	if cli.minSavings.set && cli.maxGrowth.set {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-min-savings",
+			"pick one of them", "-min-savings and -max-growth are mutually exclusive")
+	}
+	if cli.minSavings.set && cli.minSavings.value >= 1 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-min-savings",
+			"use a fraction below 1, such as 0.2", "no expression can be %s shorter", cli.minSavings.spec)
+	}
+	if cli.exprTemplate != "" && cli.exprStyle != string(powershift.ExprShift) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-expr-template",
+			"pick one of them", "-expr-template and -expr-style are mutually exclusive")
+	}
+	if cli.maxReplacements < 0 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-max-replacements",
+			"use 0 for no limit", "-max-replacements of %d", cli.maxReplacements)
+	}
+	if (cli.glueBefore.re != nil || cli.glueAfter.re != nil) && cli.boundary != boundaryCustom {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-glue-before",
+			"add -boundary custom", "-glue-before and -glue-after require -boundary custom")
+	}
+	if cli.words && cli.emit != string(powershift.EmitAnnotate) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-words",
+			"add -emit annotate, which keeps the wording and adds the expression in a comment", "-words requires -emit annotate")
+	}
+	if !slices.Contains(failOnNames(), cli.failOn) {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-fail-on",
+			fmt.Sprintf("use one of %v", failOnNames()), "unknown -fail-on %q", cli.failOn)
+	}
+	if cli.severityAware() && !cli.check {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-fail-on",
+			"add -check", "-fail-on and -severity require -check")
+	}
+	if cli.preflight && !cli.write {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-preflight",
+			"add -w; -d and -l show what would change without writing", "-preflight requires -w")
+	}
+	if cli.resume && !cli.write {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-resume",
+			"add -w; resuming only makes sense when results are written back to the inputs", "-resume requires -w")
 	}
-	content := string(contentBytes)
 
-	// Compile the regex: (?<!\d|[a-z]|[A-Z])(\d{3,})(?!\d|[a-z]|[A-Z])
-	// This finds standalone numbers of 3 or more digits.
-	re, err := regexp2.Compile(`(?<!\d|[a-z]|[A-Z])(\d{3,})(?!\d|[a-z]|[A-Z])`, regexp2.ECMAScript)
-	if err != nil {
-		log.Fatalf("Failed to compile regex: %v", err)
+	// Apply the soft memory limit and derive the streaming chunk size from it
+	chunkSize := 0
+	if cli.maxMemory != "" {
+		limit, err := parseByteSize(cli.maxMemory)
+		if err != nil {
+			return powershift.NewError(powershift.ErrInvalidOption, "parse", "-max-memory", err,
+				"use a positive size such as 512MiB, 2G or 1048576")
+		}
+		debug.SetMemoryLimit(limit)
+		chunkSize = chunkSizeForLimit(limit)
+	} else if cli.stream {
+		chunkSize = defaultChunkSize
 	}
 
-	var resultBuilder strings.Builder
-	currentIndex := 0 // Tracks the end of the last processed part
+	var opts []powershift.Option // Options beyond the formatter flags
+	if chunkSize > 0 {
+		opts = append(opts, powershift.WithChunkSize(chunkSize))
+	}
+	var cache *powershift.Cache
+	if cli.cacheFile != "" {
+		var err error
+		if cache, err = loadCacheFile(cli.cacheFile, cacheFileSize); err != nil {
+			return err
+		}
+		opts = append(opts, powershift.WithCache(cache))
+	}
+	var report *reporter
+	if cli.reportFormat != "" || cli.reportTemplate != "" {
+		var err error
+		report, err = cli.newReport(cli.reportFormat)
+		if err != nil {
+			return err
+		}
+	}
 
-	match, _ := re.FindStringMatch(content)
-	for match != nil {
-		// Group 0 is the entire match. Group 1 is the captured number string `(\d{3,})`.
-		// For this regex, match.String() and match.Groups()[1].String() are the same.
-		numStr := match.Groups()[1].String()
+	var events *eventStream
+	if cli.events {
+		events = newEventStream(os.Stderr)
+	}
 
-		// Append the part of the content string before the current match
-		resultBuilder.WriteString(content[currentIndex:match.Index])
+	// Determine output destination
+	var out io.Writer = os.Stdout // Default to standard output
+	var pending *bytes.Buffer     // Output held back for -if-changed
+	if cli.outputFile != "" && cli.ifChanged {
+		pending = &bytes.Buffer{}
+		out = pending
+	}
+	if cli.check || cli.list {
+		out = io.Discard // Only locations or file names are printed
+	}
 
-		bigNum, parseOk := new(big.Int).SetString(numStr, 10)
-		if !parseOk {
-			// This should ideally not happen with a \d{3,} regex.
-			log.Printf("Warning: Could not parse '%s' as a number. Writing original: \"%s\"", numStr, match.String())
-			resultBuilder.WriteString(match.String()) // Write the original full match
-		} else {
-			replaced := false
-			// Process only if the number is strictly greater than the threshold
-			if bigNum.Cmp(thresholdBigInt) > 0 {
-				// Try (2^n - 1) << m
-				canFormatMinusOne, formattedStrMinusOne := doraemon.FormatAsPowerOfTwoMinusOneShiftedBig(bigNum)
-				if canFormatMinusOne {
-					resultBuilder.WriteString(formattedStrMinusOne)
-					replaced = true
-				} else {
-					// If not replaced, try (2^n + 1) << m
-					canFormatPlusOne, formattedStrPlusOne := doraemon.FormatAsPowerOfTwoPlusOneShiftedBig(bigNum)
-					if canFormatPlusOne {
-						resultBuilder.WriteString(formattedStrPlusOne)
-						replaced = true
-					}
-				}
-			}
+	var dupes *duplicates // Set once the inputs left to process are known
 
-			if !replaced {
-				resultBuilder.WriteString(match.String()) // Write original number if no replacement or not over threshold
+	// Every worker has a Formatter of its own, so the callbacks collect the
+	// edits and findings of the file it is working on
+	newWorker := func() (*worker, error) {
+		w := &worker{header: cli.header, footer: cli.footer, buffered: cli.jobs > 1 && !cli.write && !cli.check && !cli.list, check: cli.check}
+		wopts := slices.Clone(opts)
+		if cli.editsFile != "" {
+			wopts = append(wopts, powershift.WithEditFunc(func(e powershift.Edit) {
+				w.proc.edits = append(w.proc.edits, e)
+			}))
+		}
+		wopts = append(wopts, powershift.WithWarningFunc(func(err error) {
+			logf("Warning: %s: %v", inputName(w.file), err)
+			if hint := powershift.Hint(err); hint != "" {
+				logf("Hint: %s", hint)
+			}
+		}))
+		if report != nil {
+			w.report = report.fork()
+		}
+		w.events = events
+		if report != nil || cli.check || events != nil {
+			wopts = append(wopts, powershift.WithResultFunc(func(res powershift.Result) {
+				if res.Replaced || res.Annotation != "" || cli.reportBits || cli.reportSuspicious && res.Skipped != "" || events != nil {
+					w.proc.results = append(w.proc.results, res)
+				}
+			}))
+		}
+		formatter, err := powershift.New(append(cli.formatterOptions(), wopts...)...)
+		if err != nil {
+			return nil, err
+		}
+		w.proc = processor{
+			formatter:   formatter,
+			out:         out,
+			inPlace:     cli.write,
+			strategy:    cli.writeStrategy,
+			links:       cli.links(),
+			skipSecrets: cli.skipSecrets,
+			streaming:   chunkSize > 0,
+			diff:        cli.diff,
+			dupes:       dupes,
+		}
+		w.proc.reconfigure = func(values []configValue) (*powershift.Formatter, error) {
+			var set []*flag.Flag
+			flag.Visit(func(f *flag.Flag) { set = append(set, f) })
+			c, err := flagsWith(set, values)
+			if err != nil {
+				return nil, err
 			}
+			return powershift.New(append(c.formatterOptions(), wopts...)...)
 		}
+		return w, nil
+	}
+	// Fail on bad formatter flags before anything is opened
+	w, err := newWorker()
+	if err != nil {
+		return err
+	}
 
-		currentIndex = match.Index + match.Length
-		match, _ = re.FindNextMatch(match)
+	if cli.clipboard {
+		if report != nil {
+			w.report.file = "clipboard"
+		}
+		if err := formatClipboard(w.proc.formatter); err != nil {
+			return err
+		}
+		w.collect()
+		if report != nil {
+			report.merge(w.report.findings)
+			return report.write(cli.reportFile)
+		}
+		return nil
 	}
 
-	// Append the rest of the content string after the last match (or the whole string if no matches)
-	resultBuilder.WriteString(content[currentIndex:])
+	// Open the progress journal of a resumable batch
+	var journal *batchJournal
+	if cli.stateFile != "" || cli.resume {
+		stateFile := cli.stateFile
+		if stateFile == "" {
+			stateFile = defaultStateFile
+		}
+		journal, err = openJournal(stateFile, cli.resume)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+	}
 
-	// Determine output destination and write the result
-	var out io.Writer = os.Stdout // Default to standard output
-	if *outputFile != "" {
-		file, err := os.Create(*outputFile) // Create or truncate the output file
+	if cli.outputFile != "" && !cli.ifChanged {
+		file, err := os.Create(cli.outputFile) // Create or truncate the output file
 		if err != nil {
-			log.Fatalf("Failed to create output file %s: %v", *outputFile, err)
+			return writeError("create", cli.outputFile, err)
 		}
 		defer file.Close()
 		out = file
 	}
 
-	_, err = fmt.Fprint(out, resultBuilder.String())
+	var sum totals
+	if cli.summaryJSON {
+		start := time.Now()
+		defer func() { writeSummary(os.Stderr, sum, time.Since(start), err) }()
+	}
+	var todo []string
+	for _, filePath := range inputs {
+		if journal.Done(filePath) {
+			logf("Skipping %s (already completed)", filePath)
+			events.emit(event{Event: eventSkip, File: inputName(filePath), Reason: "already completed"})
+			continue
+		}
+		todo = append(todo, filePath)
+	}
+	if cli.preflight {
+		formatter, err := powershift.New(append(cli.formatterOptions(), opts...)...)
+		if err != nil {
+			return err
+		}
+		if err := preflight(todo, formatter, cli.writeStrategy, cli.links()); err != nil {
+			return err
+		}
+	}
+	if chunkSize == 0 {
+		dupes = findDuplicates(todo)
+	}
+	var editMaps []editMap
+	rewrites := 0 // Numbers -check found
+	failing := 0  // Those of them at -fail-on or above
+	failed := 0   // Inputs of a batch that could not be processed
+	err = processAll(todo, cli.jobs, newWorker, func(filePath string, res fileResult) error {
+		if res.err != nil && len(todo) == 1 {
+			return res.err
+		}
+		if res.err != nil {
+			// One bad file does not stop a batch; it is left out of the
+			// results and the journal, so that -resume retries it
+			logf("Skipping %s: %v", filePath, res.err)
+			if hint := powershift.Hint(res.err); hint != "" {
+				logf("Hint: %s", hint)
+			}
+			failed++
+			sum.Failed++
+			return nil
+		}
+		if res.output != nil {
+			if _, err := out.Write(res.output.Bytes()); err != nil {
+				return writeError("write", cli.outputFile, err)
+			}
+		}
+		name := inputName(filePath)
+		for _, r := range res.rewrites {
+			severity := cli.severityOf(r)
+			level := ""
+			if cli.severityAware() {
+				level = severity + ": "
+			}
+			output := r.Output
+			if r.Annotation != "" {
+				output += " with the note " + r.Annotation
+			}
+			if _, err := fmt.Printf("%s:%d:%d: %s%s -> %s\n", name, r.Line, r.Column, level, r.Text, output); err != nil {
+				return writeError("write", "", err)
+			}
+			if cli.fails(severity) {
+				failing++
+			}
+		}
+		rewrites += len(res.rewrites)
+		if cli.list && res.totals.Replaced+res.totals.Annotated > 0 {
+			if _, err := fmt.Println(name); err != nil {
+				return writeError("write", "", err)
+			}
+		}
+		sum.merge(res.totals)
+		sum.Files++
+		if res.skipped {
+			sum.Skipped++
+		} else {
+			editMaps = append(editMaps, editMap{Input: filePath, Edits: res.edits})
+		}
+		if report != nil {
+			report.merge(res.findings)
+		}
+		return journal.Record(filePath)
+	})
 	if err != nil {
-		log.Fatalf("Failed to write output: %v", err)
+		return err
+	}
+
+	written := true
+	if pending != nil {
+		if written, err = writeIfChanged(cli.outputFile, pending.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	// Write the edit map next to the output
+	if cli.editsFile != "" {
+		var v any = editMaps
+		if len(inputs) == 1 && len(editMaps) == 1 {
+			v = editMaps[0]
+		}
+		if editMaps == nil {
+			v = []editMap{}
+		}
+		if err := writeJSONFile(cli.editsFile, v); err != nil {
+			return err
+		}
+	}
+
+	if report != nil {
+		if err := report.write(cli.reportFile); err != nil {
+			return err
+		}
+	}
+
+	if cache != nil {
+		if err := saveCacheFile(cli.cacheFile, cache); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be processed; see the errors above", failed, len(todo))
+	}
+
+	// The batch is complete, nothing is left to resume
+	if err := journal.Finish(); err != nil {
+		return err
+	}
+
+	if failing > 0 && failing < rewrites {
+		return fmt.Errorf("found %d numbers that would be rewritten, %d of severity %s or above; run without -check to rewrite them",
+			rewrites, failing, cli.failOn)
+	}
+	if failing > 0 {
+		return fmt.Errorf("found %d numbers that would be rewritten; run without -check to rewrite them", rewrites)
 	}
 
 	// Log success if writing to a file
-	if *outputFile != "" {
-		log.Printf("Successfully processed %s and wrote output to %s", *inputFile, *outputFile)
+	if cli.outputFile != "" && !written {
+		logf("%s is already up to date", cli.outputFile)
+	} else if cli.outputFile != "" {
+		logf("Successfully processed %s and wrote output to %s", inputName(inputs[0]), cli.outputFile)
+	}
+	return nil
+}
+
+// writeIfChanged writes data to path unless the file already holds exactly
+// that, so its modification time only moves when the content does.
+func writeIfChanged(path string, data []byte) (written bool, err error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return false, nil
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return false, writeError("write", path, err)
+	}
+	return true, nil
+}
+
+// summary is the line -summary-json writes to stderr when a run ends.
+type summary struct {
+	totals
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// writeSummary writes the totals of a run as a single line of JSON, so that
+// wrappers can pick it out of the log output.
+func writeSummary(w io.Writer, t totals, d time.Duration, err error) {
+	s := summary{totals: t, DurationMS: d.Milliseconds()}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	line, _ := json.Marshal(s)
+	fmt.Fprintf(w, "%s\n", line)
+}
+
+// editMap is the on-disk format of the -edits file. A batch of several
+// inputs is written as an array of editMaps.
+type editMap struct {
+	Input string            `json:"input"`
+	Edits []powershift.Edit `json:"edits"`
+}
+
+// writeJSONFile saves v as indented JSON. HTML escaping is off so that
+// expressions keep their literal "<<".
+func writeJSONFile(path string, v any) error {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return writeError("write", path, err)
+	}
+	return nil
+}
+
+// readError classifies a failure to open or read an input file.
+func readError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return powershift.NewError(powershift.ErrInputNotFound, "open", path, err,
+			"check the input path; relative paths are resolved against the current directory")
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return powershift.NewError(powershift.ErrReadFailed, "open", path, err,
+			"make sure the file is readable by the current user")
+	}
+	return powershift.NewError(powershift.ErrReadFailed, "read", path, err, "")
+}
+
+// writeError classifies a failure to create or write the output.
+func writeError(op, path string, err error) error {
+	if path == "" {
+		path = "stdout"
+	}
+	hint := "check that the destination directory exists and has free space"
+	if errors.Is(err, fs.ErrPermission) {
+		hint = "make sure the destination is writable by the current user"
+	}
+	return powershift.NewError(powershift.ErrWriteFailed, op, path, err, hint)
+}
+
+// chunkSizeForLimit picks a streaming read size that leaves plenty of headroom
+// under the memory limit for the rune conversion and the formatted copy.
+func chunkSizeForLimit(limit int64) int {
+	size := limit / 16
+	if size < minChunkSize {
+		size = minChunkSize
+	}
+	if size > maxChunkSize {
+		size = maxChunkSize
+	}
+	return int(size)
+}
+
+// parseByteSize parses sizes such as "512MiB", "2G", "64k" or a plain byte count.
+// Both decimal (KB, MB, GB) and binary (KiB, MiB, GiB) suffixes are accepted.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+		{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+		{"b", 1},
+	}
+	lower := strings.ToLower(s)
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			mult = u.mult
+			lower = strings.TrimSpace(strings.TrimSuffix(lower, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive size like 512MiB")
+	}
+	if n > (1<<63-1)/mult {
+		return 0, fmt.Errorf("size overflows int64")
 	}
+	return n * mult, nil
 }
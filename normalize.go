@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// runNormalize implements the "normalize" subcommand: it rewrites the
+// numeric literals of a tree in one style, without introducing expressions,
+// and reports the literals it would change unless -fix is given. It accepts
+// the formatter flags.
+func runNormalize(args []string) error {
+	fs := flag.NewFlagSet("normalize", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: PowerShiftFormatter normalize [flags] FILE|DIR...\n")
+		fs.PrintDefaults()
+	}
+	hexCase := fs.String("hex-case", string(powershift.HexUpper), "Case of hex digits: upper, lower or keep")
+	digits := fs.String("digits", "keep", "Digit grouping of decimal literals: grouped, plain or keep, which only fixes misplaced separators")
+	stripZeros := fs.Bool("strip-zeros", false, "Remove leading zeros from hex literals")
+	fix := fs.Bool("fix", false, "Rewrite the files instead of reporting the literals that would change")
+	cli := defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "normalize", err, "")
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "normalize", "", "no files given")
+	}
+	if err := checkWriteStrategy(cli.writeStrategy); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-write-strategy", err, "")
+	}
+	style := powershift.NormalizeOptions{StripZeros: *stripZeros}
+	switch *hexCase {
+	case "upper", "lower":
+		style.Hex = powershift.HexCase(*hexCase)
+	case "keep":
+	default:
+		return powershift.Errorf(powershift.ErrInvalidOption, "parse", "-hex-case", "use upper, lower or keep",
+			"unknown hex case %q", *hexCase)
+	}
+	switch *digits {
+	case "grouped", "plain":
+		style.Grouping = powershift.Grouping(*digits)
+	case "keep":
+	default:
+		return powershift.Errorf(powershift.ErrInvalidOption, "parse", "-digits", "use grouped, plain or keep",
+			"unknown digit grouping %q", *digits)
+	}
+
+	paths, err := expandInputs(fs.Args(), nil, nil)
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return readError(path, err)
+		}
+		if isBinary(data) || documentKind(path) != nil {
+			continue
+		}
+		fileCli := *cli
+		fileCli.lang = languageFor(path, cli.lang)
+		formatter, err := powershift.New(fileCli.formatterOptions()...)
+		if err != nil {
+			return err
+		}
+		_, edits := formatter.Normalize(string(data), style)
+		if len(edits) == 0 {
+			continue
+		}
+		changed += len(edits)
+		if *fix {
+			if err := applyEdits(path, edits, cli.writeStrategy); err != nil {
+				return err
+			}
+			logf("Normalized %d literals in %s", len(edits), path)
+			continue
+		}
+		for _, e := range edits {
+			line, col := lineCol(data, e.Offset)
+			fmt.Printf("%s:%d:%d: %s -> %s\n", path, line, col, e.Original, e.Replacement)
+		}
+	}
+	if changed > 0 && !*fix {
+		return fmt.Errorf("found %d literals not in the normalized style; -fix rewrites them", changed)
+	}
+	return nil
+}
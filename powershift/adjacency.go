@@ -0,0 +1,98 @@
+package powershift
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AdjacencyFunc reports whether a digit run is glued to the text around it,
+// in which case it is not a standalone number and is left alone. before holds
+// up to the context window of characters preceding the run and after up to as
+// many following it; both are shorter at the start and end of the input.
+// The digit runs themselves are maximal, so before never ends with a digit
+// and after never starts with one.
+type AdjacencyFunc func(before, after string) bool
+
+// DefaultContextWindow is the number of characters on either side of a digit
+// run that an AdjacencyFunc sees when WithContextWindow is not given.
+const DefaultContextWindow = 1
+
+// AlnumAdjacent is the default adjacency rule: a digit run is glued to its
+// surroundings when an ASCII letter or digit directly precedes or follows it,
+// as in v1234 or 1234px.
+func AlnumAdjacent(before, after string) bool {
+	if r, _ := utf8.DecodeLastRuneInString(before); r < utf8.RuneSelf && isASCIIAlnum(byte(r)) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(after)
+	return r < utf8.RuneSelf && isASCIIAlnum(byte(r))
+}
+
+// WordAdjacent glues a digit run to any letter, digit or underscore, in any
+// script, so that identifiers such as BUF_1048576 are left alone as well.
+func WordAdjacent(before, after string) bool {
+	r, _ := utf8.DecodeLastRuneInString(before)
+	if isWordRune(r) {
+		return true
+	}
+	r, _ = utf8.DecodeRuneInString(after)
+	return isWordRune(r)
+}
+
+// WhitespaceAdjacent only accepts digit runs that stand between whitespace or
+// the ends of the input, as in prose and log messages.
+func WhitespaceAdjacent(before, after string) bool {
+	if r, _ := utf8.DecodeLastRuneInString(before); before != "" && !unicode.IsSpace(r) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(after)
+	return after != "" && !unicode.IsSpace(r)
+}
+
+// PatternAdjacent glues a digit run to the text before it when that matches
+// before, and to the text after it when that matches after. Either may be nil
+// to never glue on that side. PatternAdjacent(nil, nil) accepts every digit
+// run, including the 1048576 of 1048576KB.
+func PatternAdjacent(before, after *regexp.Regexp) AdjacencyFunc {
+	return func(b, a string) bool {
+		return before != nil && b != "" && before.MatchString(b) ||
+			after != nil && a != "" && after.MatchString(a)
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// glued applies the adjacency rule to runes[start:end]. Context before the
+// start of the segment comes from the previous one; context after its end
+// comes from the input held back by the streaming scanner.
+func (p *pass) glued(runes []rune, start, end int) bool {
+	w := p.f.opts.window
+	from := max(start-w, 0)
+	before := string(runes[from:start])
+	if missing := w - (start - from); missing > 0 && len(p.before) > 0 {
+		before = string(p.before[max(len(p.before)-missing, 0):]) + before
+	}
+	to := min(end+w, len(runes))
+	after := string(runes[end:to])
+	if missing := w - (to - end); missing > 0 {
+		after += string(p.tail[:min(missing, len(p.tail))])
+	}
+	return p.f.opts.adjacent(before, after)
+}
+
+// keepContext remembers the last context window of characters of a finished
+// segment for the digit runs at the start of the next one.
+func (p *pass) keepContext(runes []rune) {
+	w := p.f.opts.window
+	if len(runes) >= w {
+		p.before = append(p.before[:0], runes[len(runes)-w:]...)
+		return
+	}
+	p.before = append(p.before, runes...)
+	if len(p.before) > w {
+		p.before = p.before[len(p.before)-w:]
+	}
+}
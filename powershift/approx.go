@@ -0,0 +1,100 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ApproxMode selects how WithApproximation writes a number that is close to
+// a power of two.
+type ApproxMode string
+
+const (
+	ApproxAnnotate ApproxMode = "annotate" // 1<<20 /* ≈ 1050000 */, which changes the value
+	ApproxAdjust   ApproxMode = "adjust"   // 1<<20 + 1424, which keeps it
+)
+
+// ApproxModeNames lists the supported approximation modes.
+func ApproxModeNames() []ApproxMode {
+	return []ApproxMode{ApproxAnnotate, ApproxAdjust}
+}
+
+// ParseApproxMode converts a name such as "adjust" into an ApproxMode.
+func ParseApproxMode(name string) (ApproxMode, error) {
+	for _, m := range ApproxModeNames() {
+		if string(m) == name {
+			return m, nil
+		}
+	}
+	return "", Errorf(ErrInvalidOption, "parse", "approximation mode", fmt.Sprintf("known modes are %v", ApproxModeNames()),
+		"unknown approximation mode %q", name)
+}
+
+// WithApproximation rewrites numbers that none of the forms decomposes but
+// that lie within tolerance, a fraction of the number such as 0.001, of a
+// power of two. ApproxAnnotate writes the power with the number in a comment,
+// for documentation where the round figure matters more than the exact one;
+// ApproxAdjust adds the difference so that the value is kept.
+func WithApproximation(tolerance float64, mode ApproxMode) Option {
+	return func(o *options) error {
+		if tolerance <= 0 || tolerance >= 1 {
+			return Errorf(ErrInvalidOption, "set", "approximation", "use a fraction such as 0.001 for 0.1%",
+				"the tolerance %g is not between 0 and 1", tolerance)
+		}
+		if _, err := ParseApproxMode(string(mode)); err != nil {
+			return err
+		}
+		o.approx, o.approxMode = tolerance, mode
+		return nil
+	}
+}
+
+// nearestPower returns the power of two closest to num, ties going to the
+// smaller one, and num minus that power.
+func nearestPower(num *big.Int) (n int, delta *big.Int) {
+	n = num.BitLen() - 1
+	delta = new(big.Int).Sub(num, new(big.Int).Lsh(big.NewInt(1), uint(n)))
+	above := new(big.Int).Sub(num, new(big.Int).Lsh(big.NewInt(1), uint(n+1)))
+	if new(big.Int).Neg(above).Cmp(delta) < 0 {
+		return n + 1, above
+	}
+	return n, delta
+}
+
+// approximate proposes the power of two closest to m, if it is within the
+// tolerance of WithApproximation.
+func (f *Formatter) approximate(m *Match) (expr, note string) {
+	if f.opts.approx == 0 || m.Value.Sign() <= 0 {
+		return "", ""
+	}
+	n, delta := nearestPower(m.Value)
+	off, _ := new(big.Float).Quo(new(big.Float).SetInt(new(big.Int).Abs(delta)), new(big.Float).SetInt(m.Value)).Float64()
+	if off > f.opts.approx {
+		return "", ""
+	}
+	c := Candidate{Form: FormPower, N: n}
+	expr = f.render(c, m.IntType)
+	if expr == "" {
+		return "", "" // Not representable in the integer type of m
+	}
+	if delta.Sign() != 0 && f.opts.approxMode == ApproxAdjust {
+		expr = strings.Replace(expr, " << ", "<<", 1) // 1<<20 + 1424, as the plus-one form writes it
+		if f.opts.profile.LowShiftPrecedence && !isAtom(expr) {
+			expr = "(" + expr + ")"
+		}
+		op := "+"
+		if delta.Sign() < 0 {
+			op = "-"
+		}
+		expr = fmt.Sprintf("%s %s %s", expr, op, new(big.Int).Abs(delta))
+	}
+	expr, _ = f.emitCandidate(m, c, expr, EmitShift)
+	if expr == "" || delta.Sign() == 0 || f.opts.approxMode == ApproxAdjust {
+		return expr, ""
+	}
+	if p := f.opts.profile; p.BlockComment[0] != "" {
+		return fmt.Sprintf("%s %s ≈ %s %s", expr, p.BlockComment[0], digitsOf(m.Text), p.BlockComment[1]), ""
+	}
+	return expr, "≈ " + digitsOf(m.Text)
+}
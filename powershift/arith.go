@@ -0,0 +1,92 @@
+package powershift
+
+import "strings"
+
+// Characters that make a neighboring literal an operand of an arithmetic or
+// bitwise operator. Shifts (<< and >>) are recognized by their second
+// character, so plain comparisons with < and > are not.
+const (
+	operatorsBefore = "+-*/%&|^~"
+	operatorsAfter  = "+-*/%&|^"
+)
+
+// arithmeticOperand reports whether the literal at runes[start:end] is, apart
+// from spaces and tabs, directly next to an arithmetic operator.
+func arithmeticOperand(runes []rune, start, end int) bool {
+	i := start - 1
+	for i >= 0 && (runes[i] == ' ' || runes[i] == '\t') {
+		i--
+	}
+	if i >= 0 && (strings.ContainsRune(operatorsBefore, runes[i]) && !isCommentStart(runes, i-1) || isShift(runes, i-1)) {
+		return true
+	}
+	j := end
+	for j < len(runes) && (runes[j] == ' ' || runes[j] == '\t') {
+		j++
+	}
+	return j < len(runes) && (strings.ContainsRune(operatorsAfter, runes[j]) && !isCommentStart(runes, j) && !isCommentEnd(runes, j) || isShift(runes, j))
+}
+
+// isCommentStart reports whether runes[i:] starts with // or /*, which are
+// comments rather than a division.
+func isCommentStart(runes []rune, i int) bool {
+	return i >= 0 && i+1 < len(runes) && runes[i] == '/' && (runes[i+1] == '/' || runes[i+1] == '*')
+}
+
+// isCommentEnd reports whether runes[i:] starts with */, which closes a
+// comment rather than multiplying.
+func isCommentEnd(runes []rune, i int) bool {
+	return i+1 < len(runes) && runes[i] == '*' && runes[i+1] == '/'
+}
+
+// isShift reports whether runes[i:i+2] is << or >>.
+func isShift(runes []rune, i int) bool {
+	return i >= 0 && i+1 < len(runes) && (runes[i] == '<' || runes[i] == '>') && runes[i+1] == runes[i]
+}
+
+// isNumeral reports whether expr is a plain number that needs no parentheses.
+func isNumeral(expr string) bool {
+	for i := 0; i < len(expr); i++ {
+		if expr[i] < '0' || expr[i] > '9' {
+			return false
+		}
+	}
+	return expr != ""
+}
+
+// isAtom reports whether expr needs no parentheses as an operand: a plain
+// number, a name such as u32::MAX or Long.MAX_VALUE, or an expression such as
+// BIT(20) or (BIT(17) | BIT(1)) that ends in the parenthesis closing its first
+// one.
+func isAtom(expr string) bool {
+	if isNumeral(expr) {
+		return true
+	}
+	if typ, name, ok := strings.Cut(expr, "::"); ok && isWord(typ) && isWord(name) {
+		return true
+	}
+	if typ, name, ok := strings.Cut(expr, "."); ok && isWord(typ) && isWord(name) {
+		return true
+	}
+	i := strings.IndexByte(expr, '(')
+	if i < 0 || i > 0 && !isWord(expr[:i]) {
+		return false
+	}
+	depth := 0
+	for j := i; j < len(expr); j++ {
+		switch expr[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return j == len(expr)-1
+			}
+		}
+	}
+	return false
+}
+
+// isWord reports whether s is a non-empty run of word characters.
+func isWord(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !isWordRune(r) }) < 0
+}
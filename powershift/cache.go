@@ -0,0 +1,161 @@
+package powershift
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Cache memoizes decompositions so that values seen before are not
+// decomposed again. One Cache can be shared by any number of Formatters,
+// including ones with different forms, and is safe for concurrent use.
+type Cache struct {
+	mu      sync.RWMutex
+	max     int
+	entries map[string]cacheEntry
+	hits    int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	c  Candidate
+	ok bool // Whether the value has a decomposition at all
+}
+
+// NewCache returns a cache holding up to size decompositions. When it is
+// full, arbitrary entries are evicted to make room.
+func NewCache(size int) *Cache {
+	return &Cache{max: size, entries: make(map[string]cacheEntry)}
+}
+
+// CacheStats reports how well a cache is working.
+type CacheStats struct {
+	Entries int
+	Hits    int64
+	Misses  int64
+}
+
+// Stats returns the current size and hit counts of c.
+func (c *Cache) Stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CacheStats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+// WithCache makes the Formatter look up and record decompositions in c.
+func WithCache(c *Cache) Option {
+	return func(o *options) error {
+		o.cache = c
+		return nil
+	}
+}
+
+// cacheKey identifies the decomposition of num under the given forms, in
+// order, with the settings of o.
+func cacheKey(forms []Form, o *options, num *big.Int) string {
+	var sb strings.Builder
+	for _, f := range forms {
+		sb.WriteString(o.formKey(f))
+		sb.WriteByte(',')
+	}
+	sb.WriteString(num.String())
+	return sb.String()
+}
+
+func (c *Cache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return e, ok
+}
+
+func (c *Cache) put(key string, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max <= 0 {
+		return
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.max {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = e
+}
+
+// cacheFile is the on-disk form of a Cache. Entries are [key, form, n, m],
+// with an empty form for values that have no decomposition, and the terms
+// as a fifth element for the sum-of-powers form.
+type cacheFile struct {
+	Version int                  `json:"version"`
+	Entries [][5]json.RawMessage `json:"entries"`
+}
+
+// Save writes the entries of c to w, tagged with StrategyVersion.
+func (c *Cache) Save(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\"version\":%d,\"entries\":[", StrategyVersion)
+	first := true
+	for k, e := range c.entries {
+		var form Form
+		if e.ok {
+			form = e.c.Form
+		}
+		key, _ := json.Marshal(k)
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		fmt.Fprintf(bw, "\n[%s,%q,%d,%d", key, form, e.c.N, e.c.M)
+		if e.c.Terms != nil {
+			terms, _ := json.Marshal(e.c.Terms)
+			fmt.Fprintf(bw, ",%s", terms)
+		}
+		bw.WriteByte(']')
+	}
+	bw.WriteString("\n]}\n")
+	if err := bw.Flush(); err != nil {
+		return writeFailed(err)
+	}
+	return nil
+}
+
+// LoadCache reads a cache written by Save into a new cache of the given size.
+// A cache saved under another StrategyVersion may hold decompositions the
+// current strategies would not produce; LoadCache then returns an empty cache
+// and an error matching ErrCacheStale.
+func LoadCache(r io.Reader, size int) (*Cache, error) {
+	c := NewCache(size)
+	var file cacheFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return c, NewError(ErrReadFailed, "load", "cache", err, "")
+	}
+	if file.Version != StrategyVersion {
+		return c, Errorf(ErrCacheStale, "load", "cache", "",
+			"written by strategy version %d, this is version %d", file.Version, StrategyVersion)
+	}
+	for _, raw := range file.Entries {
+		var key string
+		var e cacheEntry
+		if json.Unmarshal(raw[0], &key) != nil || json.Unmarshal(raw[1], &e.c.Form) != nil ||
+			json.Unmarshal(raw[2], &e.c.N) != nil || json.Unmarshal(raw[3], &e.c.M) != nil ||
+			raw[4] != nil && json.Unmarshal(raw[4], &e.c.Terms) != nil {
+			return NewCache(size), Errorf(ErrReadFailed, "load", "cache", "", "malformed entry")
+		}
+		e.ok = e.c.Form != ""
+		c.put(key, e)
+	}
+	return c, nil
+}
@@ -0,0 +1,286 @@
+// Package client talks to a running "PowerShiftFormatter daemon" and starts
+// one if needed, so editor plugins do not have to manage the process
+// themselves.
+//
+// # Protocol
+//
+// The daemon listens on a Unix domain socket (on Windows, an AF_UNIX socket,
+// supported since Windows 10 1803). Every message in either direction is a
+// frame: a 4-byte big-endian length followed by that many bytes of UTF-8 JSON.
+// Frames larger than MaxFrame are rejected.
+//
+// The client sends Request objects and the daemon answers each with a
+// Response carrying the same ID, in the order the requests were sent. A
+// connection can be kept open for any number of requests. The methods are:
+//
+//	format    params FormatParams, result FormatResult
+//	ping      no params, result {"version": "..."}
+//	stats     no params, result Stats
+//	shutdown  no params, result {"ok": true}; the daemon then exits
+//
+// A failed request has Error set instead of Result.
+//
+// Plugins in other languages only need to implement the framing; the JSON
+// documents are the same.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MaxFrame is the largest JSON document a frame may carry.
+const MaxFrame = 64 << 20
+
+// Request is a message to the daemon.
+type Request struct {
+	ID     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers the Request with the same ID.
+type Response struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// Error is a failure reported by the daemon.
+type Error struct {
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"` // What the user can do about it
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// FormatParams are the parameters of the format method. Path names the file
+// the text belongs to; the daemon uses it to find the project's config file
+// and the language but does not read it. It may be empty.
+type FormatParams struct {
+	Path string `json:"path,omitempty"`
+	Text string `json:"text"`
+}
+
+// FormatResult is the result of the format method.
+type FormatResult struct {
+	Text     string `json:"text"`
+	Matches  int    `json:"matches"`
+	Replaced int    `json:"replaced"`
+}
+
+// Stats is the result of the stats method.
+type Stats struct {
+	Formatters   int   `json:"formatters"` // Warm Formatters, one per project and language
+	CacheEntries int   `json:"cache_entries"`
+	CacheHits    int64 `json:"cache_hits"`
+	CacheMisses  int64 `json:"cache_misses"`
+}
+
+// ReadFrame reads one frame from r and decodes its JSON into v.
+func ReadFrame(r io.Reader, v any) error {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return err
+	}
+	if n > MaxFrame {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d", n, MaxFrame)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// WriteFrame encodes v as JSON and writes it to w as one frame.
+func WriteFrame(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxFrame {
+		return fmt.Errorf("message of %d bytes exceeds the limit of %d", len(data), MaxFrame)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// DefaultSocketPath is where the daemon listens when started without -socket.
+func DefaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "powershift.sock")
+	}
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, "PowerShiftFormatter", "daemon.sock")
+		}
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("powershift-%d.sock", os.Getuid()))
+}
+
+// Client is a connection to the daemon. It is safe for concurrent use;
+// requests are sent one at a time.
+type Client struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	nextID int64
+}
+
+// Dial connects to the daemon listening on socket.
+func Dial(socket string) (*Client, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// StartOptions control how DialOrStart launches a daemon.
+type StartOptions struct {
+	// Binary is the PowerShiftFormatter executable, looked up in PATH when empty.
+	Binary string
+	// Args are extra daemon flags, e.g. "-idle-timeout", "10m".
+	Args []string
+	// Timeout bounds how long to wait for a new daemon to listen (default 5s).
+	Timeout time.Duration
+}
+
+// DialOrStart connects to the daemon on socket, first starting one in the
+// background if none is listening. The started daemon outlives the caller and
+// exits on its own after its idle timeout.
+func DialOrStart(ctx context.Context, socket string, opts StartOptions) (*Client, error) {
+	if c, err := Dial(socket); err == nil {
+		return c, nil
+	}
+	binary := opts.Binary
+	if binary == "" {
+		binary = "PowerShiftFormatter"
+	}
+	args := append([]string{"daemon", "-socket", socket}, opts.Args...)
+	cmd := exec.Command(binary, args...)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-exited:
+			// Another client may have won the race to start a daemon
+			if c, dialErr := Dial(socket); dialErr == nil {
+				return c, nil
+			}
+			return nil, fmt.Errorf("daemon exited: %v", err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("daemon did not start listening on %s: %w", socket, ctx.Err())
+		case <-tick.C:
+			if c, err := Dial(socket); err == nil {
+				return c, nil
+			}
+		}
+	}
+}
+
+// Close closes the connection; the daemon keeps running.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call sends a request and decodes the result into result, which may be nil.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	req := Request{Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	req.ID = c.nextID
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	if err := WriteFrame(c.conn, req); err != nil {
+		return err
+	}
+	var resp Response
+	if err := ReadFrame(c.r, &resp); err != nil {
+		return err
+	}
+	if resp.ID != req.ID {
+		return fmt.Errorf("response %d does not match request %d", resp.ID, req.ID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil || resp.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Format formats text as the daemon would format the file at path.
+func (c *Client) Format(ctx context.Context, path, text string) (FormatResult, error) {
+	var res FormatResult
+	err := c.Call(ctx, "format", FormatParams{Path: path, Text: text}, &res)
+	return res, err
+}
+
+// Ping returns the daemon's version.
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	var res struct {
+		Version string `json:"version"`
+	}
+	err := c.Call(ctx, "ping", nil, &res)
+	return res.Version, err
+}
+
+// Stats returns the daemon's cache statistics.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var res Stats
+	err := c.Call(ctx, "stats", nil, &res)
+	return res, err
+}
+
+// Shutdown asks the daemon to exit.
+func (c *Client) Shutdown(ctx context.Context) error {
+	err := c.Call(ctx, "shutdown", nil, nil)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
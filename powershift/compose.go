@@ -0,0 +1,102 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Compose is the inverse of decomposition: it returns the value of form with
+// the exponent n and the shift m, times coeff unless it is nil, along with its
+// expression in the default language, as in Compose(FormMinusOne, 10, 3, nil)
+// = 8184, "(1<<10 - 1) << 3". Tools that generate constants, such as register
+// map generators, can use it to write them the way the Formatter would. The
+// decimal forms, which the default language has no operator for, are written
+// as 10^6. For FormSumOfPowers, n and m are the exponents of the two terms,
+// as in Compose(FormSumOfPowers, 20, 4, nil) = 1048592, "1<<20 + 1<<4",
+// and the same goes for FormDifferenceOfPowers, which needs n > m + 1. For
+// FormMultiple, m is the odd multiplier, as in Compose(FormMultiple, 18, 3,
+// nil) = 786432, "3 << 18". A negative n or m, a shift for a decimal form,
+// equal terms, an even multiplier or an unknown form gives nil and "".
+func Compose(form Form, n, m int, coeff *big.Int) (*big.Int, string) {
+	c, v, ok := compose(form, n, m)
+	if !ok {
+		return nil, ""
+	}
+	expr := Render(c, profiles[DefaultProfile])
+	if decimal(form) {
+		expr = powerEmitter("^").Emit(c, profiles[DefaultProfile])
+	}
+	return scale(v, expr, coeff)
+}
+
+// Compose is the package-level Compose in the language and emitter of f. It
+// gives nil and "" as well for a value f cannot write, such as one wider than
+// the integer types of its language.
+func (f *Formatter) Compose(form Form, n, m int, coeff *big.Int) (*big.Int, string) {
+	c, v, ok := compose(form, n, m)
+	if !ok || decimal(form) && f.emitter() == nil && f.opts.profile.Power == "" {
+		return nil, ""
+	}
+	expr := f.render(c, f.opts.intType)
+	if expr == "" {
+		return nil, ""
+	}
+	return scale(v, expr, coeff)
+}
+
+// compose returns the candidate of form with the exponent n and the shift m,
+// and its value.
+func compose(form Form, n, m int) (Candidate, *big.Int, bool) {
+	if n < 0 || m < 0 || decimal(form) && m > 0 {
+		return Candidate{}, nil, false
+	}
+	pow := func(base int64, n int) *big.Int {
+		return new(big.Int).Exp(big.NewInt(base), big.NewInt(int64(n)), nil)
+	}
+	one := big.NewInt(1)
+	c := Candidate{Form: form, N: n, M: m}
+	var v *big.Int
+	switch form {
+	case FormPower:
+		c = Candidate{Form: FormPower, N: n + m} // 2^n << m is 2^(n+m)
+		v = pow(2, n)
+	case FormMinusOne:
+		v = pow(2, n).Sub(pow(2, n), one)
+	case FormPlusOne:
+		v = pow(2, n).Add(pow(2, n), one)
+	case FormSumOfPowers:
+		if n == m {
+			return Candidate{}, nil, false
+		}
+		c = Candidate{Form: form, N: max(n, m), M: min(n, m), Terms: []int{max(n, m), min(n, m)}}
+		return c, new(big.Int).Add(pow(2, n), pow(2, m)), true
+	case FormMultiple:
+		if m < 3 || m%2 == 0 {
+			return Candidate{}, nil, false
+		}
+		return c, new(big.Int).Lsh(big.NewInt(int64(m)), uint(n)), true
+	case FormDifferenceOfPowers:
+		if n <= m+1 {
+			return Candidate{}, nil, false
+		}
+		return c, new(big.Int).Sub(pow(2, n), pow(2, m)), true
+	case FormPowerOfTen:
+		v = pow(10, n)
+	case FormTenMinusOne:
+		v = pow(10, n).Sub(pow(10, n), one)
+	default:
+		return Candidate{}, nil, false
+	}
+	return c, v.Lsh(v, uint(m)), true
+}
+
+// scale multiplies the value v, written as expr, by coeff unless it is nil.
+func scale(v *big.Int, expr string, coeff *big.Int) (*big.Int, string) {
+	if coeff == nil || coeff.Cmp(big.NewInt(1)) == 0 {
+		return v, expr
+	}
+	if !isAtom(expr) {
+		expr = "(" + expr + ")"
+	}
+	return v.Mul(v, coeff), fmt.Sprintf("%v * %s", coeff, expr)
+}
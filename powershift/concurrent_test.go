@@ -0,0 +1,59 @@
+package powershift_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift/powershifttest"
+)
+
+// concurrentInputs returns short and long inputs, one with a header and an
+// empty one, so goroutines finish at different times.
+func concurrentInputs() []string {
+	var table strings.Builder
+	for i := 10; i < 62; i++ {
+		fmt.Fprintf(&table, "\t%d, %d, %d,\n", 1<<i, 1<<i-1, 1<<i+1)
+	}
+	return []string{
+		"mask := 65535\n",
+		"size := 1048576 // 1 MiB\n",
+		"var table = []uint64{\n" + table.String() + "}\n",
+		"#!/bin/sh 1048576\nlimit=4294967295\n",
+		"",
+	}
+}
+
+func TestFormatterConcurrent(t *testing.T) {
+	inputs := concurrentInputs()
+	var mu sync.Mutex
+	replaced := 0
+	count := powershift.WithResultFunc(func(r powershift.Result) {
+		if r.Replaced {
+			mu.Lock()
+			replaced++
+			mu.Unlock()
+		}
+	})
+	configs := map[string][]powershift.Option{
+		"default":   nil,
+		"go":        {powershift.WithLanguage("go"), count},
+		"cached":    {powershift.WithLanguage("go"), powershift.WithCache(powershift.NewCache(16))},
+		"streamed":  {powershift.WithLanguage("go"), powershift.WithChunkSize(64)},
+		"both":      {powershift.WithLanguage("c"), powershift.WithEmit(powershift.EmitBoth)},
+		"reverse":   {powershift.WithLanguage("go"), powershift.WithReverse(false)},
+		"scored":    {powershift.WithLanguage("rust"), powershift.WithScoring(powershift.ScoreShortest)},
+		"sampled":   {powershift.WithSample(0.5)},
+		"max-terms": {powershift.WithMaxTerms(4)},
+	}
+	for name, opts := range configs {
+		t.Run(name, func(t *testing.T) {
+			powershifttest.AssertConcurrent(t, 8, inputs, opts...)
+		})
+	}
+	if replaced == 0 {
+		t.Error("the result function was never called")
+	}
+}
@@ -0,0 +1,81 @@
+package powershift
+
+import (
+	"bytes"
+	"strings"
+)
+
+// continuedNumberPattern is numberPattern for WithContinuations: the digits
+// may be split by backslash-newline line continuations. Its argument is one
+// less than the minimum number of digits.
+const continuedNumberPattern = `(\d(?:(?:\\\r?\n)?\d){%d,})`
+
+var splices = strings.NewReplacer("\\\r\n", "", "\\\n", "")
+
+// digitsOf returns the digits of a matched literal without its line
+// continuations.
+func digitsOf(text string) string {
+	if strings.IndexByte(text, '\\') < 0 {
+		return text
+	}
+	return splices.Replace(text)
+}
+
+// WithContinuations treats lines ending in a backslash, as in C macros and
+// shell scripts, as continued on the next line. A literal split across such
+// lines is matched as a whole, its expression is followed by the same line
+// breaks so the line count is kept, and notes go at the end of the logical
+// line rather than after a backslash.
+func WithContinuations() Option {
+	return func(o *options) error {
+		o.continuations = true
+		return nil
+	}
+}
+
+// continuationsIn returns the line continuations inside a matched literal.
+func continuationsIn(text string) string {
+	var sb strings.Builder
+	for i := strings.IndexByte(text, '\\'); i >= 0; i = strings.IndexByte(text, '\\') {
+		text = text[i:]
+		n := len("\\\n")
+		if strings.HasPrefix(text, "\\\r\n") {
+			n = len("\\\r\n")
+		}
+		sb.WriteString(text[:n])
+		text = text[n:]
+	}
+	return sb.String()
+}
+
+// continuationLen returns the length of the line continuation at the start of
+// b, or 0 if there is none.
+func continuationLen(b []byte) int {
+	switch {
+	case bytes.HasPrefix(b, []byte("\\\n")):
+		return 2
+	case bytes.HasPrefix(b, []byte("\\\r\n")):
+		return 3
+	}
+	return 0
+}
+
+// lineEnd returns the index of the newline that ends the logical line at the
+// start of s, or -1 if s does not contain it.
+func (p *pass) lineEnd(s string) int {
+	i := strings.IndexByte(s, '\n')
+	for p.f.opts.continuations && i >= 0 && continued(s[:i]) {
+		j := strings.IndexByte(s[i+1:], '\n')
+		if j < 0 {
+			return -1
+		}
+		i += 1 + j
+	}
+	return i
+}
+
+// continued reports whether a physical line, without its newline, is
+// continued on the next one.
+func continued(line string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(line, "\r"), "\\")
+}
@@ -0,0 +1,175 @@
+package powershift
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// directivePrefix introduces a directive in a comment, e.g.
+//
+//	x = 1048575 // powershift: emit=hex
+//
+// A directive that shares its line with code applies to the literals of that
+// line; one on a line of its own applies to the literals of the next line.
+const directivePrefix = "powershift:"
+
+// directive overrides the output choices for the literals of one line.
+type directive struct {
+	emit Emit // Emit mode, empty to keep the configured one
+	form Form // Only form to try, empty to keep the configured ones
+
+	ignore     bool // Keep the literals of the line as they are
+	ignoreFile bool // Keep every literal of the input as it is
+}
+
+// Directives that keep literals as they are instead of setting anything.
+// Unlike settings, they do not depend on where the comment is: ignore is for
+// its own line and ignore-next-line for the next, e.g.
+//
+//	port := 8080 // powershift:ignore
+const (
+	ignoreLine     = "ignore"
+	ignoreNextLine = "ignore-next-line"
+	ignoreFile     = "ignore-file"
+)
+
+// lineDirectives holds the directives of one segment by line.
+type lineDirectives struct {
+	lineStarts []int              // Rune index at which each line begins
+	this       map[int]*directive // Directives applying to their own line
+	next       map[int]*directive // Directives applying to the following line
+	carried    *directive         // Directive on the last line of the previous segment
+}
+
+// scanDirectives finds the directives in a segment. It returns nil if there
+// are none that could apply.
+func (p *pass) scanDirectives(content string, runes []rune) (*lineDirectives, error) {
+	carried := p.carried
+	p.carried = nil
+	if carried == nil && !strings.Contains(content, directivePrefix) {
+		return nil, nil
+	}
+	ld := &lineDirectives{carried: carried, this: map[int]*directive{}, next: map[int]*directive{}}
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && runes[i] != '\n' {
+			continue
+		}
+		n := len(ld.lineStarts)
+		ld.lineStarts = append(ld.lineStarts, start)
+		if line := string(runes[start:i]); strings.Contains(line, directivePrefix) {
+			d, own, warning, err := parseDirective(line, p.f.opts.profile)
+			if err != nil {
+				return nil, directiveError(p.line+n, err)
+			}
+			if warning != nil && p.f.opts.onWarning != nil {
+				p.f.opts.onWarning(directiveError(p.line+n, warning))
+			}
+			switch {
+			case d == nil:
+			case d.ignoreFile:
+				p.ignoreFile = true
+			case own:
+				ld.next[n] = d
+			default:
+				ld.this[n] = d
+			}
+		}
+		start = i + 1
+	}
+	if last := len(ld.lineStarts) - 1; last > 0 && start == len(runes) {
+		p.carried = ld.next[last-1] // The segment ended with a complete line
+	}
+	return ld, nil
+}
+
+// lookup returns the directive that applies to the literal at rune index i.
+func (ld *lineDirectives) lookup(i int) *directive {
+	if ld == nil {
+		return nil
+	}
+	n := sort.Search(len(ld.lineStarts), func(k int) bool { return ld.lineStarts[k] > i }) - 1
+	if d := ld.this[n]; d != nil {
+		return d
+	}
+	if n == 0 {
+		return ld.carried
+	}
+	return ld.next[n-1]
+}
+
+// parseDirective parses the directive on line, if any. own reports that the
+// comment holding it is the only thing on the line. A value that is unknown
+// or does not apply to the language is not an error: the directive then keeps
+// the literals it covers as they are, and warning tells why.
+func parseDirective(line string, prof Profile) (d *directive, own bool, warning, err error) {
+	i := strings.Index(line, directivePrefix)
+	before := strings.TrimRight(line[:i], " \t")
+	marker := ""
+	for _, m := range []string{prof.LineComment, prof.BlockComment[0]} {
+		if m != "" && strings.HasSuffix(before, m) {
+			marker = m
+		}
+	}
+	if marker == "" {
+		return nil, false, nil, nil // Not in a comment
+	}
+	own = strings.TrimSpace(strings.TrimSuffix(before, marker)) == ""
+
+	args := line[i+len(directivePrefix):]
+	if end := prof.BlockComment[1]; marker == prof.BlockComment[0] && end != "" {
+		if j := strings.Index(args, end); j >= 0 {
+			args = args[:j]
+		}
+	}
+	d = &directive{}
+	fields := strings.FieldsFunc(args, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' || r == '\r' })
+	for _, arg := range fields {
+		switch arg {
+		case ignoreLine, ignoreNextLine, ignoreFile:
+			if len(fields) > 1 {
+				return nil, false, nil, Errorf(ErrInvalidOption, "parse", "", "put the settings in another directive",
+					"%s cannot be combined with other settings", arg)
+			}
+			return &directive{ignore: true, ignoreFile: arg == ignoreFile}, arg == ignoreNextLine, nil, nil
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, false, nil, Errorf(ErrInvalidOption, "parse", "", "write settings as key=value", "%q is not a setting", arg)
+		}
+		var bad error // A value that cannot be used
+		switch key {
+		case "emit":
+			if d.emit, bad = ParseEmit(value); bad == nil && d.emit == EmitGrouped && prof.DigitSeparator == "" {
+				bad = Errorf(ErrInvalidOption, "parse", "", "use another emit mode",
+					"language %q has no digit separator", prof.Name)
+			}
+		case "strategy", "form":
+			if d.form, bad = ParseForm(value); bad == nil && decimal(d.form) && prof.Power == "" {
+				bad = Errorf(ErrInvalidOption, "parse", "", "use a binary form",
+					"language %q has no exponent operator", prof.Name)
+			}
+		default:
+			return nil, false, nil, Errorf(ErrInvalidOption, "parse", "", "known settings are emit and strategy, besides ignore, ignore-next-line and ignore-file", "unknown setting %q", key)
+		}
+		if bad != nil && warning == nil {
+			warning = bad
+		}
+	}
+	if warning != nil {
+		d = &directive{ignore: true}
+	}
+	return d, own, warning, nil
+}
+
+// directiveError reports a malformed directive on the given line.
+func directiveError(line int, err error) error {
+	cause, hint := err, ""
+	var e *Error
+	if errors.As(err, &e) {
+		cause, hint = e.Err, e.Hint
+	}
+	return NewError(ErrInvalidOption, "parse", fmt.Sprintf("directive on line %d", line), cause, hint)
+}
@@ -0,0 +1,79 @@
+package powershift
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDirectivePow10Alias(t *testing.T) {
+	f, err := New(WithLanguage("python"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := f.String("# powershift: strategy=pow10\nx = 1000000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# powershift: strategy=pow10\nx = 10**6\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDirectiveUnusableValue(t *testing.T) {
+	tests := []struct {
+		name, lang, input, want, warning string
+	}{
+		{
+			name:    "unknown form",
+			lang:    "python",
+			input:   "# powershift: strategy=bogus\ny = 1048576\nz = 1048576\n",
+			want:    "# powershift: strategy=bogus\ny = 1048576\nz = 1 << 20\n",
+			warning: `directive on line 1: invalid option: unknown form "bogus"`,
+		},
+		{
+			name:    "unknown emit mode",
+			lang:    "go",
+			input:   "a := 1048576 // powershift: emit=nope\nb := 1048576\n",
+			want:    "a := 1048576 // powershift: emit=nope\nb := 1 << 20\n",
+			warning: `directive on line 1: invalid option: unknown emit mode "nope"`,
+		},
+		{
+			name:    "form the language lacks",
+			lang:    "go",
+			input:   "a := 1048576\nb := 1000000 // powershift: emit=hex, strategy=pow10\n",
+			want:    "a := 1 << 20\nb := 1000000 // powershift: emit=hex, strategy=pow10\n",
+			warning: `directive on line 2: invalid option: language "go" has no exponent operator`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+			f, err := New(WithLanguage(tt.lang), WithWarningFunc(func(err error) {
+				warnings = append(warnings, err.Error())
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := f.String(tt.input)
+			if err != nil {
+				t.Fatalf("the file was not formatted: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.warning) {
+				t.Errorf("warnings are %q, want one with %q", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestDirectiveMalformed(t *testing.T) {
+	f, err := New(WithLanguage("go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.String("x := 1048576 // powershift: colour=red\n"); err == nil {
+		t.Error("an unknown setting was accepted")
+	}
+}
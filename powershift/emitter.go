@@ -0,0 +1,103 @@
+package powershift
+
+import "fmt"
+
+// Emitter renders a decomposition as the text that replaces a literal, for
+// renderings of an organization's own, such as a helper macro MASK(20) for
+// 1<<20 - 1. The emit mode still applies to the result: the original value is
+// added by EmitBoth and EmitAnnotate, and operands of arithmetic operators are
+// parenthesized.
+type Emitter interface {
+	Emit(c Candidate, p Profile) string
+}
+
+// EmitterFunc adapts a function to the Emitter interface.
+type EmitterFunc func(c Candidate, p Profile) string
+
+func (fn EmitterFunc) Emit(c Candidate, p Profile) string { return fn(c, p) }
+
+// Render is the built-in rendering of c, such as 1<<20 - 1, in the syntax of
+// p. Emitters can return it for the candidates they do not handle.
+func Render(c Candidate, p Profile) string {
+	return render(c, p)
+}
+
+// WithEmitter renders every rewrite with e instead of Render. It has no effect
+// with EmitGrouped or EmitHex, which write no expression, and WithReverse only
+// recognizes the built-in rendering.
+func WithEmitter(e Emitter) Option {
+	return func(o *options) error {
+		if e == nil {
+			return Errorf(ErrInvalidOption, "set", "emitter", "", "emitter must not be nil")
+		}
+		o.emitter = e
+		return nil
+	}
+}
+
+// emitter returns the configured emitter, or nil for Render.
+func (f *Formatter) emitter() Emitter {
+	if f.opts.emitter != nil {
+		return f.opts.emitter
+	}
+	return f.opts.profile.Emitter
+}
+
+// render renders c with the configured emitter, for a literal of the integer
+// type t if it is not empty. It returns "" if c does not fit in t.
+func (f *Formatter) render(c Candidate, t string) string {
+	if e := f.emitter(); e != nil {
+		return e.Emit(c, f.opts.profile)
+	}
+	if p := f.opts.profile; p.LongSuffix != "" {
+		return renderLong(c, p, t != "", f.opts.namedConstants)
+	}
+	if t != "" {
+		return renderTyped(c, f.opts.profile, t)
+	}
+	return render(c, f.opts.profile)
+}
+
+// kernelMacros renders c with the bit macros of the Linux kernel: BIT(20) for
+// a power of two, GENMASK(19, 0) for a run of ones and the _ULL variants when
+// a bit above 31 is set. Values wider than 64 bits are left to Render.
+func kernelMacros(c Candidate, p Profile) string {
+	bit := func(n int) string {
+		if n >= 32 {
+			return fmt.Sprintf("BIT_ULL(%d)", n)
+		}
+		return fmt.Sprintf("BIT(%d)", n)
+	}
+	switch c.Form {
+	case FormPower:
+		if c.N < 64 {
+			return bit(c.N)
+		}
+	case FormMinusOne:
+		high := c.N + c.M - 1
+		switch {
+		case c.N == 0 || high >= 64:
+		case c.N == 1:
+			return bit(c.M)
+		case high >= 32:
+			return fmt.Sprintf("GENMASK_ULL(%d, %d)", high, c.M)
+		default:
+			return fmt.Sprintf("GENMASK(%d, %d)", high, c.M)
+		}
+	case FormPlusOne:
+		switch {
+		case c.N+c.M >= 64:
+		case c.N == 0:
+			return bit(c.M + 1)
+		default:
+			return fmt.Sprintf("(%s | %s)", bit(c.N+c.M), bit(c.M))
+		}
+	case FormSumOfPowers:
+		if c.N < 64 {
+			return "(" + joinTerms(c, "|", bit) + ")"
+		}
+	case FormDifferenceOfPowers:
+		return kernelMacros(Candidate{Form: FormMinusOne, N: c.N - c.M, M: c.M}, p)
+	}
+	return render(c, p)
+}
@@ -0,0 +1,79 @@
+package powershift
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Sentinel errors for the failure classes callers usually need to tell apart.
+// Every error returned by this package that belongs to one of these classes
+// matches it with errors.Is.
+var (
+	ErrInputNotFound  = errors.New("input not found")
+	ErrReadFailed     = errors.New("read failed")
+	ErrPatternInvalid = errors.New("invalid pattern")
+	ErrWriteFailed    = errors.New("write failed")
+	ErrInvalidOption  = errors.New("invalid option")
+	ErrConfigInvalid  = errors.New("invalid config")
+	ErrCacheStale     = errors.New("stale cache")
+	ErrMatchTimeout   = errors.New("match timed out")
+)
+
+// Error describes a failed operation. Kind is one of the sentinel errors above,
+// Err is the underlying cause (if any) and Hint is a short, user-facing
+// suggestion on how to fix the problem.
+type Error struct {
+	Kind error
+	Op   string // Operation that failed, e.g. "open", "compile", "write"
+	Path string // File or option the operation was working on, may be empty
+	Err  error
+	Hint string
+}
+
+func (e *Error) Error() string {
+	msg := e.Op
+	if e.Path != "" {
+		msg += " " + e.Path
+	}
+	msg += ": " + e.Kind.Error()
+	if e.Err != nil {
+		cause := e.Err
+		// Avoid repeating "open <path>" when the cause already names the same file
+		var pe *fs.PathError
+		if errors.As(cause, &pe) && pe.Path == e.Path {
+			cause = pe.Err
+		}
+		msg += ": " + cause.Error()
+	}
+	return msg
+}
+
+// Unwrap exposes both the sentinel kind and the underlying cause, so
+// errors.Is(err, ErrWriteFailed) and errors.Is(err, fs.ErrPermission) both work.
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Hint returns the remediation hint attached to err, or "" if there is none.
+func Hint(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Hint
+	}
+	return ""
+}
+
+// NewError builds an *Error. It is exported so that tools built on this
+// package (including the CLI) report their own failures the same way.
+func NewError(kind error, op, path string, cause error, hint string) *Error {
+	return &Error{Kind: kind, Op: op, Path: path, Err: cause, Hint: hint}
+}
+
+// Errorf is like NewError but formats the cause from a message.
+func Errorf(kind error, op, path, hint, format string, args ...any) *Error {
+	return NewError(kind, op, path, fmt.Errorf(format, args...), hint)
+}
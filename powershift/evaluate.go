@@ -0,0 +1,104 @@
+package powershift
+
+import (
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	bitMacro     = regexp.MustCompile(`\bBIT(?:_ULL)?\(\s*(\d+)\s*\)`)
+	genmaskMacro = regexp.MustCompile(`\bGENMASK(?:_ULL)?\(\s*(\d+)\s*,\s*(\d+)\s*\)`)
+	hexLiteral   = regexp.MustCompile(`\b0[xX]([0-9A-Fa-f]+)`)
+	typeSuffix   = regexp.MustCompile(`(\d)([A-Za-z]\w*)`)
+)
+
+// Evaluate returns the value of expr, text the Formatter writes in place of
+// a literal, such as 1<<20 - 1, (1 << 20 /* 1048576 */), 0x100000,
+// 1,048,576, Long.MAX_VALUE or GENMASK(19, 0). It is read with the precedence
+// of the language and in the notation of WithExprStyle, or any notation with
+// WithAnyNotation, and comments are
+// ignored. It reports false for text it cannot read, such as the output of
+// most custom emitters and templates.
+func (f *Formatter) Evaluate(expr string) (*big.Int, bool) {
+	p, powers, _ := f.exprNotation()
+	s := splices.Replace(expr)
+	if open, shut := p.BlockComment[0], p.BlockComment[1]; open != "" {
+		for {
+			i := strings.Index(s, open)
+			if i < 0 {
+				break
+			}
+			j := strings.Index(s[i+len(open):], shut)
+			if j < 0 {
+				return nil, false
+			}
+			s = s[:i] + s[i+len(open)+j+len(shut):]
+		}
+	}
+	if p.Shift != "" {
+		s = strings.ReplaceAll(s, " "+p.Shift+" ", " << ")
+	}
+
+	// Names and macros become the decimal numbers they stand for
+	for n, name := range p.MaxValues {
+		s = strings.ReplaceAll(s, name, mask(n).String())
+	}
+	for t, bits := range p.IntTypes {
+		if bits < 0 {
+			bits = -bits - 1
+		}
+		s = strings.ReplaceAll(s, t+"::MAX", mask(bits).String())
+	}
+	s = bitMacro.ReplaceAllStringFunc(s, func(m string) string {
+		n, _ := strconv.Atoi(bitMacro.FindStringSubmatch(m)[1])
+		return "(" + new(big.Int).Lsh(big.NewInt(1), uint(min(n, maxExprShift))).String() + ")"
+	})
+	s = genmaskMacro.ReplaceAllStringFunc(s, func(m string) string {
+		sub := genmaskMacro.FindStringSubmatch(m)
+		high, _ := strconv.Atoi(sub[1])
+		low, _ := strconv.Atoi(sub[2])
+		if high < low || high >= maxExprShift {
+			return m // Left for evalExpr to reject
+		}
+		return "(" + new(big.Int).Lsh(mask(high-low+1), uint(low)).String() + ")"
+	})
+	s = hexLiteral.ReplaceAllStringFunc(s, func(m string) string {
+		v, _ := new(big.Int).SetString(m[2:], 16)
+		return v.String()
+	})
+
+	// Type suffixes such as the u64 of 1u64 and digit separators go
+	bad := false
+	s = typeSuffix.ReplaceAllStringFunc(s, func(m string) string {
+		if suffix := m[1:]; p.IntTypes[suffix] == 0 && suffix != p.LongSuffix {
+			bad = true
+		}
+		return m[:1]
+	})
+	if bad {
+		return nil, false
+	}
+	if sep := p.DigitSeparator; sep != "" {
+		var sb strings.Builder
+		for i := 0; i < len(s); i++ {
+			if strings.HasPrefix(s[i:], sep) && i > 0 && isDecimalByte(s[i-1]) && i+len(sep) < len(s) && isDecimalByte(s[i+len(sep)]) {
+				i += len(sep) - 1
+				continue
+			}
+			sb.WriteByte(s[i])
+		}
+		s = sb.String()
+	}
+	return evalExpr(strings.TrimSpace(s), p, powers)
+}
+
+// mask returns 2^n - 1.
+func mask(n int) *big.Int {
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(n)), big.NewInt(1))
+}
+
+func isDecimalByte(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,305 @@
+package powershift
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// maxExprShift bounds the shift amounts evaluated in expressions, so that a
+// stray 1<<99999999 does not allocate a huge number.
+const maxExprShift = 1 << 16
+
+// exprPattern finds spans that may be shift expressions: decimal numbers
+// joined by <<, ** (for the decimal forms), + and -, with parentheses, and at
+// least one shift or power.
+var exprPattern = regexp.MustCompile(`\(*[ \t]*\d+[ \t]*\)*[ \t]*(?:<<|\*\*)[ \t]*\(*[ \t]*\d+(?:[ \t]*\)*[ \t]*(?:<<|\*\*|[+-])[ \t]*\(*[ \t]*\d+)*[ \t]*\)*`)
+
+// styledExprPattern is exprPattern for the notations of WithExprStyle, which
+// also write powers as 2^20 and multiples as 3 * 2^18.
+var styledExprPattern = regexp.MustCompile(`\(*[ \t]*\d+[ \t]*\)*[ \t]*(?:<<|\*\*|\^|\*)[ \t]*\(*[ \t]*\d+(?:[ \t]*\)*[ \t]*(?:<<|\*\*|\^|[*+-])[ \t]*\(*[ \t]*\d+)*[ \t]*\)*`)
+
+// ExprMatch is a shift expression found in text, such as one written by an
+// earlier run.
+type ExprMatch struct {
+	Offset int      // Byte offset of Text
+	Text   string   // The expression as it appears, with its parentheses
+	Value  *big.Int // What it evaluates to
+}
+
+// Expressions returns the shift expressions in s, such as 1<<20 - 1 or
+// ((1<<16) + 1) << 1, evaluated with the operator precedence of the
+// Formatter's language. Expressions that are only part of a larger one, as in
+// x + 1<<20, those whose first or last number runs into a name or another
+// number, as in a1 << 2 or 0x1 << 5, and parentheses that belong to a
+// function call are left out; parenthesized operands, as in
+// x * (1<<20 - 1), are found. In languages with an exponent operator, powers
+// such as (10**6) - 1 are found too. With
+// WithExprStyle, expressions in its notation, such as (2^13 - 1) << 4, are
+// found instead, and with WithAnyNotation those of every notation. Literals
+// may have a type suffix of the language, as in 1u64 << 20.
+func (f *Formatter) Expressions(s string) []ExprMatch {
+	p, powers, pattern := f.exprNotation()
+	return f.findExprs(s, p, powers, pattern)
+}
+
+// findExprs implements Expressions for the notation of exprNotation.
+func (f *Formatter) findExprs(s string, p Profile, powers []string, pattern *regexp.Regexp) []ExprMatch {
+	masked := f.maskIntSuffixes(s)
+	var found []ExprMatch
+	for _, loc := range pattern.FindAllStringIndex(masked, -1) {
+		start, end := trimExpr(masked, loc[0], loc[1])
+		if start >= end || !enclosed(masked[start:end]) && partOfLarger(masked, start, end) {
+			continue
+		}
+		if runsInto(masked, start, end) {
+			continue // The end of a name or of another number
+		}
+		if !hasPower(masked[start:end], powers) {
+			continue // A product such as 3 * 4, without a power
+		}
+		v, ok := evalExpr(masked[start:end], p, powers)
+		if !ok {
+			continue
+		}
+		found = append(found, ExprMatch{Offset: start, Text: s[start:end], Value: v})
+	}
+	return found
+}
+
+// exprNotation returns the profile whose precedence Expressions evaluates
+// with, the exponent operators it reads and the pattern that finds the
+// expressions.
+func (f *Formatter) exprNotation() (Profile, []string, *regexp.Regexp) {
+	p := f.opts.profile
+	switch {
+	case f.opts.anyNotation && p.Xor && f.opts.exprStyle != ExprMath:
+		return p, []string{"**"}, styledExprPattern // See xorWarnings
+	case f.opts.anyNotation:
+		return p, []string{"**", "^"}, styledExprPattern
+	case f.opts.exprStyle == ExprMath:
+		return p, []string{"^"}, styledExprPattern
+	case f.opts.exprStyle == ExprPython:
+		return p, []string{"**"}, styledExprPattern
+	case p.Power != "":
+		return p, []string{p.Power}, exprPattern
+	}
+	return p, nil, exprPattern
+}
+
+// hasPower reports whether s holds a shift or one of the exponent operators
+// powers.
+func hasPower(s string, powers []string) bool {
+	if strings.Contains(s, "<<") {
+		return true
+	}
+	for _, op := range powers {
+		if strings.Contains(s, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimExpr drops surrounding blanks and unbalanced parentheses from
+// s[start:end], as well as the parentheses of a call such as f(1<<20).
+func trimExpr(s string, start, end int) (int, int) {
+	for {
+		for start < end && (s[start] == ' ' || s[start] == '\t') {
+			start++
+		}
+		for end > start && (s[end-1] == ' ' || s[end-1] == '\t') {
+			end--
+		}
+		open := strings.Count(s[start:end], "(")
+		closing := strings.Count(s[start:end], ")")
+		switch {
+		case open > closing && s[start] == '(':
+			start++
+		case closing > open && s[end-1] == ')':
+			end--
+		case open > 0 && s[start] == '(' && start > 0 && isIdentByte(s[start-1]) && enclosed(s[start:end]):
+			start, end = start+1, end-1
+		default:
+			return start, end
+		}
+	}
+}
+
+// enclosed reports whether the parenthesis at the start of s closes at its end.
+func enclosed(s string) bool {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i == len(s)-1
+			}
+		}
+	}
+	return false
+}
+
+// partOfLarger reports whether s[start:end] is an operand of an operator
+// outside it, in which case its value depends on the surrounding expression.
+func partOfLarger(s string, start, end int) bool {
+	runes := []rune(s[:end])
+	return arithmeticOperand([]rune(s), len([]rune(s[:start])), len(runes))
+}
+
+// runsInto reports whether s[start:end] begins or ends with a digit that is
+// part of a longer token, as the 1 << 2 of a1 << 2, 0x1 << 2 or 1 << 2.5.
+func runsInto(s string, start, end int) bool {
+	if start > 0 && isDecimalDigit(rune(s[start])) && (isIdentByte(s[start-1]) || s[start-1] == '.') {
+		return true
+	}
+	if end < len(s) && isDecimalDigit(rune(s[end-1])) {
+		c := s[end]
+		return isIdentByte(c) || c == '.' && end+1 < len(s) && isDecimalDigit(rune(s[end+1]))
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return isASCIIAlnum(c) || c == '_'
+}
+
+// evalExpr evaluates an expression of decimal numbers, parentheses, <<, *,
+// +, - and |, with the precedence of the language of p: with low shift
+// precedence, << binds looser than + and - and | loosest of all, as in C;
+// otherwise << binds as tight as * and | as loose as + and -, as in Go. The
+// exponent operators powers, which bind tightest, are accepted too.
+func evalExpr(s string, p Profile, powers []string) (*big.Int, bool) {
+	e := &exprEval{lowShift: p.LowShiftPrecedence}
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			e.tokens = append(e.tokens, s[i:j])
+			i = j
+		case strings.HasPrefix(s[i:], "<<"):
+			e.tokens = append(e.tokens, "<<")
+			i += 2
+		case powerPrefix(s[i:], powers) > 0:
+			e.tokens = append(e.tokens, "**")
+			i += powerPrefix(s[i:], powers)
+		case c == '(' || c == ')' || c == '+' || c == '-' || c == '*' || c == '|':
+			e.tokens = append(e.tokens, s[i:i+1])
+			i++
+		default:
+			return nil, false
+		}
+	}
+	v, ok := e.binary(0)
+	if !ok || e.pos != len(e.tokens) {
+		return nil, false
+	}
+	return v, true
+}
+
+// powerPrefix returns the length of the exponent operator of powers s starts
+// with, 0 if none.
+func powerPrefix(s string, powers []string) int {
+	for _, op := range powers {
+		if strings.HasPrefix(s, op) {
+			return len(op)
+		}
+	}
+	return 0
+}
+
+// exprEval is a precedence-climbing evaluator over the tokens of an expression.
+type exprEval struct {
+	tokens   []string
+	pos      int
+	lowShift bool
+}
+
+func (e *exprEval) precedence(op string) int {
+	or, shift, additive, times, power := 2, 3, 2, 3, 4
+	if e.lowShift {
+		or, shift, additive, times, power = 1, 2, 3, 4, 5
+	}
+	switch op {
+	case "**":
+		return power
+	case "*":
+		return times
+	case "<<":
+		return shift
+	case "+", "-":
+		return additive
+	case "|":
+		return or
+	}
+	return 0
+}
+
+func (e *exprEval) binary(minPrec int) (*big.Int, bool) {
+	left, ok := e.operand()
+	if !ok {
+		return nil, false
+	}
+	for e.pos < len(e.tokens) {
+		op := e.tokens[e.pos]
+		prec := e.precedence(op)
+		if prec == 0 || prec <= minPrec {
+			break
+		}
+		e.pos++
+		if op == "**" {
+			prec-- // Right-associative
+		}
+		right, ok := e.binary(prec)
+		if !ok {
+			return nil, false
+		}
+		switch op {
+		case "<<":
+			if !right.IsInt64() || right.Int64() > maxExprShift {
+				return nil, false
+			}
+			left = new(big.Int).Lsh(left, uint(right.Int64()))
+		case "**":
+			if !right.IsInt64() || right.Int64()*int64(left.BitLen()) > maxExprShift {
+				return nil, false
+			}
+			left = new(big.Int).Exp(left, right, nil)
+		case "*":
+			left = new(big.Int).Mul(left, right)
+		case "|":
+			left = new(big.Int).Or(left, right)
+		case "+":
+			left = new(big.Int).Add(left, right)
+		case "-":
+			left = new(big.Int).Sub(left, right)
+		}
+	}
+	return left, true
+}
+
+func (e *exprEval) operand() (*big.Int, bool) {
+	if e.pos >= len(e.tokens) {
+		return nil, false
+	}
+	tok := e.tokens[e.pos]
+	e.pos++
+	if tok == "(" {
+		v, ok := e.binary(0)
+		if !ok || e.pos >= len(e.tokens) || e.tokens[e.pos] != ")" {
+			return nil, false
+		}
+		e.pos++
+		return v, true
+	}
+	v, ok := new(big.Int).SetString(tok, 10)
+	return v, ok
+}
@@ -0,0 +1,34 @@
+package powershift
+
+import "testing"
+
+func TestExpressionsBoundaries(t *testing.T) {
+	tests := []struct {
+		name, lang, input string
+		want              []string
+	}{
+		{name: "hex", lang: "go", input: "mask := 0x1 << 5", want: nil},
+		{name: "identifier", lang: "go", input: "x := a1 << 2", want: nil},
+		{name: "shift into a name", lang: "go", input: "x := 1 << 2b", want: nil},
+		{name: "float", lang: "python", input: "y = 1.5e1 << 2", want: nil},
+		{name: "power of an identifier", lang: "python", input: "w = v2 ** 3", want: nil},
+		{name: "typed literal", lang: "rust", input: "let b = 1u64 << 20;", want: []string{"1u64 << 20"}},
+		{name: "call", lang: "go", input: "f(1<<10, x)", want: []string{"1<<10"}},
+		{name: "sentence", lang: "text", input: "Use 1 << 20.", want: []string{"1 << 20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(WithLanguage(tt.lang))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range f.Expressions(tt.input) {
+				got = append(got, e.Text)
+			}
+			if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
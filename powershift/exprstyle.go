@@ -0,0 +1,178 @@
+package powershift
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// ExprStyle selects the notation of the powers in an expression.
+type ExprStyle string
+
+const (
+	ExprShift  ExprStyle = "shift"  // 1<<10, with the precedence of the language
+	ExprMath   ExprStyle = "math"   // 2^10, for prose and documentation
+	ExprPython ExprStyle = "python" // 2**10
+)
+
+// ExprStyleNames lists the supported expression styles.
+func ExprStyleNames() []ExprStyle {
+	return []ExprStyle{ExprShift, ExprMath, ExprPython}
+}
+
+// ParseExprStyle converts a name such as "math" into an ExprStyle.
+func ParseExprStyle(name string) (ExprStyle, error) {
+	for _, s := range ExprStyleNames() {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", Errorf(ErrInvalidOption, "parse", "expression style", fmt.Sprintf("known styles are %v", ExprStyleNames()),
+		"unknown expression style %q", name)
+}
+
+// WithExprStyle writes the powers of every expression in style s, as in
+// (2^10 - 1) << 3 for ExprMath. ExprShift is the notation of the language.
+// Like WithEmitter, it replaces the Emitter of the profile. With WithReverse,
+// expressions are read back in style s.
+func WithExprStyle(s ExprStyle) Option {
+	return func(o *options) error {
+		if _, err := ParseExprStyle(string(s)); err != nil {
+			return err
+		}
+		o.exprStyle = s
+		switch s {
+		case ExprMath:
+			o.emitter = powerEmitter("^")
+		case ExprPython:
+			o.emitter = powerEmitter("**")
+		default:
+			o.emitter = nil
+		}
+		return nil
+	}
+}
+
+// WithAnyNotation makes WithReverse, Expressions and Evaluate read the powers
+// of every notation of WithExprStyle at once, as in 2^20, 2**20 and 1<<20, so
+// text can be decoded without knowing the style it was written in. In
+// languages where ^ is exclusive or, as in Go, it is only read as a power
+// with ExprMath; otherwise expressions with it are kept and reported to
+// WithWarningFunc.
+func WithAnyNotation() Option {
+	return func(o *options) error {
+		o.anyNotation = true
+		return nil
+	}
+}
+
+// powerEmitter renders the powers of an expression with the exponent
+// operator op, which binds tighter than + and -, and keeps << for the shift
+// of the 2^n ± 1 term.
+func powerEmitter(op string) Emitter {
+	return EmitterFunc(func(c Candidate, p Profile) string {
+		pow := func(base, n int) string {
+			return fmt.Sprintf("%d%s%d", base, op, n)
+		}
+		switch c.Form {
+		case FormPower:
+			return pow(2, c.N)
+		case FormMinusOne:
+			switch {
+			case c.N == 0:
+				return "0"
+			case c.N == 1:
+				return pow(2, c.M)
+			case c.M == 0:
+				return pow(2, c.N) + " - 1"
+			}
+			return fmt.Sprintf("(%s - 1) << %d", pow(2, c.N), c.M)
+		case FormPlusOne:
+			switch {
+			case c.N == 0:
+				return pow(2, c.M+1)
+			case c.M == 0:
+				return pow(2, c.N) + " + 1"
+			}
+			return fmt.Sprintf("(%s + 1) << %d", pow(2, c.N), c.M)
+		case FormMultiple:
+			return fmt.Sprintf("%d * %s", c.M, pow(2, c.N))
+		case FormSumOfPowers, FormDifferenceOfPowers:
+			op := "+"
+			if c.Form == FormDifferenceOfPowers {
+				op, c.Terms = "-", []int{c.N, c.M}
+			}
+			return joinTerms(c, op, func(n int) string {
+				if n == 0 {
+					return "1"
+				}
+				return pow(2, n)
+			})
+		case FormPowerOfTen:
+			return pow(10, c.N)
+		case FormTenMinusOne:
+			return pow(10, c.N) + " - 1"
+		}
+		return render(c, p)
+	})
+}
+
+// TemplateData is what the template of WithExprTemplate renders: the
+// candidate (Base^Exp Sign 1) << Shift.
+type TemplateData struct {
+	Form       Form
+	Base       int    // 2, or 10 for the decimal forms
+	Exp        int    // Exponent of Base
+	Sign       string // "-" or "+", empty for a plain power
+	Shift      int    // Left shift of the term, 0 for the decimal forms
+	Terms      []int  // Exponents of the sum-of-powers and difference-of-powers forms, highest first
+	Multiplier int    // k of the multiple form, 1 for the others
+}
+
+// WithExprTemplate renders every expression with the text/template text,
+// which is executed on a TemplateData, as in
+// ({{.Base}}^{{.Exp}}{{.Sign}}1)<<{{.Shift}}. Like WithEmitter, it replaces
+// the Emitter of the profile.
+func WithExprTemplate(text string) Option {
+	return func(o *options) error {
+		t, err := template.New("expr").Option("missingkey=error").Parse(text)
+		if err == nil {
+			// Fields are only looked up when the template runs
+			err = t.Execute(io.Discard, templateData(Candidate{Form: FormMinusOne, N: 10, M: 3}))
+		}
+		if err != nil {
+			return NewError(ErrInvalidOption, "parse", "expression template", err,
+				"the fields are .Form, .Base, .Exp, .Sign, .Shift, .Terms and .Multiplier")
+		}
+		o.emitter = EmitterFunc(func(c Candidate, p Profile) string {
+			var sb strings.Builder
+			if t.Execute(&sb, templateData(c)) != nil {
+				return ""
+			}
+			return sb.String()
+		})
+		return nil
+	}
+}
+
+func templateData(c Candidate) TemplateData {
+	d := TemplateData{Form: c.Form, Base: 2, Exp: c.N, Shift: c.M, Multiplier: 1}
+	switch c.Form {
+	case FormMultiple:
+		d.Shift, d.Multiplier = 0, c.M
+	case FormSumOfPowers:
+		d.Sign, d.Shift, d.Terms = "+", 0, c.Terms
+	case FormDifferenceOfPowers:
+		d.Sign, d.Shift, d.Terms = "-", 0, []int{c.N, c.M}
+	case FormMinusOne:
+		d.Sign = "-"
+	case FormPlusOne:
+		d.Sign = "+"
+	case FormPowerOfTen:
+		d.Base = 10
+	case FormTenMinusOne:
+		d.Base, d.Sign = 10, "-"
+	}
+	return d
+}
@@ -0,0 +1,170 @@
+package powershift
+
+import (
+	"math/big"
+	"strings"
+)
+
+// WithFolding folds constant arithmetic around large literals, as in the
+// hand-unfolded size math 1048576 / 1024. When integer literals joined by *
+// and / evaluate exactly to a power of two, or to a value no larger than the
+// threshold, that value is taken to be the real constant and the whole chain
+// is rewritten as it: 1 << 10 here. Other chains are left to the usual rules.
+// A chain is only folded if one of its literals is above the threshold, and
+// never where operator precedence would give it another value, as in
+// x * 1048576 / 1024 or 1024 * 1024 ** 2. It has no effect with EmitGrouped
+// or EmitHex.
+func WithFolding() Option {
+	return func(o *options) error {
+		o.fold = true
+		return nil
+	}
+}
+
+// fold is a chain of literals that is rewritten as its value.
+type fold struct {
+	start, end int // Rune offsets in the segment
+	value      *big.Int
+}
+
+// folds returns the chains in runes that WithFolding rewrites, in order.
+// Chains under a directive are left alone.
+func (p *pass) folds(runes []rune, dirs *lineDirectives) []fold {
+	if !p.f.opts.fold || p.ignoreFile || p.f.opts.emit == EmitGrouped || p.f.opts.emit == EmitHex {
+		return nil
+	}
+	var found []fold
+	for i := 0; i < len(runes); i++ {
+		if !isDecimalDigit(runes[i]) || i > 0 && (isWordRune(runes[i-1]) || runes[i-1] == '.') {
+			continue
+		}
+		end, v, ok := p.chain(runes, i)
+		if ok && dirs.lookup(i) == nil {
+			found = append(found, fold{start: i, end: end, value: v})
+		}
+		i = end
+	}
+	return found
+}
+
+// chain evaluates the literals joined by * and / that start at runes[start].
+// It returns the end of the chain, its value, and whether it is to be folded.
+func (p *pass) chain(runes []rune, start int) (int, *big.Int, bool) {
+	end, v, ok := literalAt(runes, start)
+	if !ok {
+		return end, nil, false
+	}
+	threshold := p.f.opts.threshold
+	terms, large := 1, v.Cmp(threshold) > 0
+	for {
+		j := skipBlanks(runes, end)
+		if j >= len(runes) || runes[j] != '*' && runes[j] != '/' || isCommentStart(runes, j) || isCommentEnd(runes, j) ||
+			j+1 < len(runes) && runes[j+1] == runes[j] { // ** and //
+			break
+		}
+		if runes[j] == '/' && p.f.opts.profile.FloatDivision {
+			break
+		}
+		next, w, ok := literalAt(runes, skipBlanks(runes, j+1))
+		if !ok {
+			break
+		}
+		if runes[j] == '*' {
+			v.Mul(v, w)
+		} else {
+			var rem big.Int
+			if w.Sign() == 0 || rem.Rem(v, w).Sign() != 0 {
+				return next, nil, false // Not exact, so the value depends on the language
+			}
+			v.Quo(v, w)
+		}
+		terms++
+		large = large || w.Cmp(threshold) > 0
+		end = next
+	}
+	if terms < 2 || !large || !foldableAt(runes, start, end) {
+		return end, nil, false
+	}
+	if _, ok := exactPower(v); !ok && v.Cmp(threshold) > 0 || p.f.opts.ceiling != nil && v.Cmp(p.f.opts.ceiling) > 0 {
+		return end, nil, false
+	}
+	return end, v, true
+}
+
+// foldableAt reports whether the chain runes[start:end] is evaluated on its
+// own: it is not the right operand of an operator that binds as tightly as *
+// in some language, nor the base of a power.
+func foldableAt(runes []rune, start, end int) bool {
+	i := start - 1
+	for i >= 0 && (runes[i] == ' ' || runes[i] == '\t') {
+		i--
+	}
+	if i >= 0 && (strings.ContainsRune("*/%&^~.", runes[i]) || isShift(runes, i-1)) {
+		return false
+	}
+	j := skipBlanks(runes, end)
+	return !(j+1 < len(runes) && runes[j] == '*' && runes[j+1] == '*')
+}
+
+// literalAt parses the plain decimal literal at runes[i]. Literals with a
+// leading zero, which are octal in some languages, a suffix or a fraction are
+// not plain.
+func literalAt(runes []rune, i int) (int, *big.Int, bool) {
+	j := i
+	for j < len(runes) && isDecimalDigit(runes[j]) {
+		j++
+	}
+	if j == i || j-i > 1 && runes[i] == '0' || j < len(runes) && (isWordRune(runes[j]) || runes[j] == '.') {
+		return j, nil, false
+	}
+	v, _ := new(big.Int).SetString(string(runes[i:j]), 10)
+	return j, v, true
+}
+
+func isDecimalDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func skipBlanks(runes []rune, i int) int {
+	for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// rewriteFold writes the value of the chain f in its place.
+func (p *pass) rewriteFold(runes []rune, f fold) {
+	m := Match{Text: string(runes[f.start:f.end]), Value: f.value, Offset: p.offset, Line: p.line, Column: p.col}
+	m.Arithmetic = arithmeticOperand(runes, f.start, f.end)
+	m.IntType = p.intType(runes, f.start, f.end)
+	if p.f.opts.decide != nil || p.f.opts.onResult != nil {
+		m.Context = lineContext(runes, f.start, f.end)
+	}
+	m.Expr = f.value.String()
+	var note string
+	if n, ok := exactPower(f.value); ok && p.f.opts.inRange(f.value, p.f.opts.threshold) {
+		c := Candidate{Form: FormPower, N: n}
+		if expr, nt := p.f.emitCandidate(&m, c, p.f.render(c, m.IntType), p.f.opts.emit); expr != "" {
+			m.Expr, note = expr, nt
+		}
+	}
+	out := p.decide(m)
+	if out != m.Text && !p.admit(m) {
+		out = m.Text
+	}
+	if out != m.Text {
+		if out == m.Expr && note != "" {
+			p.notes = append(p.notes, note)
+		}
+		var tag string
+		if out, tag = p.f.tagged(out); tag != "" {
+			p.notes = append(p.notes, tag)
+		}
+		p.replace(m, out)
+	} else {
+		p.copy(m.Text)
+	}
+	if p.f.opts.onResult != nil {
+		p.f.opts.onResult(Result{Match: m, Replaced: out != m.Text, Output: out})
+	}
+}
@@ -0,0 +1,796 @@
+// Package powershift rewrites large integer literals in text as power-of-two
+// expressions such as (1<<20 - 1) or (1<<16 + 1) << 1.
+//
+// A Formatter is built once with New and can then transform any number of
+// inputs; the number pattern and strategy table are compiled up front.
+// Transform is a convenience wrapper for one-off use.
+package powershift
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+)
+
+// numberPattern finds runs of at least WithMinDigits digits, given as its
+// argument. Whether a run is a standalone number is left to the adjacency rule
+// rather than to lookaround, so that the rule can see across the segments of a
+// streamed input.
+const numberPattern = `(\d{%d,})`
+
+// Stats summarizes a single transformation.
+type Stats struct {
+	Matches      int   // Numbers found by the pattern
+	Replaced     int   // Numbers rewritten as an expression
+	Annotated    int   // Numbers kept, with their expression in a line comment at the end of the line
+	BytesRead    int64 // Bytes consumed from the source
+	BytesWritten int64 // Bytes written to the destination
+}
+
+// Changed reports whether the output differs from the input: a number was
+// rewritten or annotated.
+func (s Stats) Changed() bool {
+	return s.Replaced > 0 || s.Annotated > 0
+}
+
+// Formatter rewrites numbers according to its options. It holds no per-call
+// state and is not changed after New, so one Formatter can be reused for many
+// inputs and is safe for concurrent use by multiple goroutines, as a server
+// shares it between requests. The functions and interfaces it is given, such
+// as those of WithDecisionFunc, WithResultFunc, WithEmitter and
+// WithLiteralParser, are called from every goroutine that uses it and must be
+// safe for that too.
+type Formatter struct {
+	opts         options
+	re           *regexp2.Regexp
+	group        int   // Group of re that holds the digits
+	parserGroups []int // Group of re of each of opts.parsers
+	strategies   []strategy
+	tiers        []tier         // In the order of opts.tiers
+	rev          *reverser      // For WithReverse in languages with block comments
+	typeRe       *regexp.Regexp // Finds the integer type of a line, nil if the profile has no IntTypes
+	suffixRe     *regexp.Regexp // Finds the type suffixes of literals, nil if the profile has no IntTypes
+}
+
+// New builds a Formatter from the given options.
+func New(opts ...Option) (*Formatter, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	pattern := fmt.Sprintf(numberPattern, o.minDigits)
+	if o.continuations {
+		pattern = fmt.Sprintf(continuedNumberPattern, o.minDigits-1)
+	}
+	if o.profile.LongSuffix != "" {
+		pattern += longSuffixPattern
+	}
+	if o.profile.IntTypes != nil {
+		pattern += "(?:" + intSuffixPattern(o.profile.IntTypes) + ")?"
+	}
+	if o.pattern != "" && o.continuations {
+		return nil, Errorf(ErrInvalidOption, "set", "pattern", "match the continuations in the pattern itself",
+			"a custom pattern cannot be combined with continuations")
+	}
+	if o.pattern != "" && len(o.parsers) > 0 {
+		return nil, Errorf(ErrInvalidOption, "set", "pattern", "match the other literals in the pattern itself, or drop it",
+			"a custom pattern cannot be combined with literal parsers")
+	}
+	var re *regexp2.Regexp
+	var err error
+	if o.pattern != "" {
+		re, err = compilePattern(o.pattern, o.matchTimeout)
+	} else if pattern, err = literalPattern(o.parsers, pattern, o.matchTimeout); err != nil {
+		return nil, err
+	} else if re, err = regexp2.Compile(pattern, regexp2.ECMAScript); err != nil {
+		err = NewError(ErrPatternInvalid, "compile", "number pattern", err,
+			"the pattern must be a valid ECMAScript regular expression")
+	} else if len(o.parsers) > 0 {
+		re.MatchTimeout = o.matchTimeout // The patterns of the parsers may be slow
+	}
+	if err != nil {
+		return nil, err
+	}
+	group := 1 // The group holding the digits, or the whole match if it has none
+	if len(re.GetGroupNumbers()) == 1 {
+		group = 0
+	}
+
+	if o.weights != nil && o.scoring == ScoreFirst {
+		return nil, Errorf(ErrInvalidOption, "set", "form weights", "pick the shortest or simplest scoring",
+			"form weights have no effect with the first scoring rule")
+	}
+
+	if o.ceiling != nil && o.ceiling.Cmp(o.threshold) <= 0 {
+		return nil, Errorf(ErrInvalidOption, "set", "ceiling", "raise the ceiling or lower the threshold",
+			"ceiling %v is not above the threshold %v", o.ceiling, o.threshold)
+	}
+
+	if o.emit == EmitGrouped && o.profile.DigitSeparator == "" {
+		return nil, Errorf(ErrInvalidOption, "set", "emit", "pick a language that supports digit separators, or another emit mode",
+			"language %q has no digit separator", o.profile.Name)
+	}
+
+	if o.forms == nil {
+		o.forms = o.profile.Forms
+	}
+	if o.forms == nil {
+		o.forms = DefaultForms
+	}
+	if o.profile.Power == "" {
+		forms := slices.Clone(o.forms)
+		for _, t := range o.tiers {
+			forms = append(forms, t.Forms...)
+		}
+		if i := slices.IndexFunc(forms, decimal); i >= 0 {
+			return nil, Errorf(ErrInvalidOption, "set", "forms", "pick a language with an exponent operator, such as python",
+				"language %q has no exponent operator for form %q", o.profile.Name, forms[i])
+		}
+	}
+
+	if o.intType != "" {
+		if _, ok := o.profile.IntTypes[o.intType]; !ok {
+			return nil, Errorf(ErrInvalidOption, "set", "int type", intTypeHint(o.profile),
+				"language %q has no integer type %q", o.profile.Name, o.intType)
+		}
+	}
+
+	if o.namedConstants && o.profile.MaxValues == nil {
+		return nil, Errorf(ErrInvalidOption, "set", "named constants", "pick a language with named maximum values, such as java",
+			"language %q has no named constants", o.profile.Name)
+	}
+
+	f := &Formatter{opts: o, re: re, group: group, parserGroups: parserGroups(re, o.parsers)}
+	if o.profile.IntTypes != nil {
+		f.typeRe = intTypePattern(o.profile.IntTypes)
+		f.suffixRe = regexp.MustCompile(`\d(` + intSuffixPattern(o.profile.IntTypes) + `)\b`)
+	}
+	for _, form := range o.forms {
+		f.strategies = append(f.strategies, o.strategy(form))
+	}
+	for _, t := range o.tiers {
+		ft := tier{Tier: t}
+		for _, form := range t.Forms {
+			ft.strategies = append(ft.strategies, o.strategy(form))
+		}
+		f.tiers = append(f.tiers, ft)
+	}
+	if o.reverse && o.profile.BlockComment[0] != "" {
+		f.rev = newReverser(o.profile.BlockComment, f.reverseTag())
+	}
+	return f, nil
+}
+
+// Transform reads src, rewrites the numbers in it and writes the result to dst.
+func Transform(dst io.Writer, src io.Reader, opts ...Option) (Stats, error) {
+	f, err := New(opts...)
+	if err != nil {
+		return Stats{}, err
+	}
+	return f.Transform(dst, src)
+}
+
+// Transform reads src, rewrites the numbers in it and writes the result to dst.
+// With WithChunkSize the input is streamed; otherwise it is read in full first.
+func (f *Formatter) Transform(dst io.Writer, src io.Reader) (Stats, error) {
+	if f.opts.reverse {
+		return f.transformReverse(dst, src)
+	}
+	p := &pass{f: f, w: bufio.NewWriter(dst), line: 1, col: 1}
+	var err error
+	if f.opts.chunkSize > 0 {
+		err = p.stream(src, f.opts.chunkSize)
+	} else {
+		var content []byte
+		content, err = io.ReadAll(src)
+		if err != nil {
+			return p.stats, NewError(ErrReadFailed, "read", "input", err, "")
+		}
+		p.stats.BytesRead = int64(len(content))
+		if content, err = p.header(content); err == nil {
+			err = p.segment(string(content))
+		}
+	}
+	if err != nil {
+		return p.stats, err
+	}
+	p.flushNotes()
+	if err := p.w.Flush(); err != nil {
+		return p.stats, writeFailed(err)
+	}
+	return p.stats, nil
+}
+
+// String is a convenience wrapper that transforms an in-memory string.
+func (f *Formatter) String(s string) (string, Stats, error) {
+	var sb strings.Builder
+	stats, err := f.Transform(&sb, strings.NewReader(s))
+	return sb.String(), stats, err
+}
+
+// MayRewrite is a fast check of whether f could rewrite anything in data.
+// When it returns false, Transform would copy data through unchanged, so
+// callers can skip it and, for files, the rewrite.
+func (f *Formatter) MayRewrite(data []byte) bool {
+	if f.opts.reverse {
+		_, powers, _ := f.exprNotation()
+		if bytes.Contains(data, []byte("<<")) {
+			return true
+		}
+		for _, op := range powers {
+			if bytes.Contains(data, []byte(op)) {
+				return true
+			}
+		}
+		return false
+	}
+	if f.opts.pattern != "" || len(f.opts.parsers) > 0 {
+		return true // A custom pattern or parser may match anything
+	}
+	digits := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case '0' <= c && c <= '9':
+			if digits++; digits == f.opts.minDigits {
+				return true
+			}
+		case c == '\\' && f.opts.continuations && digits > 0:
+			// A continuation inside a literal does not end its digit run
+			if n := continuationLen(data[i:]); n > 0 {
+				i += n - 1
+				continue
+			}
+			digits = 0
+		default:
+			digits = 0
+		}
+	}
+	return false
+}
+
+// Format returns the expression for num, or ok == false if num is not above
+// the threshold or none of the configured forms can represent it.
+func (f *Formatter) Format(num *big.Int) (expr string, ok bool) {
+	if !f.opts.inRange(num, f.opts.threshold) {
+		return "", false
+	}
+	c, ok := f.candidate(num)
+	if !ok {
+		return "", false
+	}
+	expr = f.render(c, f.opts.intType)
+	return expr, expr != ""
+}
+
+// candidate returns the first decomposition of num among the configured
+// forms, or those of its tier.
+func (f *Formatter) candidate(num *big.Int) (Candidate, bool) {
+	forms, strats := f.opts.forms, f.strategies
+	if len(f.tiers) > 0 {
+		t := f.tierFor(num)
+		if t == nil {
+			return Candidate{}, false
+		}
+		if len(t.Forms) > 0 {
+			forms, strats = t.Forms, t.strategies
+		}
+	}
+	cache := f.opts.cache
+	if f.opts.scoring != ScoreFirst {
+		cache = nil // The scores depend on the rendering, which the key does not cover
+	}
+	var key string
+	if cache != nil {
+		key = cacheKey(forms, &f.opts, num)
+		if e, ok := cache.get(key); ok {
+			return e.c, e.ok
+		}
+	}
+	var e cacheEntry
+	e.c, e.ok = f.best(strats, num)
+	if cache != nil {
+		cache.put(key, e)
+	}
+	return e.c, e.ok
+}
+
+// pass holds the state of a single Transform call.
+type pass struct {
+	f     *Formatter
+	w     *bufio.Writer
+	stats Stats
+
+	// Position of the next unread input byte
+	offset int64
+	line   int
+	col    int
+
+	// Original values waiting for a line comment at the end of the current line
+	notes []string
+
+	// Proposal for the end of a range whose start has just been processed
+	rangeEnd *rangeEnd
+
+	// Directive for the first line of the next segment
+	carried *directive
+
+	// Whether an ignore-file directive was seen
+	ignoreFile bool
+
+	// Context for the adjacency rule: the end of the previous segment and the
+	// input following the current one
+	before []rune
+	tail   []rune
+
+	// Number of matches checked so far, including those the adjacency rule
+	// rejects
+	found int
+
+	// Shift expressions of the current line, for WithShiftedNeighbors
+	shifted shiftedLine
+}
+
+// segment rewrites one self-contained piece of the input.
+func (p *pass) segment(content string) error {
+	// regexp2 works on runes, so match indices are rune offsets rather than byte offsets.
+	runes := []rune(content)
+	currentIndex := 0 // Tracks the end of the last processed part
+
+	dirs, err := p.scanDirectives(content, runes)
+	if err != nil {
+		return err
+	}
+
+	folds := p.folds(runes, dirs)
+	match, err := p.next(nil, runes)
+	if err != nil {
+		return err
+	}
+	p.rangeEnd = nil
+	p.shifted = shiftedLine{start: -1}
+	prevEnd := -1 // End of the previous literal, for WithPerLine
+	for match != nil {
+		next, err := p.next(match, runes)
+		if err != nil {
+			return err
+		}
+		p.stats.Matches++
+		for len(folds) > 0 && folds[0].end <= match.Index {
+			folds = folds[1:]
+		}
+		if len(folds) > 0 && folds[0].start <= match.Index {
+			// The literal is part of a chain that is rewritten as a whole
+			f := folds[0]
+			p.copy(string(runes[currentIndex:f.start]))
+			p.rangeEnd = nil
+			p.rewriteFold(runes, f)
+			for next != nil && next.Index < f.end {
+				p.stats.Matches++
+				if next, err = p.next(next, runes); err != nil {
+					return err
+				}
+			}
+			currentIndex, prevEnd = f.end, f.end
+			match = next
+			continue
+		}
+		// Copy the part of the content before the current match
+		p.copy(string(runes[currentIndex:match.Index]))
+
+		bigNum, spliced, err := p.valueOf(match)
+		if err != nil {
+			return err
+		}
+
+		m := Match{Text: match.String(), Value: bigNum, Offset: p.offset, Line: p.line, Column: p.col}
+		m.Arithmetic = arithmeticOperand(runes, match.Index, match.Index+match.Length)
+		m.IntType = p.intType(runes, match.Index, match.Index+match.Length)
+		if p.f.opts.decide != nil || p.f.opts.onResult != nil {
+			m.Context = lineContext(runes, match.Index, match.Index+match.Length)
+		}
+		var notes []string
+		annotation := ""
+		m.Expr, notes = p.propose(&m, runes, match, next, dirs)
+		out := p.decide(m)
+		vetoed := out == m.Text
+		if out != m.Text && (!p.admit(m) || !p.perLineAllows(runes, prevEnd, match.Index, match.Index+match.Length, nextStart(next))) {
+			out = m.Text
+		}
+		if out != m.Text {
+			if out == m.Expr {
+				p.notes = append(p.notes, notes...)
+			}
+			var tag string
+			if out, tag = p.f.tagged(out); tag != "" {
+				p.notes = append(p.notes, tag)
+			}
+			// Keep the physical lines of a continued literal
+			out += spliced
+			p.replace(m, out)
+		} else {
+			if m.Expr == m.Text && len(notes) > 0 {
+				p.notes = append(p.notes, notes...) // Annotated in a line comment only
+				if _, tag := p.f.tagged(m.Text); tag != "" {
+					p.notes = append(p.notes, tag)
+				}
+				annotation = strings.Join(notes, ", ")
+				p.stats.Annotated++
+			}
+			p.copy(m.Text) // Write original number if no replacement or not over threshold
+		}
+		if p.f.opts.onResult != nil {
+			r := Result{Match: m, Replaced: out != m.Text, Output: out, Annotation: annotation}
+			if !r.Replaced {
+				r.Skipped = p.skipReason(m, runes, match.Index, match.Index+match.Length, dirs, vetoed)
+			}
+			p.f.opts.onResult(r)
+		}
+
+		currentIndex = match.Index + match.Length
+		prevEnd = currentIndex
+		match = next
+	}
+
+	// Copy the rest of the content after the last match (or the whole content if no matches)
+	p.copy(string(runes[currentIndex:]))
+	p.keepContext(runes)
+	return p.flushErr()
+}
+
+// valueOf returns the value of match and, with WithContinuations, the line
+// continuations it spans.
+func (p *pass) valueOf(match *regexp2.Match) (*big.Int, string, error) {
+	if lp := p.f.parserOf(match); lp != nil {
+		v, _ := lp.Parse(match.String()) // next only returns literals the parser accepts
+		return v, "", nil
+	}
+	// The group holds the digits, such as those of `(\d{3,})`, which parse as base 10
+	numStr := match.Groups()[p.f.group].String()
+	var spliced string
+	if p.f.opts.continuations {
+		spliced = continuationsIn(numStr)
+		numStr = digitsOf(numStr)
+	}
+	v, ok := new(big.Int).SetString(numStr, 10)
+	if !ok {
+		return nil, "", Errorf(ErrPatternInvalid, "match", "number pattern", "capture only the digits of a number in the first group",
+			"match %d, %q, holds %q, which is not a decimal number", p.found, match.String(), numStr)
+	}
+	return v, spliced, nil
+}
+
+// nextStart returns the rune offset of match, or -1 if it is nil.
+func nextStart(match *regexp2.Match) int {
+	if match == nil {
+		return -1
+	}
+	return match.Index
+}
+
+// next returns the first match after prev, or in runes if prev is nil, that
+// the adjacency rule accepts, or nil if there is none. Every match is checked
+// on the way, so that a custom pattern cannot make the pass overwrite text.
+func (p *pass) next(prev *regexp2.Match, runes []rune) (*regexp2.Match, error) {
+	var match *regexp2.Match
+	var err error
+	if prev == nil {
+		match, err = p.f.re.FindRunesMatch(runes)
+	} else {
+		match, err = p.f.re.FindNextMatch(prev)
+	}
+	for ; match != nil && err == nil; match, err = p.f.re.FindNextMatch(match) {
+		if err := p.checkMatch(match); err != nil {
+			return nil, err
+		}
+		if !p.glued(runes, match.Index, match.Index+match.Length) && p.f.parsed(match) {
+			return match, nil
+		}
+	}
+	if err != nil {
+		// The error of regexp2 quotes the whole input, so it is left out
+		return nil, Errorf(ErrMatchTimeout, "match", "number pattern", "simplify the pattern or raise the match timeout",
+			"%q found no match within %v after match %d", p.f.re.String(), p.f.re.MatchTimeout, p.found)
+	}
+	return nil, nil
+}
+
+// checkMatch rejects a match that is empty, which would stall the pass, or
+// whose digits lie outside it, which would overlap the text around it. Only
+// a custom pattern can produce them.
+func (p *pass) checkMatch(match *regexp2.Match) error {
+	p.found++
+	if match.Length == 0 {
+		return Errorf(ErrPatternInvalid, "match", "number pattern", "make every match consume the number, e.g. with + rather than *",
+			"match %d of %q is empty", p.found, p.f.re.String())
+	}
+	if p.f.parserOf(match) != nil {
+		return nil // The whole match is the literal
+	}
+	g := match.Groups()[p.f.group]
+	if g.Index < match.Index || g.Index+g.Length > match.Index+match.Length {
+		return Errorf(ErrPatternInvalid, "match", "number pattern", "keep the digits group out of lookahead and lookbehind",
+			"match %d, %q, of %q captures %q outside itself, overlapping the text after it", p.found, match.String(), p.f.re.String(), g.String())
+	}
+	return nil
+}
+
+// propose works out the replacement for m, the literal found by match, and the
+// notes that go at the end of its line. next is the following match, if any,
+// which is needed to recognize ranges. Literals under a directive are never
+// part of a range.
+func (p *pass) propose(m *Match, runes []rune, match, next *regexp2.Match, dirs *lineDirectives) (string, []string) {
+	threshold := p.threshold(runes, match.Index, match.Index+match.Length)
+	if m.Arithmetic && p.f.opts.skipArithmetic {
+		p.rangeEnd = nil
+		return "", nil
+	}
+	if d := dirs.lookup(match.Index); d != nil || p.ignoreFile {
+		p.rangeEnd = nil
+		if p.ignoreFile || d.ignore {
+			return "", nil
+		}
+		return notesOf(p.f.propose(m, d, threshold))
+	}
+	if end := p.rangeEnd; end != nil && end.index == match.Index {
+		p.rangeEnd = nil
+		expr, note := p.f.emitCandidate(m, end.c, p.f.render(end.c, m.IntType), p.f.opts.emit)
+		var notes []string
+		if note != "" {
+			notes = append(notes, note)
+		}
+		if end.note != "" {
+			if prof := p.f.opts.profile; prof.LineComment != "" {
+				notes = append(notes, end.note)
+			} else {
+				expr += " " + prof.BlockComment[0] + " " + end.note + " " + prof.BlockComment[1]
+			}
+		}
+		return expr, notes
+	}
+	if next != nil && p.f.opts.ranges {
+		between := runes[match.Index+match.Length : next.Index]
+		nextValue, _, err := p.valueOf(next)
+		sameLine := err == nil && !slices.Contains(between, '\n')
+		if p.f.opts.skipArithmetic && arithmeticOperand(runes, next.Index, next.Index+next.Length) || dirs.lookup(next.Index) != nil {
+			sameLine = false // The end will be kept, so there is no pair
+		}
+		if c, end, ok := p.f.rangeStart(m.Value, nextValue, sameLine); ok && p.f.render(end.c, m.IntType) != "" {
+			end.index = next.Index
+			p.rangeEnd = end
+			return notesOf(p.f.emitCandidate(m, c, p.f.render(c, m.IntType), p.f.opts.emit))
+		}
+	}
+	return notesOf(p.f.propose(m, nil, threshold))
+}
+
+func notesOf(expr, note string) (string, []string) {
+	if note != "" {
+		return expr, []string{note}
+	}
+	return expr, nil
+}
+
+// decide returns the text to write for m, consulting the decision function if set.
+func (p *pass) decide(m Match) string {
+	proposed := m.Text
+	if m.Expr != "" {
+		proposed = m.Expr
+	}
+	if p.f.opts.decide == nil {
+		return proposed
+	}
+	d := p.f.opts.decide(m)
+	switch {
+	case d.Skip:
+		return m.Text
+	case d.Replacement != "":
+		return d.Replacement
+	}
+	return proposed
+}
+
+// replace writes out in place of the matched text.
+func (p *pass) replace(m Match, out string) {
+	newOffset := p.stats.BytesWritten
+	p.write(out)
+	p.advance(m.Text)
+	p.stats.Replaced++
+	if p.f.opts.onEdit != nil {
+		p.f.opts.onEdit(Edit{
+			Offset:      m.Offset,
+			Length:      int64(len(m.Text)),
+			NewOffset:   newOffset,
+			NewLength:   int64(len(out)),
+			Original:    m.Text,
+			Replacement: out,
+		})
+	}
+}
+
+// copy writes input text through unchanged.
+func (p *pass) copy(s string) {
+	if len(p.notes) > 0 {
+		if i := p.lineEnd(s); i >= 0 {
+			// Close the current line with its pending notes first
+			eol := i
+			if eol > 0 && s[eol-1] == '\r' {
+				eol--
+			}
+			p.write(s[:eol])
+			p.advance(s[:eol])
+			p.flushNotes()
+			p.write(s[eol:])
+			p.advance(s[eol:])
+			return
+		}
+	}
+	p.write(s)
+	p.advance(s)
+}
+
+// flushNotes writes the pending notes as a line comment, which is an edit
+// that inserts it at the current input position.
+func (p *pass) flushNotes() {
+	if len(p.notes) == 0 {
+		return
+	}
+	comment := " " + p.f.opts.profile.LineComment + " " + strings.Join(p.notes, ", ")
+	newOffset := p.stats.BytesWritten
+	p.write(comment)
+	p.notes = p.notes[:0]
+	if p.f.opts.onEdit != nil {
+		p.f.opts.onEdit(Edit{Offset: p.offset, NewOffset: newOffset, NewLength: int64(len(comment)), Replacement: comment})
+	}
+}
+
+func (p *pass) write(s string) {
+	n, _ := p.w.WriteString(s)
+	p.stats.BytesWritten += int64(n)
+}
+
+// advance moves the input position past s.
+func (p *pass) advance(s string) {
+	p.offset += int64(len(s))
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.line += strings.Count(s, "\n")
+		p.col = len(s) - i
+	} else {
+		p.col += len(s)
+	}
+}
+
+// flushErr reports a sticky write error from the buffered writer, if any.
+func (p *pass) flushErr() error {
+	if _, err := p.w.Write(nil); err != nil {
+		return writeFailed(err)
+	}
+	return nil
+}
+
+// stream is the bounded-memory counterpart of reading everything at once. It
+// reads src in chunks of roughly chunkSize bytes and only hands complete
+// segments to segment: a segment always ends right after an ASCII byte that
+// is not a letter or digit, so no number spans two segments. At least the
+// context window of characters is held back after every cut, so the adjacency
+// rule sees the same context as without streaming.
+func (p *pass) stream(src io.Reader, chunkSize int) error {
+	reserve := p.f.opts.window * utf8.UTFMax
+	buf := make([]byte, 0, chunkSize)
+	chunk := make([]byte, chunkSize)
+	headerDone := false
+	for {
+		n, readErr := src.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		p.stats.BytesRead += int64(n)
+
+		// Wait for the whole header unless it is unreasonably long
+		if !headerDone && (bytes.Count(buf, []byte("\n")) >= headerLines || readErr != nil || len(buf) >= maxHeaderBytes) {
+			rest, err := p.header(buf)
+			if err != nil {
+				return err
+			}
+			buf = append(buf[:0], rest...)
+			headerDone = true
+		}
+		if !headerDone {
+			continue
+		}
+
+		if readErr == io.EOF {
+			// Everything left is the final segment
+			p.tail = nil
+			return p.segment(string(buf))
+		}
+		if readErr != nil {
+			return NewError(ErrReadFailed, "read", "input", readErr, "")
+		}
+
+		if len(buf) <= reserve {
+			continue
+		}
+		cut := lastSegmentBoundary(buf[:len(buf)-reserve], p.f.opts.continuations)
+		if p.f.opts.perLine != "" && p.f.opts.perLine != PerLineAll || p.f.opts.ranges {
+			// Lines stay whole, for the limits per line and the ranges on one
+			cut = bytes.LastIndexByte(buf[:len(buf)-reserve], '\n') + 1
+		}
+		if cut == 0 {
+			// No safe boundary yet (a very long run of letters/digits); keep reading
+			continue
+		}
+		p.tail = []rune(string(buf[cut : cut+reserve]))[:p.f.opts.window]
+		if err := p.segment(string(buf[:cut])); err != nil {
+			return err
+		}
+		// Carry the unfinished tail over to the next round
+		buf = append(buf[:0], buf[cut:]...)
+	}
+}
+
+// maxContext caps how many characters of the line around a match are kept in
+// Match.Context on either side, so very long lines stay cheap.
+const maxContext = 256
+
+// lineContext returns the line around runes[start:end].
+func lineContext(runes []rune, start, end int) string {
+	from := start
+	for from > 0 && start-from < maxContext && runes[from-1] != '\n' {
+		from--
+	}
+	to := end
+	for to < len(runes) && to-end < maxContext && runes[to] != '\n' {
+		to++
+	}
+	if to > from && to > end && runes[to-1] == '\r' {
+		to--
+	}
+	return string(runes[from:to])
+}
+
+// lastSegmentBoundary returns the length of the longest prefix of buf that ends
+// with a newline or, failing that, with an ASCII non-alphanumeric byte, or 0 if
+// there is none. Cutting at newlines keeps lines whole, which Match.Context and
+// comment directives rely on. With continuations, logical lines are kept
+// whole instead, and no cut falls inside a line continuation.
+func lastSegmentBoundary(buf []byte, continuations bool) int {
+	for end := len(buf); ; {
+		i := bytes.LastIndexByte(buf[:end], '\n')
+		if i < 0 {
+			break
+		}
+		if !continuations || !continued(string(buf[max(i-2, 0):i])) {
+			return i + 1
+		}
+		end = i
+	}
+	for i := len(buf) - 1; i >= 0; i-- {
+		c := buf[i]
+		if continuations && (c == '\\' || c == '\r' || c == '\n') {
+			continue
+		}
+		if c < 0x80 && !isASCIIAlnum(c) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func isASCIIAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func writeFailed(err error) error {
+	return NewError(ErrWriteFailed, "write", "output", err,
+		"check that the destination is writable and has free space")
+}
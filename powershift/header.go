@@ -0,0 +1,56 @@
+package powershift
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// headerLines is how many lines at the top of a file may hold a modeline;
+// Vim looks at the first five by default.
+const headerLines = 5
+
+// maxHeaderBytes bounds how much input streaming waits for before it checks
+// the header, in case the first lines are very long.
+const maxHeaderBytes = 64 << 10
+
+var (
+	utf8BOM = []byte("\xEF\xBB\xBF")
+
+	// modelinePattern recognizes Vim ("vim: set tw=120:") and Emacs
+	// ("-*- fill-column: 120 -*-") modelines.
+	modelinePattern = regexp.MustCompile(`(?:^|\s)(?:vi|vim[<=>]?\d*|ex):|-\*-.*-\*-`)
+)
+
+// header passes the top of content through: a UTF-8 byte order mark, a
+// shebang line and modelines among the first headerLines lines are copied
+// byte for byte and never matched, whatever the options or profile. The
+// other header lines are formatted as usual. header returns what it has not
+// written yet.
+func (p *pass) header(content []byte) ([]byte, error) {
+	if bytes.HasPrefix(content, utf8BOM) {
+		p.copy(string(utf8BOM))
+		content = content[len(utf8BOM):]
+	}
+	pending := 0 // Length of the unprotected lines before the current one
+	rest := content
+	for i := 0; i < headerLines && len(rest) > 0; i++ {
+		n := bytes.IndexByte(rest, '\n') + 1
+		if n == 0 {
+			n = len(rest)
+		}
+		line := rest[:n]
+		rest = rest[n:]
+		if !(i == 0 && bytes.HasPrefix(line, []byte("#!")) || modelinePattern.Match(line)) {
+			pending += n
+			continue
+		}
+		if pending > 0 {
+			if err := p.segment(string(content[:pending])); err != nil {
+				return nil, err
+			}
+		}
+		p.copy(string(line))
+		content, pending = rest, 0
+	}
+	return content, nil
+}
@@ -0,0 +1,100 @@
+package powershift
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHeaderPassthrough(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "bom",
+			input: "\xEF\xBB\xBFsize = 1048576\n",
+			want:  "\xEF\xBB\xBFsize = 1 << 20\n",
+		},
+		{
+			name:  "shebang",
+			input: "#!/usr/bin/env -S tool --mem 1048576\nsize = 1048576\n",
+			want:  "#!/usr/bin/env -S tool --mem 1048576\nsize = 1 << 20\n",
+		},
+		{
+			name:  "bom and shebang",
+			input: "\xEF\xBB\xBF#!/bin/sh 65536\nx=65536\n",
+			want:  "\xEF\xBB\xBF#!/bin/sh 65536\nx=1 << 16\n",
+		},
+		{
+			name:  "vim modeline after other lines",
+			input: "a = 4096\n\n# vim: set tw=1048576:\nb = 4096\n",
+			want:  "a = 1 << 12\n\n# vim: set tw=1048576:\nb = 1 << 12\n",
+		},
+		{
+			name:  "emacs modeline",
+			input: "/* -*- fill-column: 65536 -*- */\nx = 65536\n",
+			want:  "/* -*- fill-column: 65536 -*- */\nx = 1 << 16\n",
+		},
+		{
+			name:  "no trailing newline",
+			input: "#!/bin/sh 65536",
+			want:  "#!/bin/sh 65536",
+		},
+		{
+			name:  "shebang after the first line",
+			input: "x = 65536\n#!/bin/sh 65536\n",
+			want:  "x = 1 << 16\n#!/bin/sh 1 << 16\n",
+		},
+		{
+			name:  "modeline below the header",
+			input: strings.Repeat("\n", headerLines) + "# vim: set tw=65536:\n",
+			want:  strings.Repeat("\n", headerLines) + "# vim: set tw=1 << 16:\n",
+		},
+	}
+	for _, streamed := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			opts := []Option{}
+			if streamed {
+				name += " streamed"
+				opts = append(opts, WithChunkSize(minChunkSize))
+			}
+			t.Run(name, func(t *testing.T) {
+				f, err := New(opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var out strings.Builder
+				_, err = f.Transform(&out, iotest.OneByteReader(strings.NewReader(tt.input)))
+				got := out.String()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestHeaderIsNeverMatched(t *testing.T) {
+	var lines []int
+	f, err := New(WithResultFunc(func(r Result) { lines = append(lines, r.Line) }), WithDecisionFunc(func(m Match) Decision {
+		if m.Line == 1 {
+			t.Errorf("the shebang line was offered for matching: %q", m.Text)
+		}
+		return Accept
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.String("#!/bin/sh 1048576\nx = 1048576\n"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != 2 {
+		t.Errorf("numbers found on lines %v, want only line 2", lines)
+	}
+}
@@ -0,0 +1,165 @@
+package powershift
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// rustIntTypes are the integer types of Rust and their widths. usize is
+// taken to be 64 bits wide.
+var rustIntTypes = map[string]int{
+	"u8": 8, "u16": 16, "u32": 32, "u64": 64, "u128": 128, "usize": 64,
+	"i8": -8, "i16": -16, "i32": -32, "i64": -64, "i128": -128, "isize": -64,
+}
+
+// WithIntType gives every literal the integer type name, one of the IntTypes
+// of the language such as "u64" in Rust, instead of the type inferred from its
+// line.
+func WithIntType(name string) Option {
+	return func(o *options) error {
+		o.intType = name
+		return nil
+	}
+}
+
+// intSuffixPattern matches a type suffix of types, with the underscore Rust
+// allows before it. It follows numberPattern in languages with IntTypes, so
+// that a literal such as 340282366920938463463374607431768211455u128 or
+// 4096_u32 is matched as a whole instead of being glued to its suffix.
+func intSuffixPattern(types map[string]int) string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	// Longest first, so that i128 is not cut short as i1
+	slices.SortFunc(names, func(a, b string) int { return cmp.Or(len(b)-len(a), strings.Compare(a, b)) })
+	return fmt.Sprintf(`_?(?:%s)`, strings.Join(names, "|"))
+}
+
+// maskIntSuffixes blanks the type suffixes of the literals in s, as the u64 of
+// 1u64 << 20, so that the expressions of typed literals are read like the
+// others. The offsets of s are kept.
+func (f *Formatter) maskIntSuffixes(s string) string {
+	if f.suffixRe == nil {
+		return s
+	}
+	return f.suffixRe.ReplaceAllStringFunc(s, func(m string) string {
+		return m[:1] + strings.Repeat(" ", len(m)-1)
+	})
+}
+
+// intSuffix returns the type suffix of the first literal of expr, as
+// written, or "" if it has none.
+func (f *Formatter) intSuffix(expr string) string {
+	if f.suffixRe == nil {
+		return ""
+	}
+	if sub := f.suffixRe.FindStringSubmatch(expr); sub != nil {
+		return sub[1]
+	}
+	return ""
+}
+
+// splitIntSuffix splits a type suffix of p, as written and with the
+// underscore before it, off the literal text, and returns the type it names.
+func splitIntSuffix(text string, p Profile) (digits, suffix, t string) {
+	for name := range p.IntTypes {
+		rest, ok := strings.CutSuffix(text, name)
+		if !ok || len(name) <= len(t) {
+			continue
+		}
+		digits = strings.TrimSuffix(rest, "_")
+		if digits != "" && isDecimalDigit(rune(digits[len(digits)-1])) {
+			suffix, t = text[len(digits):], name
+		}
+	}
+	if t == "" {
+		return text, "", ""
+	}
+	return text[:len(text)-len(suffix)], suffix, t
+}
+
+// intTypePattern finds the integer type a line gives its literals: the type
+// of a declaration or cast, as in ": u64 =" and "as u128", or the suffix of
+// another literal, as in 1u64.
+func intTypePattern(types map[string]int) *regexp.Regexp {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	alt := strings.Join(names, "|")
+	return regexp.MustCompile(fmt.Sprintf(`(?::\s*|\bas\s+|\d)(%s)\b|\b(%s)::`, alt, alt))
+}
+
+// intType returns the type of the literal at runes[start:end] for a profile
+// with IntTypes, or "" if it is not known. In a language with a LongSuffix it
+// is the suffix if the literal has it, and in one with IntTypes the type
+// suffix of the literal comes before any other.
+func (p *pass) intType(runes []rune, start, end int) string {
+	if prof := p.f.opts.profile; hasLongSuffix(string(runes[start:end]), prof) {
+		return prof.LongSuffix
+	}
+	if p.f.typeRe == nil {
+		return ""
+	}
+	if _, _, t := splitIntSuffix(digitsOf(string(runes[start:end])), p.f.opts.profile); t != "" {
+		return t
+	}
+	if p.f.opts.intType != "" {
+		return p.f.opts.intType
+	}
+	sub := p.f.typeRe.FindStringSubmatch(lineContext(runes, start, end))
+	if sub == nil {
+		return ""
+	}
+	return sub[1] + sub[2]
+}
+
+// renderTyped renders c for a literal of the integer type t by suffixing its
+// leading literal with t, as in (1u64<<20) - 1. In Rust a shift by the width
+// of the type or more does not compile, and neither does shifting into the
+// sign bit and subtracting, so such candidates give "", except for the
+// maximum of the type, which is written as u32::MAX.
+func renderTyped(c Candidate, p Profile, t string) string {
+	bound := p.IntTypes[t]
+	if bound < 0 {
+		bound = -bound - 1 // The sign bit
+	}
+	if c.Form == FormMinusOne && c.N == bound && c.M == 0 {
+		return t + "::MAX"
+	}
+	if widestShift(c) >= bound {
+		return ""
+	}
+	return renderSuffixed(c, p, t)
+}
+
+// widestShift returns the largest shift in the rendering of c.
+func widestShift(c Candidate) int {
+	switch {
+	case c.Form == FormPower || c.Form == FormMultiple:
+		return c.N
+	case c.Form == FormPlusOne && c.N == 0:
+		return c.M + 1
+	case c.Form == FormMinusOne && c.N <= 1:
+		return c.M
+	}
+	return max(c.N, c.M)
+}
+
+// intTypeHint lists the integer types of p for an error about WithIntType.
+func intTypeHint(p Profile) string {
+	if p.IntTypes == nil {
+		return "pick a language with integer type suffixes, such as rust"
+	}
+	names := make([]string, 0, len(p.IntTypes))
+	for name := range p.IntTypes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return fmt.Sprintf("known types are %v", names)
+}
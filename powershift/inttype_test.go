@@ -0,0 +1,50 @@
+package powershift
+
+import "testing"
+
+func TestRustTypeSuffix(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+		emit              Emit
+	}{
+		{name: "maximum", input: "340282366920938463463374607431768211455u128", want: "u128::MAX"},
+		{name: "suffix is the type", input: "let b = 1048576u64;", want: "let b = 1u64 << 20;"},
+		{name: "suffix before the declared type", input: "let b: u32 = 1048576u64;", want: "let b: u32 = 1u64 << 20;"},
+		{name: "underscore", input: "let c = 4095_u32;", want: "let c = (1u32<<12) - 1;"},
+		{name: "does not fit", input: "let e = 4294967296u32;", want: "let e = 4294967296u32;"},
+		{name: "hex keeps the suffix", input: "let b = 1048576u64;", want: "let b = 0x100000u64;", emit: EmitHex},
+		{name: "grouped keeps the suffix", input: "let c = 4095_u32;", want: "let c = 4_095_u32;", emit: EmitGrouped},
+		{name: "not a type", input: "let d = 1048576ms;", want: "let d = 1048576ms;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithLanguage("rust")}
+			if tt.emit != "" {
+				opts = append(opts, WithEmit(tt.emit))
+			}
+			f, err := New(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := f.String(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRustTypeSuffixReverse(t *testing.T) {
+	f, err := New(WithLanguage("rust"), WithReverse(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "let b = 1u64 << 20;\nlet c = (1u32<<12) - 1;\nlet g = (1usize << 20 /* 1048576usize */);\n"
+	want := "let b = 1048576u64;\nlet c = 4095u32;\nlet g = 1048576usize;\n"
+	if got, _, err := f.String(in); err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
@@ -0,0 +1,68 @@
+package powershift
+
+import "strings"
+
+// WithNamedConstants writes the maximum values of the integer types by name,
+// as Long.MAX_VALUE in Java, in languages that list them in MaxValues.
+func WithNamedConstants() Option {
+	return func(o *options) error {
+		o.namedConstants = true
+		return nil
+	}
+}
+
+// longSuffixPattern follows numberPattern in languages with a LongSuffix, so
+// that 1099511627776L is matched as a whole instead of being glued to its
+// suffix.
+const longSuffixPattern = `[lL]?`
+
+// hasLongSuffix reports whether the literal text ends in the LongSuffix of p.
+func hasLongSuffix(text string, p Profile) bool {
+	return p.LongSuffix != "" && strings.HasSuffix(strings.ToUpper(text), p.LongSuffix)
+}
+
+// splitLongSuffix splits the LongSuffix of p, as written, off the literal
+// text.
+func splitLongSuffix(text string, p Profile) (digits, suffix string) {
+	if hasLongSuffix(text, p) {
+		return text[:len(text)-len(p.LongSuffix)], text[len(text)-len(p.LongSuffix):]
+	}
+	return text, ""
+}
+
+// renderLong renders c in a language with a LongSuffix. Values beyond 32 bits,
+// and those of literals that had the suffix, are written with it, as in
+// (1L<<40) - 1. No expression shifts into the sign bit, so the maximum of a
+// type gives "" unless named is set, and so does a value beyond 63 bits.
+func renderLong(c Candidate, p Profile, long, named bool) string {
+	bits := c.N + c.M
+	if c.Form == FormPower || c.Form == FormSumOfPowers {
+		bits = c.N + 1
+	}
+	if c.Form == FormDifferenceOfPowers {
+		bits = c.N
+	}
+	if c.Form == FormMultiple {
+		bits = multipleBits(c)
+	}
+	if c.Form == FormPlusOne {
+		bits = c.N + c.M + 1
+		if c.N == 0 {
+			bits++
+		}
+	}
+	if bits > 63 {
+		return ""
+	}
+	if named && c.Form == FormMinusOne && c.M == 0 && (c.N == 63 || c.N == 31 && !long) {
+		return p.MaxValues[c.N]
+	}
+	bound, suffix := 31, ""
+	if long || bits > 31 {
+		bound, suffix = 63, p.LongSuffix
+	}
+	if widestShift(c) >= bound {
+		return ""
+	}
+	return renderSuffixed(c, p, suffix)
+}
@@ -0,0 +1,85 @@
+package powershift
+
+import "math/big"
+
+// Match describes a number found in the input.
+type Match struct {
+	Text   string   // The literal as it appears in the input
+	Value  *big.Int // Parsed value of Text
+	Offset int64    // Byte offset of Text in the input
+	Line   int      // 1-based line number
+	Column int      // 1-based byte column
+
+	// Context is the input line containing the match without its line
+	// terminator, cut to at most maxContext characters on either side of the
+	// match. It is only filled in when a decision or result function is set,
+	// and in streaming mode it may be cut short at chunk boundaries.
+	Context string
+
+	// Arithmetic reports that the literal is an operand of an arithmetic or
+	// bitwise operator, as in 1048576 * count or -1048575. Expressions proposed
+	// for it are parenthesized.
+	Arithmetic bool
+
+	// IntType is the integer type of the literal, as given by WithIntType or
+	// found on its line, empty if the language has no IntTypes or the line
+	// names none.
+	IntType string
+
+	// Candidate is the decomposition the Formatter would use and Expr the
+	// replacement it proposes. Both are empty when the number is not above the
+	// threshold or no configured form applies; with EmitGrouped and EmitHex there is an Expr
+	// but no Candidate.
+	Candidate *Candidate
+	Expr      string
+}
+
+// Decision tells the Formatter what to write for a Match. The zero value
+// accepts the proposed expression (or keeps the original if there is none).
+type Decision struct {
+	Skip        bool   // Keep the original text
+	Replacement string // Write this instead of the proposed expression
+}
+
+// DecisionFunc decides what to do with each match.
+type DecisionFunc func(m Match) Decision
+
+// Accept, Veto and ReplaceWith are shorthands for common decisions.
+var (
+	Accept = Decision{}
+	Veto   = Decision{Skip: true}
+)
+
+func ReplaceWith(s string) Decision {
+	return Decision{Replacement: s}
+}
+
+// Result reports what was written for a Match.
+type Result struct {
+	Match
+	Replaced bool   // Whether Output differs from Match.Text
+	Output   string // Text written in place of Match.Text
+
+	// Skipped tells why a literal that one of the configured forms
+	// decomposes was kept, empty if it was replaced or no form applies.
+	// Literals of a folded chain have no reason.
+	Skipped SkipReason
+
+	// Annotation is what was added for a literal that was kept but
+	// annotated in a line comment at the end of its line, as EmitAnnotate
+	// does in languages without block comments, empty otherwise.
+	Annotation string
+}
+
+// Edit records one replacement as a mapping from the original byte range to
+// the byte range it occupies in the output. A line comment the Formatter
+// adds, as for EmitBoth in languages without block comments, is an edit with
+// an empty Original.
+type Edit struct {
+	Offset      int64  `json:"offset"`     // Byte offset in the input
+	Length      int64  `json:"length"`     // Byte length in the input
+	NewOffset   int64  `json:"new_offset"` // Byte offset in the output
+	NewLength   int64  `json:"new_length"` // Byte length in the output
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
@@ -0,0 +1,42 @@
+package powershift
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// DefaultMaxMultiplier is the largest k of the multiple form when
+// WithMaxMultiplier is not given.
+const DefaultMaxMultiplier = 9
+
+// WithMaxMultiplier lets the multiple form write numbers k * 2^n with an odd
+// k of up to max, such as 11 << 16 for max >= 11. It has no effect unless the
+// form is tried.
+func WithMaxMultiplier(max int) Option {
+	return func(o *options) error {
+		if max < 3 {
+			return Errorf(ErrInvalidOption, "set", "max multiplier", "the smallest multiplier that is not a power of two is 3",
+				"the maximum multiplier %d is below 3", max)
+		}
+		o.maxMultiplier = max
+		return nil
+	}
+}
+
+// multiple decomposes num into k * 2^n with an odd k from 3 to max and n >= 1.
+func multiple(num *big.Int, max int) (Candidate, bool) {
+	if num.Sign() <= 0 {
+		return Candidate{}, false
+	}
+	n := int(num.TrailingZeroBits())
+	k := new(big.Int).Rsh(num, uint(n))
+	if n == 0 || !k.IsInt64() || k.Int64() < 3 || k.Int64() > int64(max) {
+		return Candidate{}, false
+	}
+	return Candidate{Form: FormMultiple, N: n, M: int(k.Int64())}, true
+}
+
+// multipleBits returns the bit length of the value of c, a multiple.
+func multipleBits(c Candidate) int {
+	return c.N + bits.Len(uint(c.M))
+}
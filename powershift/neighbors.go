@@ -0,0 +1,58 @@
+package powershift
+
+import (
+	"math/big"
+	"unicode/utf8"
+)
+
+// WithShiftedNeighbors rewrites the literals of a line that already holds a
+// shift expression even when they are not above the threshold, so the raw
+// entries of a half-converted table of masks are completed. Literals inside
+// such an expression are left alone.
+func WithShiftedNeighbors() Option {
+	return func(o *options) error {
+		o.shiftedNeighbors = true
+		return nil
+	}
+}
+
+// noThreshold is the threshold of a literal next to a shift expression.
+var noThreshold = new(big.Int)
+
+// shiftedLine remembers the shift expressions of the line last looked at.
+type shiftedLine struct {
+	start int      // Rune index at which the line begins, -1 if none was looked at
+	spans [][2]int // Rune ranges of its shift expressions
+}
+
+// threshold returns the threshold for the literal at runes[start:end].
+func (p *pass) threshold(runes []rune, start, end int) *big.Int {
+	if !p.f.opts.shiftedNeighbors {
+		return p.f.opts.threshold
+	}
+	from := start
+	for from > 0 && runes[from-1] != '\n' {
+		from--
+	}
+	if p.shifted.start != from {
+		to := end
+		for to < len(runes) && runes[to] != '\n' {
+			to++
+		}
+		line := string(runes[from:to])
+		p.shifted = shiftedLine{start: from}
+		for _, loc := range exprPattern.FindAllStringIndex(line, -1) {
+			s := from + utf8.RuneCountInString(line[:loc[0]])
+			p.shifted.spans = append(p.shifted.spans, [2]int{s, s + utf8.RuneCountInString(line[loc[0]:loc[1]])})
+		}
+	}
+	if len(p.shifted.spans) == 0 {
+		return p.f.opts.threshold
+	}
+	for _, span := range p.shifted.spans {
+		if start < span[1] && end > span[0] {
+			return p.f.opts.threshold
+		}
+	}
+	return noThreshold
+}
@@ -0,0 +1,133 @@
+package powershift
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// HexCase selects how Normalize writes the digits of hex literals.
+type HexCase string
+
+const (
+	HexKeep  HexCase = ""      // Leave the digits as they are
+	HexUpper HexCase = "upper" // 0xFF, as EmitHex writes them
+	HexLower HexCase = "lower" // 0xff
+)
+
+// Grouping selects how Normalize writes the digits of decimal literals.
+type Grouping string
+
+const (
+	GroupKeep  Grouping = ""        // Only fix literals whose groups are not of three digits
+	GroupAll   Grouping = "grouped" // Group literals of five or more digits
+	GroupPlain Grouping = "plain"   // Remove digit separators
+)
+
+// NormalizeOptions selects the canonical style of Formatter.Normalize.
+type NormalizeOptions struct {
+	Hex      HexCase
+	Grouping Grouping
+
+	// StripZeros removes the leading zeros of hex literals, as in 0x00FF.
+	// Leading zeros of decimal literals are always kept: C-family languages
+	// read them as octal, and Python and TOML reject them.
+	StripZeros bool
+}
+
+// minGroupedDigits is the shortest literal GroupAll groups, so that four
+// digit values such as ports and years stay as they are.
+const minGroupedDigits = 5
+
+// Normalize rewrites the numeric literals of s in one canonical style
+// without introducing expressions, and returns the result with the edits
+// made. Hex literals and decimal literals are found with the adjacency rule
+// and the digit separator of the Formatter's language. Digit groups are left
+// alone in languages whose separator is a comma, where 1,00 may well be a
+// list, and decimals next to a dot, which may be part of a float or a version.
+func (f *Formatter) Normalize(s string, n NormalizeOptions) (string, []Edit) {
+	sep := f.opts.profile.DigitSeparator
+	pattern := `0[xX][0-9a-fA-F]+`
+	if sep != "" && sep != "," {
+		q := regexp.QuoteMeta(sep)
+		pattern = `0[xX][0-9a-fA-F]+(?:` + q + `[0-9a-fA-F]+)*|\d+(?:` + q + `\d+)*`
+	}
+	re := regexp.MustCompile(pattern)
+
+	var sb strings.Builder
+	var edits []Edit
+	last := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if f.gluedAt(s, start, end) {
+			continue
+		}
+		text := s[start:end]
+		var out string
+		if len(text) > 1 && (text[1] == 'x' || text[1] == 'X') {
+			out = normalizeHex(text, sep, n)
+		} else {
+			if start > 0 && s[start-1] == '.' || end < len(s) && s[end] == '.' {
+				continue
+			}
+			out = normalizeDecimal(text, sep, n.Grouping)
+		}
+		if out == text {
+			continue
+		}
+		sb.WriteString(s[last:start])
+		edits = append(edits, Edit{
+			Offset: int64(start), Length: int64(len(text)),
+			NewOffset: int64(sb.Len()), NewLength: int64(len(out)),
+			Original: text, Replacement: out,
+		})
+		sb.WriteString(out)
+		last = end
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), edits
+}
+
+// gluedAt applies the adjacency rule to s[start:end].
+func (f *Formatter) gluedAt(s string, start, end int) bool {
+	from := start
+	for i := 0; i < f.opts.window && from > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(s[:from])
+		from -= size
+	}
+	to := end
+	for i := 0; i < f.opts.window && to < len(s); i++ {
+		_, size := utf8.DecodeRuneInString(s[to:])
+		to += size
+	}
+	return f.opts.adjacent(s[from:start], s[end:to])
+}
+
+func normalizeHex(text, sep string, n NormalizeOptions) string {
+	digits := text[2:]
+	if n.StripZeros && (sep == "" || !strings.Contains(digits, sep)) {
+		if digits = strings.TrimLeft(digits, "0"); digits == "" {
+			digits = "0"
+		}
+	}
+	switch n.Hex {
+	case HexUpper:
+		digits = strings.ToUpper(digits)
+	case HexLower:
+		digits = strings.ToLower(digits)
+	}
+	return "0x" + digits
+}
+
+func normalizeDecimal(text, sep string, g Grouping) string {
+	digits := strings.ReplaceAll(text, sep, "")
+	switch {
+	case g == GroupPlain:
+		return digits
+	case g == GroupAll && len(digits) >= minGroupedDigits:
+		return groupDigits(digits, sep)
+	case strings.Contains(text, sep):
+		return groupDigits(digits, sep)
+	}
+	return text
+}
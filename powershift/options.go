@@ -0,0 +1,274 @@
+package powershift
+
+import (
+	"math/big"
+	"time"
+)
+
+// DefaultThreshold is the threshold used when WithThreshold is not given:
+// only numbers strictly greater than it are rewritten.
+const DefaultThreshold int64 = 100
+
+// DefaultMinDigits is the length of the shortest digit run that is matched as
+// a number.
+const DefaultMinDigits = 3
+
+// Option configures a Formatter.
+type Option func(*options) error
+
+type options struct {
+	threshold *big.Int
+	minDigits int
+	ceiling   *big.Int // Nil if numbers of any size are rewritten
+	forms     []Form   // Those of the profile if nil
+	chunkSize int
+	decide    DecisionFunc
+	onEdit    func(Edit)
+	onResult  func(Result)
+	onWarning func(error)
+	emit      Emit
+	profile   Profile
+
+	ranges         bool
+	annotateRanges bool
+	skipArithmetic bool
+	fold           bool
+	maxTerms       int // Of the sum-of-powers form
+	maxMultiplier  int // Of the multiple form
+	scoring        Scoring
+	approx         float64 // Tolerance of WithApproximation, zero if off
+	approxMode     ApproxMode
+	weights        map[Form]int // Of WithFormWeights, nil if none
+	pattern        string       // Replaces numberPattern if set
+	parsers        []LiteralParser
+	matchTimeout   time.Duration
+	emitter        Emitter   // Nil for Render
+	exprStyle      ExprStyle // Of WithExprStyle, empty if not given
+	anyNotation    bool      // Of WithAnyNotation
+	intType        string    // Integer type of every literal, inferred per line if empty
+	namedConstants bool
+	cache          *Cache
+
+	adjacent        AdjacencyFunc
+	window          int
+	continuations   bool
+	tiers           []Tier
+	tag             string
+	reverse         bool
+	onlyTagged      bool
+	maxRatio        float64 // Zero if expressions may be any length
+	maxReplacements int     // Zero if unlimited
+	sample          float64 // Zero if every literal may be rewritten
+	perLine         PerLine
+
+	shiftedNeighbors bool
+}
+
+func defaultOptions() options {
+	return options{
+		threshold:     big.NewInt(DefaultThreshold),
+		minDigits:     DefaultMinDigits,
+		maxTerms:      DefaultMaxTerms,
+		maxMultiplier: DefaultMaxMultiplier,
+		scoring:       ScoreFirst,
+		emit:          EmitShift,
+		profile:       profiles[DefaultProfile],
+		adjacent:      AlnumAdjacent,
+		window:        DefaultContextWindow,
+
+		matchTimeout: DefaultMatchTimeout,
+	}
+}
+
+// WithThreshold only rewrites numbers strictly greater than t.
+func WithThreshold(t *big.Int) Option {
+	return func(o *options) error {
+		if t == nil {
+			return Errorf(ErrInvalidOption, "set", "threshold", "", "threshold must not be nil")
+		}
+		o.threshold = new(big.Int).Set(t)
+		return nil
+	}
+}
+
+// WithMinDigits only matches runs of at least n digits, so that with 4 the
+// likes of 255 and 512 are never looked at. It has no effect with WithPattern.
+func WithMinDigits(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return Errorf(ErrInvalidOption, "set", "min digits", "", "a number has at least 1 digit, got %d", n)
+		}
+		o.minDigits = n
+		return nil
+	}
+}
+
+// WithCeiling leaves numbers strictly greater than c alone, however far above
+// the threshold they are, such as the long constants of test vectors.
+func WithCeiling(c *big.Int) Option {
+	return func(o *options) error {
+		if c == nil {
+			return Errorf(ErrInvalidOption, "set", "ceiling", "", "ceiling must not be nil")
+		}
+		o.ceiling = new(big.Int).Set(c)
+		return nil
+	}
+}
+
+// inRange reports whether v is above the threshold t and not above the
+// ceiling.
+func (o *options) inRange(v, t *big.Int) bool {
+	return v.Cmp(t) > 0 && (o.ceiling == nil || v.Cmp(o.ceiling) <= 0)
+}
+
+// WithForms sets which forms are tried and in what order. The first form that
+// decomposes a number wins.
+func WithForms(forms ...Form) Option {
+	return func(o *options) error {
+		if len(forms) == 0 {
+			return Errorf(ErrInvalidOption, "set", "forms", "enable at least one form", "no forms given")
+		}
+		for _, f := range forms {
+			if _, err := ParseForm(string(f)); err != nil {
+				return err
+			}
+		}
+		o.forms = append([]Form(nil), forms...)
+		return nil
+	}
+}
+
+// minChunkSize is the smallest chunk Transform streams in, which holds back
+// enough of the input for the context of every cut.
+const minChunkSize = 64
+
+// WithChunkSize makes Transform stream its input in chunks of roughly size
+// bytes instead of reading it all into memory. Zero disables streaming, and
+// sizes below 64 bytes are raised to 64.
+func WithChunkSize(size int) Option {
+	return func(o *options) error {
+		if size < 0 {
+			return Errorf(ErrInvalidOption, "set", "chunk size", "use 0 to disable streaming", "negative chunk size %d", size)
+		}
+		if size > 0 {
+			size = max(size, minChunkSize)
+		}
+		o.chunkSize = size
+		return nil
+	}
+}
+
+// WithDecisionFunc consults fn for every number the pattern matches, including
+// those that are below the threshold or have no decomposition, so embedders can
+// veto or alter replacements programmatically.
+func WithDecisionFunc(fn DecisionFunc) Option {
+	return func(o *options) error {
+		o.decide = fn
+		return nil
+	}
+}
+
+// WithEditFunc calls fn for every replacement, in input order, with its
+// position in both the input and the output. Use it to remap positions held
+// against the original text.
+func WithEditFunc(fn func(Edit)) Option {
+	return func(o *options) error {
+		o.onEdit = fn
+		return nil
+	}
+}
+
+// WithWarningFunc calls fn for every problem Transform works around instead
+// of failing, such as a directive with an unknown value, whose literals are
+// then kept as they are. The error is an *Error that names the line.
+func WithWarningFunc(fn func(error)) Option {
+	return func(o *options) error {
+		o.onWarning = fn
+		return nil
+	}
+}
+
+// WithEmit selects what replacements look like (default EmitShift).
+func WithEmit(e Emit) Option {
+	return func(o *options) error {
+		if _, err := ParseEmit(string(e)); err != nil {
+			return err
+		}
+		o.emit = e
+		return nil
+	}
+}
+
+// WithLanguage selects the built-in profile of the target language, which
+// controls comment syntax and similar details of the output.
+func WithLanguage(name string) Option {
+	return func(o *options) error {
+		p, err := LookupProfile(name)
+		if err != nil {
+			return err
+		}
+		o.profile = p
+		return nil
+	}
+}
+
+// WithResultFunc calls fn for every matched number, in input order, after it
+// has been decided whether and how it is replaced. Unlike WithEditFunc it also
+// reports numbers that were kept.
+func WithResultFunc(fn func(Result)) Option {
+	return func(o *options) error {
+		o.onResult = fn
+		return nil
+	}
+}
+
+// WithSkipArithmetic keeps literals that are already an operand of an
+// arithmetic operator, as in 1048576 * count, so expressions do not grow
+// more complex. Without it such literals are rewritten in parentheses.
+func WithSkipArithmetic() Option {
+	return func(o *options) error {
+		o.skipArithmetic = true
+		return nil
+	}
+}
+
+// WithAdjacency replaces the rule that decides whether a digit run is glued to
+// its surroundings (default AlnumAdjacent). Use it to also leave alone, say,
+// numbers after an underscore or inside dotted version strings.
+func WithAdjacency(fn AdjacencyFunc) Option {
+	return func(o *options) error {
+		if fn == nil {
+			return Errorf(ErrInvalidOption, "set", "adjacency", "", "adjacency rule must not be nil")
+		}
+		o.adjacent = fn
+		return nil
+	}
+}
+
+// WithContextWindow sets how many characters on either side of a digit run
+// the adjacency rule sees (default DefaultContextWindow). Streaming holds back
+// about four bytes per character.
+func WithContextWindow(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return Errorf(ErrInvalidOption, "set", "context window", "use at least 1", "context window of %d characters", n)
+		}
+		o.window = n
+		return nil
+	}
+}
+
+// WithMaxLengthRatio only rewrites a literal when its expression is at most
+// ratio times as long as the literal's digits: 0.8 requires it to be 20%
+// shorter, 1.5 allows it to be half again as long. Only the expression is
+// measured, with its parentheses but without the comments of EmitBoth and
+// EmitAnnotate.
+func WithMaxLengthRatio(ratio float64) Option {
+	return func(o *options) error {
+		if !(ratio > 0) {
+			return Errorf(ErrInvalidOption, "set", "length ratio", "use a ratio above 0", "length ratio %g", ratio)
+		}
+		o.maxRatio = ratio
+		return nil
+	}
+}
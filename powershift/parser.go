@@ -0,0 +1,102 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+// LiteralParser recognizes the literals of a syntax the built-in pattern does
+// not know, such as the based literals 16#FFFF# of Ada or 2#1010 of Erlang,
+// so that they are rewritten like decimal ones.
+type LiteralParser interface {
+	// Pattern returns the ECMAScript regular expression of a whole literal.
+	// It must not capture, so its groups are written (?:...).
+	Pattern() string
+
+	// Parse returns the value of text, a literal that Pattern matched, or
+	// false if it is not a literal after all and must be left alone. It may
+	// be called more than once for the same literal.
+	Parse(text string) (*big.Int, bool)
+}
+
+// NewLiteralParser returns a LiteralParser of the given pattern and parse
+// function.
+func NewLiteralParser(pattern string, parse func(text string) (*big.Int, bool)) LiteralParser {
+	return funcParser{pattern, parse}
+}
+
+type funcParser struct {
+	pattern string
+	parse   func(string) (*big.Int, bool)
+}
+
+func (p funcParser) Pattern() string                    { return p.pattern }
+func (p funcParser) Parse(text string) (*big.Int, bool) { return p.parse(text) }
+
+// WithLiteralParser matches the literals of lp in addition to decimal ones.
+// Their values go through the same forms, thresholds and emit modes, and the
+// whole literal is replaced. When lp and the built-in pattern, or two
+// parsers, match at the same place, the parser given first wins. Parsers
+// cannot be combined with WithPattern.
+func WithLiteralParser(lp LiteralParser) Option {
+	return func(o *options) error {
+		if lp == nil {
+			return Errorf(ErrInvalidOption, "set", "literal parser", "", "the literal parser is nil")
+		}
+		o.parsers = append(o.parsers, lp)
+		return nil
+	}
+}
+
+// literalPattern prefixes pattern with the patterns of parsers, each in a
+// group of its own named lit0, lit1 and so on. regexp2 numbers named groups
+// after the others, so the digits of pattern stay in group 1.
+func literalPattern(parsers []LiteralParser, pattern string, timeout time.Duration) (string, error) {
+	var sb strings.Builder
+	for i, lp := range parsers {
+		re, err := compilePattern(lp.Pattern(), timeout)
+		if err != nil {
+			return "", err
+		}
+		if len(re.GetGroupNumbers()) > 1 {
+			return "", Errorf(ErrPatternInvalid, "compile", "literal parser", "group with (?:...) rather than (...)",
+				"the pattern %q of literal parser %d captures", lp.Pattern(), i)
+		}
+		fmt.Fprintf(&sb, "(?<lit%d>%s)|", i, lp.Pattern())
+	}
+	return sb.String() + pattern, nil
+}
+
+// parserGroups returns the group number of every parser of re, in the order
+// of parsers.
+func parserGroups(re *regexp2.Regexp, parsers []LiteralParser) []int {
+	groups := make([]int, len(parsers))
+	for i := range parsers {
+		groups[i] = re.GroupNumberFromName(fmt.Sprintf("lit%d", i))
+	}
+	return groups
+}
+
+// parserOf returns the parser that found match, or nil if the number pattern did.
+func (f *Formatter) parserOf(match *regexp2.Match) LiteralParser {
+	for i, g := range f.parserGroups {
+		if len(match.GroupByNumber(g).Captures) > 0 {
+			return f.opts.parsers[i]
+		}
+	}
+	return nil
+}
+
+// parsed reports whether match is a literal: a decimal number, or one that
+// its parser accepts.
+func (f *Formatter) parsed(match *regexp2.Match) bool {
+	if lp := f.parserOf(match); lp != nil {
+		v, ok := lp.Parse(match.String())
+		return ok && v != nil
+	}
+	return true
+}
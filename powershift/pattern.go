@@ -0,0 +1,115 @@
+package powershift
+
+import (
+	"time"
+
+	"github.com/dlclark/regexp2"
+)
+
+// DefaultMatchTimeout bounds the time a custom pattern may take to find one
+// match when WithMatchTimeout is not given.
+const DefaultMatchTimeout = time.Second
+
+// WithPattern replaces the pattern that finds numbers with expr, an ECMAScript
+// regular expression. Its first group holds the decimal digits of the number,
+// or the whole match if it has no group; the whole match is replaced. A match
+// that is empty or whose group lies outside it makes Transform fail with
+// ErrPatternInvalid rather than corrupt the output.
+//
+// Since the pattern may come from users, New rejects a repeated group that
+// already repeats, as in (\d+)+, which backtracks exponentially on input that
+// almost matches. Other slow patterns are stopped by the match timeout.
+func WithPattern(expr string) Option {
+	return func(o *options) error {
+		o.pattern = expr
+		return nil
+	}
+}
+
+// WithMatchTimeout bounds the time the pattern of WithPattern may take to find
+// one match. When it runs out, Transform fails with ErrMatchTimeout for that
+// input. The built-in pattern runs in linear time and is never timed out.
+func WithMatchTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return Errorf(ErrInvalidOption, "set", "match timeout", "", "timeout must be positive, got %v", d)
+		}
+		o.matchTimeout = d
+		return nil
+	}
+}
+
+// compilePattern compiles a custom pattern after checking its complexity.
+func compilePattern(expr string, timeout time.Duration) (*regexp2.Regexp, error) {
+	if i := nestedQuantifier(expr); i >= 0 {
+		return nil, Errorf(ErrPatternInvalid, "compile", "number pattern", "repeat the group or its content, not both, e.g. (\\d+) rather than (\\d+)+",
+			"the quantifier at offset %d of %q repeats a group that already repeats, which can take exponential time", i, expr)
+	}
+	re, err := regexp2.Compile(expr, regexp2.ECMAScript)
+	if err != nil {
+		return nil, NewError(ErrPatternInvalid, "compile", "number pattern", err,
+			"the pattern must be a valid ECMAScript regular expression")
+	}
+	re.MatchTimeout = timeout
+	return re, nil
+}
+
+// nestedQuantifier returns the byte offset of the first unbounded quantifier
+// applied to a group that holds one itself, or -1 if there is none.
+func nestedQuantifier(expr string) int {
+	var outer []bool     // Whether each enclosing group repeats so far
+	repeats := false     // Whether the current group holds an unbounded quantifier
+	afterRepeat := false // Whether the previous atom is a group that repeats
+	for i := 0; i < len(expr); i++ {
+		group := false
+		switch expr[i] {
+		case '\\':
+			i++
+		case '[':
+			for i++; i < len(expr) && expr[i] != ']'; i++ {
+				if expr[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			outer = append(outer, repeats)
+			repeats = false
+		case ')':
+			if len(outer) == 0 {
+				break
+			}
+			group, afterRepeat = true, repeats
+			repeats = repeats || outer[len(outer)-1]
+			outer = outer[:len(outer)-1]
+		case '*', '+':
+			if afterRepeat {
+				return i
+			}
+			repeats = true
+		case '{':
+			if j := indexByteFrom(expr, i, '}'); j > 0 && expr[j-1] == ',' {
+				if afterRepeat {
+					return i
+				}
+				repeats = true
+			}
+		case '?':
+			// A lazy or optional quantifier keeps the previous atom
+			group = afterRepeat
+		}
+		if !group {
+			afterRepeat = false
+		}
+	}
+	return -1
+}
+
+// indexByteFrom returns the index of the first c in s after i, or -1.
+func indexByteFrom(s string, i int, c byte) int {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == c {
+			return j
+		}
+	}
+	return -1
+}
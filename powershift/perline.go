@@ -0,0 +1,44 @@
+package powershift
+
+import "slices"
+
+// PerLine selects which literals of each line may be rewritten.
+type PerLine string
+
+const (
+	PerLineAll   PerLine = "all"   // Every literal, the default
+	PerLineFirst PerLine = "first" // Only the first literal of each line, such as a leading counter
+	PerLineLast  PerLine = "last"  // Only the last literal of each line, such as a trailing size
+)
+
+// PerLineNames lists the accepted PerLine values.
+func PerLineNames() []PerLine {
+	return []PerLine{PerLineAll, PerLineFirst, PerLineLast}
+}
+
+// WithPerLine only rewrites the first or the last literal of each line; the
+// others are kept whatever their value. Literals the adjacency rule rejects
+// do not count. In streaming mode the input is then only cut at line ends.
+func WithPerLine(mode PerLine) Option {
+	return func(o *options) error {
+		if !slices.Contains(PerLineNames(), mode) {
+			return Errorf(ErrInvalidOption, "set", "per-line", "use all, first or last",
+				"unknown per-line mode %q", mode)
+		}
+		o.perLine = mode
+		return nil
+	}
+}
+
+// perLineAllows reports whether the per-line mode lets the literal at
+// runes[start:end], given the end of the previous literal of the segment, or
+// -1, and the start of the next one, or -1, be rewritten.
+func (p *pass) perLineAllows(runes []rune, prevEnd, start, end, nextStart int) bool {
+	switch p.f.opts.perLine {
+	case PerLineFirst:
+		return prevEnd < 0 || slices.Contains(runes[prevEnd:start], '\n')
+	case PerLineLast:
+		return nextStart < 0 || slices.Contains(runes[end:nextStart], '\n')
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+// Package powershifttest provides helpers for testing code that embeds the
+// powershift library: assert that an input transforms to an expected output
+// under given options, and compare against golden files.
+//
+// Golden files live next to their input as NAME.input and NAME.golden. Set
+// Update (or the POWERSHIFT_UPDATE_GOLDEN=1 environment variable) to rewrite
+// the .golden files from the current output instead of comparing.
+package powershifttest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// Update makes Golden and GoldenDir rewrite golden files instead of comparing.
+var Update = os.Getenv("POWERSHIFT_UPDATE_GOLDEN") == "1"
+
+// Transform runs input through a Formatter built from opts and returns the
+// output, failing the test if the options are invalid or the transform fails.
+func Transform(t testing.TB, input string, opts ...powershift.Option) string {
+	t.Helper()
+	f, err := powershift.New(opts...)
+	if err != nil {
+		t.Fatalf("powershift.New: %v", err)
+	}
+	out, _, err := f.String(input)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	return out
+}
+
+// AssertTransform checks that input transforms to want under opts.
+func AssertTransform(t testing.TB, input, want string, opts ...powershift.Option) {
+	t.Helper()
+	if got := Transform(t, input, opts...); got != want {
+		t.Errorf("transform mismatch for input %q\n%s", input, Diff(want, got))
+	}
+}
+
+// AssertUnchanged checks that opts leave input untouched.
+func AssertUnchanged(t testing.TB, input string, opts ...powershift.Option) {
+	t.Helper()
+	AssertTransform(t, input, input, opts...)
+}
+
+// AssertConcurrent checks that one Formatter built from opts, used from
+// goroutines goroutines at once, transforms each of inputs the same way as it
+// does alone. Run it with -race to also catch data races in the callbacks
+// and emitters given in opts.
+func AssertConcurrent(t testing.TB, goroutines int, inputs []string, opts ...powershift.Option) {
+	t.Helper()
+	f, err := powershift.New(opts...)
+	if err != nil {
+		t.Fatalf("powershift.New: %v", err)
+	}
+	want := make([]string, len(inputs))
+	for i, in := range inputs {
+		if want[i], _, err = f.String(in); err != nil {
+			t.Fatalf("transform: %v", err)
+		}
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failures []string
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, in := range inputs {
+				got, _, err := f.String(in)
+				if err == nil && got == want[i] {
+					continue
+				}
+				mu.Lock()
+				if err != nil {
+					failures = append(failures, fmt.Sprintf("input %d: transform: %v", i, err))
+				} else {
+					failures = append(failures, fmt.Sprintf("input %d differs when run concurrently\n%s", i, Diff(want[i], got)))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, msg := range failures {
+		t.Error(msg)
+	}
+}
+
+// Golden transforms the file path+".input" and compares the result with
+// path+".golden".
+func Golden(t testing.TB, path string, opts ...powershift.Option) {
+	t.Helper()
+	input, err := os.ReadFile(path + ".input")
+	if err != nil {
+		t.Fatalf("read golden input: %v", err)
+	}
+	got := Transform(t, string(input), opts...)
+
+	goldenPath := path + ".golden"
+	if Update {
+		if err := os.WriteFile(goldenPath, []byte(got), 0o644); err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(goldenPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden file %s is missing; rerun with POWERSHIFT_UPDATE_GOLDEN=1 to create it", goldenPath)
+	}
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s does not match\n%s", goldenPath, Diff(string(want), got))
+	}
+}
+
+// GoldenDir runs Golden as a subtest for every *.input file in dir.
+func GoldenDir(t *testing.T, dir string, opts ...powershift.Option) {
+	t.Helper()
+	inputs, err := filepath.Glob(filepath.Join(dir, "*.input"))
+	if err != nil {
+		t.Fatalf("list golden inputs: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no *.input files in %s", dir)
+	}
+	for _, in := range inputs {
+		base := strings.TrimSuffix(in, ".input")
+		t.Run(filepath.Base(base), func(t *testing.T) {
+			Golden(t, base, opts...)
+		})
+	}
+}
+
+// Diff returns a short line-oriented description of how got differs from want.
+func Diff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	var sb strings.Builder
+	shown := 0
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w == g {
+			continue
+		}
+		if shown == 10 {
+			sb.WriteString("...\n")
+			break
+		}
+		fmt.Fprintf(&sb, "line %d:\n  want: %q\n  got:  %q\n", i+1, w, g)
+		shown++
+	}
+	return sb.String()
+}
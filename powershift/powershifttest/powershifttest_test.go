@@ -0,0 +1,85 @@
+package powershifttest
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// recorder is a testing.TB that records failures instead of reporting them,
+// so the helpers themselves can be checked for failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertTransform(t *testing.T) {
+	AssertTransform(t, "mask = 65535", "mask = 1<<16 - 1")
+	AssertTransform(t, "size := 1048576", "size := 1 << 20", powershift.WithLanguage("go"))
+	AssertUnchanged(t, "port = 8080", powershift.WithThreshold(big.NewInt(10000)))
+
+	r := &recorder{TB: t}
+	AssertTransform(r, "mask = 65535", "mask = 65535")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `got:  "mask = 1<<16 - 1"`) {
+		t.Errorf("a mismatch was reported as %q", r.errors)
+	}
+	r = &recorder{TB: t}
+	AssertUnchanged(r, "page = 4096")
+	if len(r.errors) != 1 {
+		t.Errorf("a rewrite was reported as %q", r.errors)
+	}
+}
+
+func TestGoldenDir(t *testing.T) {
+	GoldenDir(t, "testdata", powershift.WithLanguage("go"))
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "table")
+	if err := os.WriteFile(base+".input", []byte("{4096, 4095}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(update bool) { Update = update }(Update)
+	Update = true
+	Golden(t, base, powershift.WithLanguage("go"))
+	got, err := os.ReadFile(base + ".golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{1 << 12, 1<<12 - 1}\n"; string(got) != want {
+		t.Errorf("golden file holds %q, want %q", got, want)
+	}
+
+	Update = false
+	r := &recorder{TB: t}
+	Golden(r, base, powershift.WithThreshold(big.NewInt(10000)))
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "table.golden does not match") {
+		t.Errorf("a stale golden file was reported as %q", r.errors)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if d := Diff("a\nb\nc", "a\nb\nc"); d != "" {
+		t.Errorf("equal texts differ by %q", d)
+	}
+	want := "line 2:\n  want: \"b\"\n  got:  \"x\"\nline 4:\n  want: \"\"\n  got:  \"d\"\n"
+	if d := Diff("a\nb\nc", "a\nx\nc\nd"); d != want {
+		t.Errorf("Diff = %q, want %q", d, want)
+	}
+	long := strings.Repeat("x\n", 20)
+	if d := Diff(long, strings.ToUpper(long)); strings.Count(d, "line ") != 10 || !strings.HasSuffix(d, "...\n") {
+		t.Errorf("a long diff is not cut short:\n%s", d)
+	}
+}
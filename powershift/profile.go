@@ -0,0 +1,253 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Profile describes the syntax of a target language that matters when
+// emitting replacements.
+type Profile struct {
+	Name         string
+	BlockComment [2]string // Opening and closing block comment, empty if the language has none
+	LineComment  string    // Line comment marker, empty if the language has none
+
+	// DigitSeparator groups digits of long literals (1_048_575, 1'048'575),
+	// empty if the language has no such syntax.
+	DigitSeparator string
+
+	// Emitter renders the expressions of the language when WithEmitter is
+	// not given, Render if nil.
+	Emitter Emitter
+
+	// IntTypes maps the integer types literals can be suffixed with, as in
+	// 1u64, to their width in bits, negative for signed types. Expressions
+	// for a literal of such a type are written in it, empty if the language
+	// has no integer type suffixes.
+	IntTypes map[string]int
+
+	// LongSuffix marks 64-bit literals in languages whose unsuffixed literals
+	// are 32 bits wide, as the L of 1099511627776L in Java. Literals are
+	// matched with it, and expressions beyond 32 bits carry it, empty if the
+	// language has no such suffix.
+	LongSuffix string
+
+	// MaxValues names the maximum values of the integer types, as
+	// Long.MAX_VALUE, by n for the value 2^n - 1. They are only used with
+	// WithNamedConstants.
+	MaxValues map[int]string
+
+	// Shift is the left shift operator if it is not <<, as the infix shl of
+	// Kotlin.
+	Shift string
+
+	// LowShiftPrecedence is set when << binds looser than + and -, as in C,
+	// so that 1<<20 - 1 would mean 1<<19. Expressions are then emitted as
+	// (1<<20) - 1.
+	LowShiftPrecedence bool
+
+	// FloatDivision is set when / divides integers into a float, as in
+	// Python, so that 1048576 / 1024 is not the integer 1024.
+	FloatDivision bool
+
+	// Xor is set when ^ is exclusive or, as in C, so that 2^20 is 22.
+	// WithAnyNotation then only reads it as a power with ExprMath.
+	Xor bool
+
+	// Power is the exponent operator, as in 10**6, empty if the language
+	// has none. The decimal forms are only available when it is set.
+	Power string
+
+	// Forms are the forms tried when none are configured, DefaultForms if
+	// empty. A profile lists the decimal forms first to prefer (10**6) - 1
+	// style expressions wherever a base-10 decomposition exists.
+	Forms []Form
+}
+
+// DefaultProfile is used when no language is selected.
+const DefaultProfile = "text"
+
+var profiles = map[string]Profile{
+	"text":   {Name: "text", BlockComment: [2]string{"/*", "*/"}, DigitSeparator: ","},
+	"c":      {Name: "c", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "'", LowShiftPrecedence: true, Xor: true},   // C23
+	"cpp":    {Name: "cpp", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "'", LowShiftPrecedence: true, Xor: true}, // C++14
+	"go":     {Name: "go", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "_", Xor: true},
+	"js":     {Name: "js", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "_", LowShiftPrecedence: true, Xor: true, Power: "**"},
+	"rust":   {Name: "rust", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "_", LowShiftPrecedence: true, Xor: true, IntTypes: rustIntTypes},
+	"python": {Name: "python", LineComment: "#", DigitSeparator: "_", LowShiftPrecedence: true, Xor: true, Power: "**", FloatDivision: true},
+	"shell":  {Name: "shell", LineComment: "#", LowShiftPrecedence: true, Xor: true, Power: "**"}, // $(( )) arithmetic
+	"yaml":   {Name: "yaml", LineComment: "#"},
+	"toml":   {Name: "toml", LineComment: "#", DigitSeparator: "_"},
+
+	// The JVM languages, whose unsuffixed literals are 32 bits wide
+	"java": {Name: "java", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "_", LowShiftPrecedence: true, Xor: true,
+		LongSuffix: "L", MaxValues: map[int]string{31: "Integer.MAX_VALUE", 63: "Long.MAX_VALUE"}},
+	"kotlin": {Name: "kotlin", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "_", LowShiftPrecedence: true,
+		LongSuffix: "L", MaxValues: map[int]string{31: "Int.MAX_VALUE", 63: "Long.MAX_VALUE"}, Shift: "shl"},
+
+	// C following the Linux kernel conventions, where masks are written with
+	// the GENMASK and BIT macros
+	"c-kernel": {Name: "c-kernel", BlockComment: [2]string{"/*", "*/"}, LineComment: "//", DigitSeparator: "'", LowShiftPrecedence: true, Xor: true,
+		Emitter: EmitterFunc(kernelMacros)},
+
+	// Python for scientific code, where round decimal magnitudes are more
+	// common than binary ones
+	"python-sci": {Name: "python-sci", LineComment: "#", DigitSeparator: "_", LowShiftPrecedence: true, Xor: true, Power: "**", FloatDivision: true,
+		Forms: []Form{FormPowerOfTen, FormTenMinusOne, FormMinusOne, FormPlusOne}},
+}
+
+// ProfileNames lists the built-in language profiles in alphabetical order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (Profile, error) {
+	if p, ok := profiles[name]; ok {
+		return p, nil
+	}
+	return Profile{}, Errorf(ErrInvalidOption, "parse", "language", fmt.Sprintf("known languages are %v", ProfileNames()),
+		"unknown language %q", name)
+}
+
+// Emit selects what a replacement looks like.
+type Emit string
+
+const (
+	EmitShift    Emit = "shift"    // Only the expression
+	EmitBoth     Emit = "both"     // The expression followed by the original value in a comment
+	EmitGrouped  Emit = "grouped"  // No expression, just the literal with digit separators
+	EmitHex      Emit = "hex"      // No expression, the literal in hexadecimal
+	EmitAnnotate Emit = "annotate" // The literal, followed by the expression in a comment
+)
+
+// EmitNames lists the supported emit modes.
+func EmitNames() []Emit {
+	return []Emit{EmitShift, EmitBoth, EmitGrouped, EmitHex, EmitAnnotate}
+}
+
+// ParseEmit converts a name such as "both" into an Emit.
+func ParseEmit(name string) (Emit, error) {
+	for _, e := range EmitNames() {
+		if string(e) == name {
+			return e, nil
+		}
+	}
+	return "", Errorf(ErrInvalidOption, "parse", "emit", fmt.Sprintf("known modes are %v", EmitNames()),
+		"unknown emit mode %q", name)
+}
+
+// propose returns the replacement for a number above threshold, or
+// expr == "" if there is none. Languages without block comments cannot annotate
+// inside an expression, so for them EmitBoth returns the original value as a
+// note to be placed in a line comment at the end of the line. A directive d,
+// if not nil, overrides the emit mode and forms.
+func (f *Formatter) propose(m *Match, d *directive, threshold *big.Int) (expr, note string) {
+	if !f.opts.inRange(m.Value, threshold) {
+		return "", ""
+	}
+	emit := f.opts.emit
+	if t := f.tierFor(m.Value); t != nil && t.Emit != "" {
+		emit = t.Emit
+	}
+	if d != nil && d.emit != "" {
+		emit = d.emit
+	}
+	switch emit {
+	case EmitGrouped, EmitHex:
+		digits, suffix := splitLongSuffix(digitsOf(m.Text), f.opts.profile)
+		if suffix == "" {
+			digits, suffix, _ = splitIntSuffix(digits, f.opts.profile)
+		}
+		if strings.IndexFunc(digits, func(r rune) bool { return !isDecimalDigit(r) }) >= 0 {
+			digits = m.Value.String() // A literal of a LiteralParser, grouped in decimal
+		}
+		expr := fmt.Sprintf("0x%X", m.Value) + suffix
+		if emit == EmitGrouped {
+			expr = groupDigits(digits, f.opts.profile.DigitSeparator) + suffix
+		}
+		if f.tooLong(m, expr) {
+			return "", ""
+		}
+		return expr, ""
+	}
+
+	var c Candidate
+	var ok bool
+	if d != nil && d.form != "" {
+		c, ok = f.opts.strategy(d.form).decompose(m.Value)
+	} else {
+		c, ok = f.candidate(m.Value)
+		if !ok {
+			return f.approximate(m)
+		}
+	}
+	if !ok {
+		return "", ""
+	}
+	return f.emitCandidate(m, c, f.render(c, m.IntType), emit)
+}
+
+// emitCandidate records c as the decomposition of m and returns expr, the
+// rendering of c, in the given emit style.
+func (f *Formatter) emitCandidate(m *Match, c Candidate, expr string, emit Emit) (string, string) {
+	if expr == "" {
+		return "", "" // Not representable in the integer type of m
+	}
+	measured := expr
+	if m.Arithmetic && !isAtom(expr) {
+		measured = "(" + expr + ")"
+	}
+	if f.tooLong(m, measured) {
+		return "", ""
+	}
+	m.Candidate = &c
+	p := f.opts.profile
+	if emit == EmitAnnotate {
+		if p.BlockComment[0] != "" {
+			return fmt.Sprintf("%s %s %s %s", digitsOf(m.Text), p.BlockComment[0], expr, p.BlockComment[1]), ""
+		}
+		return digitsOf(m.Text), expr
+	}
+	if emit != EmitBoth {
+		if m.Arithmetic && !isAtom(expr) {
+			expr = "(" + expr + ")"
+		}
+		return expr, ""
+	}
+	if p.BlockComment[0] != "" {
+		return fmt.Sprintf("(%s %s %s %s)", expr, p.BlockComment[0], digitsOf(m.Text), p.BlockComment[1]), ""
+	}
+	return "(" + expr + ")", digitsOf(m.Text)
+}
+
+// tooLong reports whether expr, proposed for m, breaks WithMaxLengthRatio.
+func (f *Formatter) tooLong(m *Match, expr string) bool {
+	return f.opts.maxRatio > 0 && float64(len(expr)) > f.opts.maxRatio*float64(len(digitsOf(m.Text)))
+}
+
+// groupDigits inserts sep between every group of three digits, counting from the right.
+func groupDigits(digits, sep string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var sb strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		sb.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if sb.Len() > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(digits[i : i+3])
+	}
+	return sb.String()
+}
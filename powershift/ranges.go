@@ -0,0 +1,66 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// WithRanges rewrites two literals on the same line that bound a power-of-two
+// interval, such as start=1048576 end=2097151, as a pair: the start becomes
+// 1<<20 and the end 1<<21 - 1, even where either literal alone would be
+// rendered differently. The threshold applies to the end of the range. With
+// annotate the interval is noted after the end as well, e.g. [2^20, 2^21).
+func WithRanges(annotate bool) Option {
+	return func(o *options) error {
+		o.ranges = true
+		o.annotateRanges = annotate
+		return nil
+	}
+}
+
+// rangeEnd is the proposal for the second literal of a range, worked out
+// while the first one is processed.
+type rangeEnd struct {
+	index int // Rune index of the literal in the segment
+	c     Candidate
+	note  string // Interval annotation, empty unless requested
+}
+
+// rangeBounds reports whether start = 2^lo and end = 2^hi - 1 with lo < hi.
+func rangeBounds(start, end *big.Int) (lo, hi int, ok bool) {
+	lo, ok = exactPower(start)
+	if !ok {
+		return 0, 0, false
+	}
+	hi, ok = exactPower(new(big.Int).Add(end, big.NewInt(1)))
+	if !ok || hi <= lo {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// exactPower returns n if v == 2^n.
+func exactPower(v *big.Int) (int, bool) {
+	if v.Sign() <= 0 {
+		return 0, false
+	}
+	n := int(v.TrailingZeroBits())
+	return n, v.BitLen() == n+1
+}
+
+// rangeStart checks whether start and end, two consecutive literals, form a
+// range. If so it returns the start's candidate and the proposal for the end.
+func (f *Formatter) rangeStart(start, end *big.Int, sameLine bool) (Candidate, *rangeEnd, bool) {
+	if !f.opts.ranges || !sameLine || f.opts.emit == EmitGrouped || f.opts.emit == EmitHex || !f.opts.inRange(end, f.opts.threshold) {
+		return Candidate{}, nil, false
+	}
+	lo, hi, ok := rangeBounds(start, end)
+	if !ok {
+		return Candidate{}, nil, false
+	}
+	re := &rangeEnd{c: Candidate{Form: FormMinusOne, N: hi}}
+	if f.opts.annotateRanges {
+		re.note = fmt.Sprintf("[2^%d, 2^%d)", lo, hi)
+	}
+	return Candidate{Form: FormPower, N: lo}, re, true
+}
@@ -0,0 +1,28 @@
+package powershift
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRangesStreamed(t *testing.T) {
+	in := "lo = 65536, " + strings.Repeat("x, ", 40<<10) + "hi = 4294967295\nmask = 1048575\n"
+	want := "lo = 1 << 16, " + strings.Repeat("x, ", 40<<10) + "hi = 1<<32 - 1 // [2^16, 2^32)\nmask = 1<<20 - 1\n"
+	for _, size := range []int{0, 4 << 10} {
+		opts := []Option{WithLanguage("go"), WithRanges(true)}
+		if size > 0 {
+			opts = append(opts, WithChunkSize(size))
+		}
+		f, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := f.String(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("with chunks of %d bytes, the range is %q ... %q", size, got[:16], got[strings.LastIndex(got, "hi"):])
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package powershift
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// WithReverse makes Transform undo an earlier run instead: shift expressions
+// become decimal literals again, the output of EmitBoth becomes the original
+// literal and the comments added by EmitAnnotate are dropped. With
+// onlyTagged, only the rewrites marked by WithTag (with DefaultTag unless
+// another tag is set) are undone, so expressions written by hand are kept.
+// The input is always read in full.
+func WithReverse(onlyTagged bool) Option {
+	return func(o *options) error {
+		o.reverse, o.onlyTagged = true, onlyTagged
+		return nil
+	}
+}
+
+// reverser recognizes what an earlier run wrote around an expression in a
+// language with block comments.
+type reverser struct {
+	both      *regexp.Regexp // The original literal of EmitBoth, after the expression
+	annotated *regexp.Regexp // The literal and comment opening of EmitAnnotate, before it
+	closing   *regexp.Regexp // The comment closing of EmitAnnotate, after it
+	tag       *regexp.Regexp // A tag comment, after any of the above
+}
+
+func newReverser(comment [2]string, tag string) *reverser {
+	open, shut := `[ \t]*`+regexp.QuoteMeta(comment[0])+`[ \t]*`, `[ \t]*`+regexp.QuoteMeta(comment[1])
+	suffix := `(_?[A-Za-z]\w*)?` // Of a typed literal, as in 1048576u64
+	return &reverser{
+		both:      regexp.MustCompile(`^` + open + `((\d+)` + suffix + `)` + shut + `[ \t]*\)`),
+		annotated: regexp.MustCompile(`(\d+)` + suffix + open + `$`),
+		closing:   regexp.MustCompile(`^` + shut),
+		tag:       regexp.MustCompile(`^` + open + regexp.QuoteMeta(tag) + shut),
+	}
+}
+
+// reverseTag returns the tag WithReverse looks for.
+func (f *Formatter) reverseTag() string {
+	if f.opts.tag == "" {
+		return DefaultTag
+	}
+	return f.opts.tag
+}
+
+// revertEdit replaces s[start:end] with text.
+type revertEdit struct {
+	start, end int
+	text       string
+}
+
+// transformReverse implements Transform for WithReverse.
+func (f *Formatter) transformReverse(dst io.Writer, src io.Reader) (Stats, error) {
+	content, err := io.ReadAll(src)
+	if err != nil {
+		return Stats{}, NewError(ErrReadFailed, "read", "input", err, "")
+	}
+	out, n := f.reverse(string(content))
+	stats := Stats{Matches: n, Replaced: n, BytesRead: int64(len(content)), BytesWritten: int64(len(out))}
+	if _, err := io.WriteString(dst, out); err != nil {
+		return stats, writeFailed(err)
+	}
+	return stats, nil
+}
+
+// reverse returns s with its expressions reverted and how many there were.
+func (f *Formatter) reverse(s string) (string, int) {
+	rev := f.rev
+	// Without block comments, original values, annotations and the tag all
+	// go in the line comment the run added at the end of the line
+	var notes map[int]revertEdit
+	if prof := f.opts.profile; rev == nil && prof.LineComment != "" {
+		notes = taggedNotes(s, prof.LineComment, f.reverseTag())
+	}
+
+	f.xorWarnings(s)
+	var edits []revertEdit
+	for _, e := range f.Expressions(s) {
+		start, end := e.Offset, e.Offset+len(e.Text)
+		digits := e.Value.String()
+		edit := revertEdit{start, end, digits + f.intSuffix(e.Text)}
+		tagged := false
+		if rev != nil {
+			before := strings.TrimRight(s[:start], " \t")
+			if m := rev.both.FindStringSubmatch(s[end:]); m != nil && m[2] == digits && strings.HasSuffix(before, "(") {
+				edit = revertEdit{len(before) - 1, end + len(m[0]), m[1]}
+			} else if m := rev.annotated.FindStringSubmatchIndex(s[:start]); m != nil && s[m[2]:m[3]] == digits {
+				if c := rev.closing.FindString(s[end:]); c != "" {
+					edit = revertEdit{max(m[3], m[5]), end + len(c), ""}
+				}
+			}
+			if t := rev.tag.FindString(s[edit.end:]); t != "" {
+				edit.end += len(t)
+				tagged = true
+			}
+		} else if notes != nil {
+			lineStart := strings.LastIndexByte(s[:start], '\n') + 1
+			note, ok := notes[lineStart]
+			if ok && start >= note.start {
+				continue // An annotation, removed along with the comment
+			}
+			tagged = ok
+		}
+		if f.opts.onlyTagged && !tagged {
+			continue
+		}
+		edits = append(edits, edit)
+	}
+	n := len(edits)
+	for _, note := range notes {
+		edits = append(edits, note)
+	}
+	slices.SortFunc(edits, func(a, b revertEdit) int { return a.start - b.start })
+
+	var sb strings.Builder
+	last := 0
+	for _, e := range edits {
+		if e.start < last {
+			continue
+		}
+		sb.WriteString(s[last:e.start])
+		sb.WriteString(e.text)
+		last = e.end
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), n
+}
+
+// xorWarnings reports the expressions that WithAnyNotation keeps because
+// their ^ is exclusive or in the language, as 2^20 in Go.
+func (f *Formatter) xorWarnings(s string) {
+	p := f.opts.profile
+	if !f.opts.anyNotation || !p.Xor || f.opts.exprStyle == ExprMath || f.opts.onWarning == nil {
+		return
+	}
+	for _, e := range f.findExprs(s, p, []string{"^"}, styledExprPattern) {
+		if !strings.Contains(e.Text, "^") {
+			continue
+		}
+		line := strings.Count(s[:e.Offset], "\n") + 1
+		f.opts.onWarning(Errorf(ErrInvalidOption, "reverse", fmt.Sprintf("expression on line %d", line),
+			"use the math expression style to read ^ as a power", "%s is kept: ^ is exclusive or in %s", e.Text, p.Name))
+	}
+}
+
+// taggedNotes finds the lines of s whose last line comment holds tag among
+// its comma-separated notes, and returns the edits that remove those comments
+// keyed by the offset at which each line starts.
+func taggedNotes(s, marker, tag string) map[int]revertEdit {
+	notes := map[int]revertEdit{}
+	sep := " " + marker + " "
+	for start := 0; start < len(s); {
+		end := strings.IndexByte(s[start:], '\n')
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += start
+		}
+		line := strings.TrimSuffix(s[start:end], "\r")
+		if i := strings.LastIndex(line, sep); i >= 0 && slices.Contains(strings.Split(line[i+len(sep):], ", "), tag) {
+			notes[start] = revertEdit{start + i, start + len(line), ""}
+		}
+		start = end + 1
+	}
+	return notes
+}
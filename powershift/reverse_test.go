@@ -0,0 +1,75 @@
+package powershift
+
+import "testing"
+
+func TestReverseKeepsLongerTokens(t *testing.T) {
+	tests := []struct {
+		name, lang, input string
+	}{
+		{name: "hex", lang: "python", input: "mask = 0x1 << 5\n"},
+		{name: "binary", lang: "python", input: "q = 0b1 << 3\n"},
+		{name: "octal", lang: "python", input: "q = 0o1 << 3\n"},
+		{name: "identifier", lang: "python", input: "x = a1 << 2\n"},
+		{name: "float", lang: "python", input: "y = 1.5e1 << 2\n"},
+		{name: "float shift amount", lang: "python", input: "y = 1 << 2.5\n"},
+		{name: "power of an identifier", lang: "python", input: "w = v2 ** 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := New(WithLanguage(tt.lang), WithReverse(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, n, err := f.String(tt.input); err != nil || got != tt.input {
+				t.Errorf("got %q (%d reverted), %v, want it unchanged", got, n.Replaced, err)
+			}
+		})
+	}
+}
+
+func TestReverseNextToPunctuation(t *testing.T) {
+	f, err := New(WithLanguage("python"), WithReverse(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "a = (1 << 20)\nb = f(1 << 10)\nc = [1 << 4, 2 ** 3]\nThe size is 1 << 20.\n"
+	want := "a = 1048576\nb = f(1024)\nc = [16, 8]\nThe size is 1048576.\n"
+	if got, _, err := f.String(in); err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestAnyNotationXor(t *testing.T) {
+	in := "x := 2^20\ny := 2**20\nz := 1 << 20\n"
+	tests := []struct {
+		name, lang string
+		style      ExprStyle
+		want       string
+		warnings   int
+	}{
+		{name: "exclusive or", lang: "go", want: "x := 2^20\ny := 1048576\nz := 1048576\n", warnings: 1},
+		{name: "math style", lang: "go", style: ExprMath, want: "x := 1048576\ny := 1048576\nz := 1048576\n"},
+		{name: "no exclusive or", lang: "text", want: "x := 1048576\ny := 1048576\nz := 1048576\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+			opts := []Option{WithLanguage(tt.lang), WithReverse(false), WithAnyNotation(), WithWarningFunc(func(err error) {
+				warnings = append(warnings, err.Error())
+			})}
+			if tt.style != "" {
+				opts = append(opts, WithExprStyle(tt.style))
+			}
+			f, err := New(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, err := f.String(in); err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("warnings are %q, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
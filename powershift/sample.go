@@ -0,0 +1,49 @@
+package powershift
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// WithMaxReplacements stops rewriting after n literals in each Transform
+// call; the rest of the input is copied through unchanged.
+func WithMaxReplacements(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return Errorf(ErrInvalidOption, "set", "max replacements", "use at least 1", "max replacements %d", n)
+		}
+		o.maxReplacements = n
+		return nil
+	}
+}
+
+// WithSample only rewrites a deterministic subset of about fraction of the
+// literals that would be rewritten, chosen by a hash of each literal and its
+// offset, so the same input always gives the same subset.
+func WithSample(fraction float64) Option {
+	return func(o *options) error {
+		if !(fraction > 0 && fraction <= 1) {
+			return Errorf(ErrInvalidOption, "set", "sample", "use a fraction above 0 and at most 1, such as 0.1",
+				"sample fraction %g", fraction)
+		}
+		o.sample = fraction
+		return nil
+	}
+}
+
+// admit reports whether the rollout limits let m be rewritten.
+func (p *pass) admit(m Match) bool {
+	if n := p.f.opts.maxReplacements; n > 0 && p.stats.Replaced >= n {
+		return false
+	}
+	if p.f.opts.sample == 0 || p.f.opts.sample == 1 {
+		return true
+	}
+	h := fnv.New64a()
+	var offset [8]byte
+	binary.LittleEndian.PutUint64(offset[:], uint64(m.Offset))
+	h.Write(offset[:])
+	h.Write([]byte(m.Text))
+	return float64(h.Sum64()) < p.f.opts.sample*math.MaxUint64
+}
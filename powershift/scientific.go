@@ -0,0 +1,50 @@
+package powershift
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// scientificPattern matches numbers in scientific notation, such as
+// 1.048576e6. A sign of the exponent is matched so that 1.5e-3 is seen as a
+// whole and left alone rather than read as 1 and 5.
+const scientificPattern = `\d+(?:\.\d+)?[eE][+-]?\d+`
+
+// maxScientificExponent bounds the exponents ScientificParser accepts, so
+// that a literal such as 1e999999999 is not expanded into a billion digits.
+const maxScientificExponent = 4096
+
+// ScientificParser returns the LiteralParser of numbers in scientific
+// notation whose value is an integer, such as 1.048576e6 or 4E9, which config
+// generators often write for byte counts. Those with a fractional value, such
+// as 1.5e-3, are left alone. It is given to WithLiteralParser like any other
+// parser; the emit mode decides whether 1.048576e6 becomes 1 << 20 or
+// 1,048,576.
+func ScientificParser() LiteralParser {
+	return NewLiteralParser(scientificPattern, parseScientific)
+}
+
+// parseScientific returns the value of text, a match of scientificPattern, if
+// it is an integer.
+func parseScientific(text string) (*big.Int, bool) {
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(text), "e")
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	exp, err := strconv.Atoi(exponent)
+	if err != nil || exp > maxScientificExponent {
+		return nil, false
+	}
+	digits := whole + frac
+	exp -= len(frac)
+	if exp < 0 {
+		if len(digits) <= -exp || strings.TrimRight(digits[len(digits)+exp:], "0") != "" {
+			return nil, false // A fraction
+		}
+		digits, exp = digits[:len(digits)+exp], 0
+	}
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, false
+	}
+	return v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)), true
+}
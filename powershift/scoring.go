@@ -0,0 +1,116 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// Scoring selects which decomposition of a value is used when more than one
+// of the forms applies.
+type Scoring string
+
+const (
+	ScoreFirst    Scoring = "first"    // The first form that applies, in the order of the forms
+	ScoreShortest Scoring = "shortest" // The shortest expression
+	ScoreSimplest Scoring = "simplest" // The expression with the fewest operators
+)
+
+// ScoringNames lists the supported scoring rules.
+func ScoringNames() []Scoring {
+	return []Scoring{ScoreFirst, ScoreShortest, ScoreSimplest}
+}
+
+// ParseScoring converts a name such as "shortest" into a Scoring.
+func ParseScoring(name string) (Scoring, error) {
+	for _, s := range ScoringNames() {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", Errorf(ErrInvalidOption, "parse", "scoring", fmt.Sprintf("known rules are %v", ScoringNames()),
+		"unknown scoring rule %q", name)
+}
+
+// WithScoring decomposes every value with all of the forms and picks the
+// expression with the lowest score under s, rather than the first form that
+// applies. Ties go to the form listed first, so the output is deterministic.
+// Expressions depend on the language and emitter, so the decompositions are
+// not kept in the cache of WithCache.
+func WithScoring(s Scoring) Option {
+	return func(o *options) error {
+		if _, err := ParseScoring(string(s)); err != nil {
+			return err
+		}
+		o.scoring = s
+		return nil
+	}
+}
+
+// WithFormWeights adds weights[form] to the score of the expressions of
+// form: characters with ScoreShortest, operators with ScoreSimplest. A
+// positive weight holds a form back and a negative one prefers it. It needs
+// a scoring rule other than ScoreFirst.
+func WithFormWeights(weights map[Form]int) Option {
+	return func(o *options) error {
+		for form := range weights {
+			if _, err := ParseForm(string(form)); err != nil {
+				return err
+			}
+		}
+		o.weights = make(map[Form]int, len(weights))
+		for form, w := range weights {
+			o.weights[form] = w
+		}
+		return nil
+	}
+}
+
+// best returns the decomposition of num by strats with the lowest score, or
+// the first one if scoring is ScoreFirst.
+func (f *Formatter) best(strats []strategy, num *big.Int) (Candidate, bool) {
+	var best Candidate
+	bestScore, found := 0, false
+	for _, s := range strats {
+		c, ok := s.decompose(num)
+		if !ok {
+			continue
+		}
+		if f.opts.scoring == ScoreFirst {
+			return c, true
+		}
+		expr := f.render(c, f.opts.intType)
+		if expr == "" {
+			continue
+		}
+		score := f.opts.weights[c.Form]
+		if f.opts.scoring == ScoreShortest {
+			score += utf8.RuneCountInString(expr)
+		} else {
+			score += operators(expr)
+		}
+		if !found || score < bestScore {
+			best, bestScore, found = c, score, true
+		}
+	}
+	return best, found
+}
+
+// operators counts the operators of expr, such as << and the infix shl.
+func operators(expr string) int {
+	n := 0
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case strings.HasPrefix(expr[i:], "<<"), strings.HasPrefix(expr[i:], "**"):
+			n++
+			i++
+		case strings.HasPrefix(expr[i:], " shl "):
+			n++
+			i += 3
+		case strings.IndexByte("+-*/|^", expr[i]) >= 0:
+			n++
+		}
+	}
+	return n
+}
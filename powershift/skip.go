@@ -0,0 +1,63 @@
+package powershift
+
+import "math/big"
+
+// SkipReason tells why a literal was kept even though one of the configured
+// forms decomposes it, for auditing whether the safeguards hide constants
+// that should have been rewritten.
+type SkipReason string
+
+const (
+	SkipThreshold  SkipReason = "threshold"  // Not above the threshold, or below every tier
+	SkipCeiling    SkipReason = "ceiling"    // Above the ceiling of WithCeiling
+	SkipDirective  SkipReason = "directive"  // Under an ignore directive, one whose form does not apply or one with a value that cannot be used
+	SkipArithmetic SkipReason = "arithmetic" // An operand, with WithSkipArithmetic
+	SkipIntType    SkipReason = "int-type"   // The expression does not fit the integer type of the literal
+	SkipLength     SkipReason = "length"     // The expression breaks WithMaxLengthRatio
+	SkipDecision   SkipReason = "decision"   // Vetoed by the DecisionFunc
+	SkipLimit      SkipReason = "limit"      // Held back by WithMaxReplacements, WithSample or WithPerLine
+)
+
+// skipReason returns why m, which the pass kept, was not rewritten, or "" if
+// no configured form decomposes it or it was annotated in a line comment.
+// vetoed reports that the DecisionFunc kept it.
+func (p *pass) skipReason(m Match, runes []rune, start, end int, dirs *lineDirectives, vetoed bool) SkipReason {
+	c, ok := p.f.anyCandidate(m.Value)
+	switch {
+	case !ok || m.Expr == m.Text:
+		return ""
+	case m.Expr != "" && vetoed:
+		return SkipDecision
+	case m.Expr != "":
+		return SkipLimit
+	case m.Arithmetic && p.f.opts.skipArithmetic:
+		return SkipArithmetic
+	case p.ignoreFile || dirs.lookup(start) != nil:
+		return SkipDirective
+	}
+	if m.Value.Cmp(p.threshold(runes, start, end)) <= 0 || len(p.f.tiers) > 0 && p.f.tierFor(m.Value) == nil {
+		return SkipThreshold
+	}
+	if ceiling := p.f.opts.ceiling; ceiling != nil && m.Value.Cmp(ceiling) > 0 {
+		return SkipCeiling
+	}
+	if p.f.render(c, m.IntType) == "" {
+		return SkipIntType
+	}
+	return SkipLength
+}
+
+// anyCandidate decomposes num with the configured forms and those of the
+// tiers, whatever its threshold and tier.
+func (f *Formatter) anyCandidate(num *big.Int) (Candidate, bool) {
+	strats := f.strategies
+	for _, t := range f.tiers {
+		strats = append(strats[:len(strats):len(strats)], t.strategies...)
+	}
+	for _, s := range strats {
+		if c, ok := s.decompose(num); ok {
+			return c, true
+		}
+	}
+	return Candidate{}, false
+}
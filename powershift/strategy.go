@@ -0,0 +1,241 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// Form identifies the shape of a power-of-two decomposition.
+type Form string
+
+const (
+	FormPower    Form = "power"     // 2^n
+	FormMinusOne Form = "minus-one" // (2^n - 1) << m
+	FormPlusOne  Form = "plus-one"  // (2^n + 1) << m
+
+	// FormSumOfPowers, FormDifferenceOfPowers and FormMultiple are not tried
+	// by default. The sum writes numbers with up to WithMaxTerms bits set,
+	// the difference runs of ones as in the high and low masks 2^32 - 2^16,
+	// and the multiple buffer sizes such as 3 * 2^18 with an odd k of up to
+	// WithMaxMultiplier.
+	FormSumOfPowers        Form = "sum-of-powers"        // 2^a + 2^b + ...
+	FormDifferenceOfPowers Form = "difference-of-powers" // 2^a - 2^b
+	FormMultiple           Form = "multiple"             // k * 2^n
+
+	// The decimal forms need a language with an exponent operator, see
+	// Profile.Power.
+	FormPowerOfTen  Form = "power-of-ten"  // 10^n
+	FormTenMinusOne Form = "ten-minus-one" // 10^n - 1
+)
+
+// StrategyVersion changes whenever a strategy may decompose a value
+// differently than before, invalidating decompositions saved by Cache.Save.
+const StrategyVersion = 2
+
+// DefaultForms is the order in which forms are tried when none are configured.
+var DefaultForms = []Form{FormPower, FormMinusOne, FormPlusOne}
+
+// Candidate is a successful decomposition of a value into one of the forms.
+type Candidate struct {
+	Form Form
+	N    int // Exponent of the power of two, or of ten for the decimal forms
+	M    int // Left shift applied to the (2^n ± 1) term, 0 for the decimal forms
+
+	// For the difference-of-powers form, N and M are the exponents of 2^N - 2^M.
+	// For the multiple form, M is the multiplier k of k * 2^N.
+
+	// Terms are the exponents of the sum-of-powers form, highest first. N and
+	// M are then the highest and the lowest.
+	Terms []int
+}
+
+// strategy decomposes a value into a single form.
+type strategy struct {
+	form      Form
+	decompose func(num *big.Int) (Candidate, bool)
+}
+
+var strategies = map[Form]strategy{
+	FormPower: {FormPower, func(num *big.Int) (Candidate, bool) {
+		n, ok := exactPower(num)
+		return Candidate{Form: FormPower, N: n}, ok
+	}},
+	FormMinusOne: {FormMinusOne, func(num *big.Int) (Candidate, bool) {
+		ok, n, m := doraemon.DecomposeAsPowerOfTwoMinusOneShifted(num)
+		return Candidate{Form: FormMinusOne, N: n, M: m}, ok
+	}},
+	FormPlusOne: {FormPlusOne, func(num *big.Int) (Candidate, bool) {
+		ok, n, m := doraemon.DecomposeAsPowerOfTwoPlusOneShifted(num)
+		return Candidate{Form: FormPlusOne, N: n, M: m}, ok
+	}},
+	FormSumOfPowers: {FormSumOfPowers, func(num *big.Int) (Candidate, bool) {
+		return sumOfPowers(num, DefaultMaxTerms)
+	}},
+	FormDifferenceOfPowers: {FormDifferenceOfPowers, func(num *big.Int) (Candidate, bool) {
+		ok, n, m := doraemon.DecomposeAsPowerOfTwoMinusOneShifted(num)
+		// A single bit 2^(m+1) - 2^m is left to the power form
+		return Candidate{Form: FormDifferenceOfPowers, N: n + m, M: m}, ok && n >= 2
+	}},
+	FormMultiple: {FormMultiple, func(num *big.Int) (Candidate, bool) {
+		return multiple(num, DefaultMaxMultiplier)
+	}},
+	FormPowerOfTen: {FormPowerOfTen, func(num *big.Int) (Candidate, bool) {
+		n, ok := powerOfTen(num)
+		return Candidate{Form: FormPowerOfTen, N: n}, ok
+	}},
+	FormTenMinusOne: {FormTenMinusOne, func(num *big.Int) (Candidate, bool) {
+		n, ok := powerOfTen(new(big.Int).Add(num, big.NewInt(1)))
+		return Candidate{Form: FormTenMinusOne, N: n}, ok
+	}},
+}
+
+// strategy returns the strategy of form, with the maximum number of terms and
+// the maximum multiplier of o for the sum-of-powers and multiple forms.
+func (o *options) strategy(form Form) strategy {
+	switch form {
+	case FormSumOfPowers:
+		max := o.maxTerms
+		return strategy{form, func(num *big.Int) (Candidate, bool) { return sumOfPowers(num, max) }}
+	case FormMultiple:
+		max := o.maxMultiplier
+		return strategy{form, func(num *big.Int) (Candidate, bool) { return multiple(num, max) }}
+	}
+	return strategies[form]
+}
+
+// formKey identifies form with the settings of o that change how it
+// decomposes, for cache keys.
+func (o *options) formKey(form Form) string {
+	switch form {
+	case FormSumOfPowers:
+		return fmt.Sprintf("%s/%d", form, o.maxTerms)
+	case FormMultiple:
+		return fmt.Sprintf("%s/%d", form, o.maxMultiplier)
+	}
+	return string(form)
+}
+
+// powerOfTen returns n if v == 10^n for some n > 1.
+func powerOfTen(v *big.Int) (int, bool) {
+	s := v.String()
+	if len(s) < 3 || s[0] != '1' || strings.Trim(s[1:], "0") != "" {
+		return 0, false
+	}
+	return len(s) - 1, true
+}
+
+// decimal reports whether form is one of the base-10 forms.
+func decimal(form Form) bool {
+	return form == FormPowerOfTen || form == FormTenMinusOne
+}
+
+// FormNames lists every form known to the package.
+func FormNames() []Form {
+	return []Form{FormPower, FormMinusOne, FormPlusOne, FormSumOfPowers, FormDifferenceOfPowers, FormMultiple, FormPowerOfTen, FormTenMinusOne}
+}
+
+// formAliases are other names ParseForm accepts for some forms.
+var formAliases = map[string]Form{
+	"pow10": FormPowerOfTen,
+}
+
+// ParseForm converts a form name such as "minus-one", or an alias such as
+// "pow10", into a Form.
+func ParseForm(name string) (Form, error) {
+	if _, ok := strategies[Form(name)]; ok {
+		return Form(name), nil
+	}
+	if form, ok := formAliases[name]; ok {
+		return form, nil
+	}
+	return "", Errorf(ErrInvalidOption, "parse", "form", fmt.Sprintf("known forms are %v", FormNames()),
+		"unknown form %q", name)
+}
+
+// render formats a candidate as an expression in the language of p. With Go
+// precedence, where << binds tighter than + and -, the output is identical to
+// doraemon's FormatAsPowerOfTwo*ShiftedBig helpers. With low shift precedence,
+// as in C and most other languages, the shift is parenthesized so the
+// expression keeps its value. Powers of ten are parenthesized the same way, as
+// in (10**6) - 1.
+func render(c Candidate, p Profile) string {
+	return renderSuffixed(c, p, "")
+}
+
+// renderSuffixed is render with the type suffix s after the leading literal.
+func renderSuffixed(c Candidate, p Profile, s string) string {
+	lowShift := p.LowShiftPrecedence
+	shift := func(v string, n int) string {
+		if p.Shift != "" {
+			return fmt.Sprintf("%s %s %d", v, p.Shift, n)
+		}
+		return fmt.Sprintf("%s << %d", v, n)
+	}
+	pow := func(n int) string {
+		e := fmt.Sprintf("1%s<<%d", s, n)
+		if p.Shift != "" {
+			e = shift("1"+s, n)
+		}
+		if lowShift {
+			return "(" + e + ")"
+		}
+		return e
+	}
+	switch c.Form {
+	case FormPower:
+		switch c.N {
+		case 0:
+			return "1" + s
+		case 1:
+			return "2" + s
+		}
+		return shift("1"+s, c.N)
+	case FormMinusOne:
+		if c.N == 0 {
+			return "0" + s
+		}
+		if c.N == 1 {
+			// (2^1 - 1) << m is just 1 << m
+			if c.M == 0 {
+				return "1" + s
+			}
+			if c.M == 1 {
+				return "2" + s
+			}
+			return shift("1"+s, c.M)
+		}
+		if c.M == 0 {
+			return pow(c.N) + " - 1"
+		}
+		return shift("("+pow(c.N)+" - 1)", c.M)
+	case FormPlusOne:
+		if c.M == 0 {
+			return pow(c.N) + " + 1"
+		}
+		if c.N == 0 {
+			return shift("1"+s, c.M+1)
+		}
+		return shift("("+pow(c.N)+" + 1)", c.M)
+	case FormMultiple:
+		return shift(fmt.Sprintf("%d%s", c.M, s), c.N)
+	case FormSumOfPowers, FormDifferenceOfPowers:
+		op := "+"
+		if c.Form == FormDifferenceOfPowers {
+			op, c.Terms = "-", []int{c.N, c.M}
+		}
+		return joinTerms(c, op, func(n int) string {
+			if n == 0 {
+				return "1" + s
+			}
+			return pow(n)
+		})
+	case FormPowerOfTen:
+		return fmt.Sprintf("10%s%d", p.Power, c.N)
+	case FormTenMinusOne:
+		return fmt.Sprintf("(10%s%d) - 1", p.Power, c.N)
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package powershift
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamMatchesInMemory(t *testing.T) {
+	input := strings.Join([]string{
+		"a = 1024",
+		"b := 1048575 + x",
+		"c = 3 * 1024",
+		"lo = 65536, hi = 4294967295",
+		"f(1048576)",
+		"n = (1024)",
+		"x = 1 << 10 + 4",
+		"s = 512 * 2",
+		"a long line with many words, 1048576 and 1024 and 4095, 8191 " + strings.Repeat("and more ", 20) + "65535",
+		"",
+	}, "\n")
+	for _, lang := range []string{"text", "go", "c", "python"} {
+		ref, err := New(WithLanguage(lang), WithRanges(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _, err := ref.String(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range []int{1, 7, 63, 64, 65, 100, 4 << 10} {
+			f, err := New(WithLanguage(lang), WithRanges(true), WithChunkSize(size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if _, err := f.Transform(&out, iotest.HalfReader(strings.NewReader(input))); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != want {
+				t.Errorf("%s in chunks of %d bytes: got %q, want %q", lang, size, got, want)
+			}
+		}
+	}
+}
+
+func TestChunkSizeMinimum(t *testing.T) {
+	for size, want := range map[int]int{0: 0, 1: minChunkSize, 7: minChunkSize, 64: 64, 1 << 16: 1 << 16} {
+		f, err := New(WithChunkSize(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.opts.chunkSize != want {
+			t.Errorf("WithChunkSize(%d) streams in chunks of %d bytes, want %d", size, f.opts.chunkSize, want)
+		}
+	}
+}
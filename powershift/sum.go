@@ -0,0 +1,56 @@
+package powershift
+
+import (
+	"math/big"
+	"strings"
+)
+
+// DefaultMaxTerms is the number of powers the sum-of-powers form may add up
+// when WithMaxTerms is not given.
+const DefaultMaxTerms = 3
+
+// WithMaxTerms lets the sum-of-powers form write numbers with up to n bits
+// set, such as 1<<20 + 1<<4 + 1 for n = 3. It has no effect unless the form
+// is tried.
+func WithMaxTerms(n int) Option {
+	return func(o *options) error {
+		if n < 2 {
+			return Errorf(ErrInvalidOption, "set", "max terms", "a sum needs at least 2 terms",
+				"the maximum number of terms %d is below 2", n)
+		}
+		o.maxTerms = n
+		return nil
+	}
+}
+
+// sumOfPowers decomposes num into a sum of 2 to max distinct powers of two,
+// one per bit that is set.
+func sumOfPowers(num *big.Int, max int) (Candidate, bool) {
+	if num.Sign() <= 0 {
+		return Candidate{}, false
+	}
+	var terms []int
+	for i := num.BitLen() - 1; i >= 0; i-- {
+		if num.Bit(i) == 0 {
+			continue
+		}
+		if len(terms) == max {
+			return Candidate{}, false
+		}
+		terms = append(terms, i)
+	}
+	if len(terms) < 2 {
+		return Candidate{}, false // An exact power, for the power form
+	}
+	return Candidate{Form: FormSumOfPowers, N: terms[0], M: terms[len(terms)-1], Terms: terms}, true
+}
+
+// joinTerms renders the terms of a sum-of-powers candidate with term and
+// joins them with op.
+func joinTerms(c Candidate, op string, term func(n int) string) string {
+	parts := make([]string, len(c.Terms))
+	for i, n := range c.Terms {
+		parts[i] = term(n)
+	}
+	return strings.Join(parts, " "+op+" ")
+}
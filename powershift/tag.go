@@ -0,0 +1,33 @@
+package powershift
+
+import "strings"
+
+// DefaultTag is the marker the command-line tool tags rewrites with.
+const DefaultTag = "psfmt"
+
+// WithTag marks every rewrite with a comment holding marker, as in
+// 1<<20 /* psfmt */, so machine-made expressions can be told apart from
+// hand-written ones later. Languages without block comments get the marker
+// in the line comment at the end of the line.
+func WithTag(marker string) Option {
+	return func(o *options) error {
+		if marker == "" || strings.ContainsAny(marker, "\r\n,") || strings.Contains(marker, "*/") {
+			return Errorf(ErrInvalidOption, "set", "tag", "use a short word such as "+DefaultTag,
+				"tag %q cannot go in a comment", marker)
+		}
+		o.tag = marker
+		return nil
+	}
+}
+
+// tagged returns out with the tag comment appended, or out and the tag as a
+// note for the line comment if the language has no block comments.
+func (f *Formatter) tagged(out string) (string, string) {
+	if f.opts.tag == "" {
+		return out, ""
+	}
+	if c := f.opts.profile.BlockComment; c[0] != "" {
+		return out + " " + c[0] + " " + f.opts.tag + " " + c[1], ""
+	}
+	return out, f.opts.tag
+}
@@ -0,0 +1,114 @@
+package powershift
+
+import (
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tier sets how values of at least Min are rewritten, so that small values
+// can be treated more conservatively than large ones.
+type Tier struct {
+	Min   *big.Int
+	Emit  Emit   // Empty keeps the Formatter's emit mode
+	Forms []Form // Empty keeps the Formatter's forms
+}
+
+// tier is a Tier with its strategies looked up.
+type tier struct {
+	Tier
+	strategies []strategy
+}
+
+// WithTiers applies the tier with the largest Min not above each value.
+// Values below every tier are left alone. The threshold still applies on top
+// of the tiers, and range pairs (WithRanges) are rewritten the same in every
+// tier.
+func WithTiers(tiers ...Tier) Option {
+	return func(o *options) error {
+		o.tiers = nil
+		for _, t := range tiers {
+			if t.Min == nil {
+				return Errorf(ErrInvalidOption, "set", "tiers", "", "tier without a minimum")
+			}
+			if t.Emit != "" {
+				if _, err := ParseEmit(string(t.Emit)); err != nil {
+					return err
+				}
+			}
+			for _, f := range t.Forms {
+				if _, err := ParseForm(string(f)); err != nil {
+					return err
+				}
+			}
+			t.Min = new(big.Int).Set(t.Min)
+			t.Forms = slices.Clone(t.Forms)
+			o.tiers = append(o.tiers, t)
+		}
+		// Highest first, so the first tier a value reaches is the one it is in
+		slices.SortStableFunc(o.tiers, func(a, b Tier) int { return b.Min.Cmp(a.Min) })
+		return nil
+	}
+}
+
+// ParseTiers parses tiers written as comma-separated MIN[:SPEC...] entries.
+// MIN is an integer, which may be written as 1e6. Each SPEC is an emit mode or
+// forms joined with "+". For example:
+//
+//	1000:annotate, 1e6:minus-one, 1e9
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		min, ok := parseMin(parts[0])
+		if !ok {
+			return nil, Errorf(ErrInvalidOption, "parse", "tiers", "write the minimum as 1000000 or 1e6",
+				"invalid minimum %q", parts[0])
+		}
+		t := Tier{Min: min}
+		for _, spec := range parts[1:] {
+			spec = strings.TrimSpace(spec)
+			if e, err := ParseEmit(spec); err == nil {
+				t.Emit = e
+				continue
+			}
+			for _, name := range strings.Split(spec, "+") {
+				form, err := ParseForm(name)
+				if err != nil {
+					return nil, Errorf(ErrInvalidOption, "parse", "tiers", "use emit modes and forms joined with +",
+						"%q is neither an emit mode nor a form", spec)
+				}
+				t.Forms = append(t.Forms, form)
+			}
+		}
+		tiers = append(tiers, t)
+	}
+	return tiers, nil
+}
+
+func parseMin(s string) (*big.Int, bool) {
+	mantissa, exp, sci := strings.Cut(s, "e")
+	v, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok || v.Sign() < 0 {
+		return nil, false
+	}
+	if sci {
+		n, err := strconv.Atoi(exp)
+		if err != nil || n < 0 || n > 1000 {
+			return nil, false
+		}
+		v.Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+	}
+	return v, true
+}
+
+// tierFor returns the tier of v, or nil if v is below every tier.
+func (f *Formatter) tierFor(v *big.Int) *tier {
+	for i := range f.tiers {
+		if v.Cmp(f.tiers[i].Min) >= 0 {
+			return &f.tiers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package powershift
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// romanPattern matches the roman numerals from I to MMMCMXCIX, in capitals
+// and as whole words. The lookbehind keeps it from matching the empty string
+// before a word such as In.
+const romanPattern = `\b(?=[MDCLXVI])M{0,3}(?:CM|CD|D?C{0,3})(?:XC|XL|L?X{0,3})(?:IX|IV|V?I{0,3})(?<=[MDCLXVI])\b`
+
+var romanValues = map[byte]int64{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// RomanParser returns the LiteralParser of roman numerals such as MXXIV, for
+// documentation. It is experimental: words such as MIX are numerals too, so
+// it is meant for EmitAnnotate, which keeps the numeral and adds its
+// expression in a comment.
+func RomanParser() LiteralParser {
+	return NewLiteralParser(romanPattern, parseRoman)
+}
+
+func parseRoman(text string) (*big.Int, bool) {
+	var total int64
+	for i := 0; i < len(text); i++ {
+		v := romanValues[text[i]]
+		if i+1 < len(text) && romanValues[text[i+1]] > v {
+			v = -v // The I of IV
+		}
+		total += v
+	}
+	return big.NewInt(total), total > 0
+}
+
+// Number words of WordsParser, by value.
+var (
+	unitWords  = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+	teenWords  = []string{"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	tensWords  = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	scaleWords = []string{"thousand", "million", "billion", "trillion"}
+)
+
+// wordsPattern matches runs of English number words as whole words, joined
+// by spaces, hyphens or "and", such as sixty-five thousand five hundred and
+// thirty-six.
+var wordsPattern = func() string {
+	var words []string
+	for _, list := range [][]string{teenWords, tensWords, unitWords, scaleWords, {"hundred"}} {
+		for _, w := range list {
+			if w != "" {
+				words = append(words, fmt.Sprintf("[%s%s]%s", strings.ToUpper(w[:1]), w[:1], w[1:]))
+			}
+		}
+	}
+	word := `(?:` + strings.Join(words, "|") + `)\b`
+	// and only follows hundred or a scale word, so that one and two is two
+	// numbers rather than an invalid one
+	and := `(?<=[Hh]undred|[Tt]housand|[Mm]illion|[Bb]illion|[Tt]rillion) and `
+	return `\b` + word + `(?:(?:[ -]|` + and + `)` + word + `)*`
+}()
+
+// WordsParser returns the LiteralParser of numbers spelled out in English,
+// such as sixty-five thousand five hundred thirty-six, for documentation. It
+// is experimental and meant for EmitAnnotate, like RomanParser. Runs of words
+// that do not spell one number, such as one two, are left alone.
+func WordsParser() LiteralParser {
+	return NewLiteralParser(wordsPattern, parseWords)
+}
+
+func parseWords(text string) (*big.Int, bool) {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return r == ' ' || r == '-' })
+	total, group := new(big.Int), int64(0) // group is the value below the next scale word
+	last := ""                             // Kind of the previous word
+	lastScale := len(scaleWords)
+	for _, w := range fields {
+		switch {
+		case w == "and":
+			if last != "hundred" && last != "scale" {
+				return nil, false
+			}
+			last = "and"
+		case w == "hundred":
+			if group == 0 || group >= 100 || last == "and" {
+				return nil, false
+			}
+			group *= 100
+			last = "hundred"
+		case slices.Index(scaleWords, w) >= 0:
+			i := slices.Index(scaleWords, w)
+			if group == 0 || i >= lastScale || last == "and" {
+				return nil, false
+			}
+			scale := new(big.Int).Exp(big.NewInt(1000), big.NewInt(int64(i+1)), nil)
+			total.Add(total, scale.Mul(scale, big.NewInt(group)))
+			group, last, lastScale = 0, "scale", i
+		default:
+			n, kind := wordValue(w)
+			if n < 0 || group%100 != 0 && (kind != "unit" || last != "tens") || kind == "zero" && len(fields) > 1 {
+				return nil, false // Two numbers in a row, as in one two
+			}
+			group += n
+			last = kind
+		}
+	}
+	if last == "and" {
+		return nil, false
+	}
+	return total.Add(total, big.NewInt(group)), true
+}
+
+// wordValue returns the value of a number word below a hundred and whether
+// it is a zero, unit, teen or tens, or -1 if it is not one.
+func wordValue(w string) (int64, string) {
+	if i := slices.Index(unitWords, w); i == 0 {
+		return 0, "zero"
+	} else if i > 0 {
+		return int64(i), "unit"
+	}
+	if i := slices.Index(teenWords, w); i >= 0 {
+		return int64(10 + i), "teen"
+	}
+	if i := slices.Index(tensWords, w); i >= 2 {
+		return int64(10 * i), "tens"
+	}
+	return -1, ""
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// preflightVolume is the space a -w batch needs on one filesystem.
+type preflightVolume struct {
+	dir   string // A directory on it, for messages and the free space query
+	need  int64
+	files int
+}
+
+// preflight implements -preflight: it formats every path of a -w batch
+// without writing anything and checks that each file that would change can
+// be written with strategy, given the -break-links or -preserve-links choice
+// links, and that its filesystem has room for the result.
+// It logs every problem it finds and fails if there is any, so that a run
+// does not stop halfway through the tree.
+func preflight(paths []string, formatter *powershift.Formatter, strategy, links string) error {
+	problems := 0
+	problem := func(path string, err error) {
+		logf("Preflight: %s: %v", path, err)
+		problems++
+	}
+	volumes := map[uint64]*preflightVolume{}
+	writableDirs := map[string]error{}
+	var total int64
+	changed := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			problem(path, err)
+			continue
+		}
+		strategy := strategy
+		if linkCount(info) > 1 && strategy == writeRename {
+			switch links {
+			case linksPreserve:
+				strategy = writeCopy
+			case linksWarn:
+				continue // Skipped with a warning, as by the run itself
+			}
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			problem(path, err)
+			continue
+		}
+		stats, err := formatter.Transform(io.Discard, in)
+		in.Close()
+		if err != nil {
+			problem(path, err)
+			continue
+		}
+		if !stats.Changed() {
+			continue // Left alone
+		}
+		changed++
+		total += stats.BytesWritten
+
+		// Every strategy but in-place writes a temp file next to the target
+		need := stats.BytesWritten
+		if strategy == writeInPlace {
+			need = max(0, stats.BytesWritten-info.Size())
+		}
+		if strategy != writeRename {
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				problem(path, err)
+				continue
+			}
+			f.Close()
+		}
+		dir := filepath.Dir(path)
+		if strategy != writeInPlace {
+			err, ok := writableDirs[dir]
+			if !ok {
+				err = checkDirWritable(dir)
+				writableDirs[dir] = err
+			}
+			if err != nil {
+				problem(path, err)
+				continue
+			}
+		}
+		dev := deviceOf(info)
+		v := volumes[dev]
+		if v == nil {
+			v = &preflightVolume{dir: dir}
+			volumes[dev] = v
+		}
+		v.need += need
+		v.files++
+	}
+	for _, v := range volumes {
+		if free, ok := freeSpace(v.dir); ok && uint64(v.need) > free {
+			problem(v.dir, fmt.Errorf("%d files need %d bytes on its filesystem, which has %d free", v.files, v.need, free))
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("preflight found %d problems; no file was written", problems)
+	}
+	logf("Preflight: %d of %d files would change, %d bytes to write", changed, len(paths), total)
+	return nil
+}
+
+// checkDirWritable reports whether a temp file can be created in dir.
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".powershift-preflight-*")
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return fmt.Errorf("cannot create files in %s: %w", dir, pathErr.Err)
+		}
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
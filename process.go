@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// processor transforms input files according to the CLI settings.
+type processor struct {
+	formatter   *powershift.Formatter
+	out         io.Writer // Destination when not writing in place
+	inPlace     bool
+	strategy    string // Write strategy for inPlace
+	links       string // Treatment of hard-linked files for inPlace
+	skipSecrets bool
+	streaming   bool // Whether the formatter streams its input
+	diff        bool // Write a unified diff instead of the result
+	dupes       *duplicates
+
+	// The edits and results the formatter reported for the current input
+	edits   []powershift.Edit
+	results []powershift.Result
+
+	// reconfigure builds the formatter for a document whose stdin header
+	// overrides some settings
+	reconfigure func([]configValue) (*powershift.Formatter, error)
+
+	totals totals
+}
+
+// totals sums up a run for -summary-json.
+type totals struct {
+	Files        int   `json:"files"`
+	Skipped      int   `json:"skipped"`
+	Duplicates   int   `json:"duplicates"`
+	Failed       int   `json:"failed"`
+	Matches      int   `json:"matches"`
+	Replaced     int   `json:"replaced"`
+	Annotated    int   `json:"annotated"`
+	BytesRead    int64 `json:"bytes_read"`
+	BytesWritten int64 `json:"bytes_written"`
+}
+
+func (t *totals) add(s powershift.Stats) {
+	t.Matches += s.Matches
+	t.Replaced += s.Replaced
+	t.Annotated += s.Annotated
+	t.BytesRead += s.BytesRead
+	t.BytesWritten += s.BytesWritten
+}
+
+func (t *totals) merge(o totals) {
+	t.Files += o.Files
+	t.Skipped += o.Skipped
+	t.Duplicates += o.Duplicates
+	t.Failed += o.Failed
+	t.add(powershift.Stats{Matches: o.Matches, Replaced: o.Replaced, Annotated: o.Annotated, BytesRead: o.BytesRead, BytesWritten: o.BytesWritten})
+}
+
+// process transforms one input, writing the result to p.out or, with
+// p.inPlace, back to the input file. skipped reports that the file was
+// deliberately left alone.
+func (p *processor) process(path string) (skipped bool, err error) {
+	if path == stdinPath {
+		return false, p.processStdin()
+	}
+	if documentKind(path) != nil {
+		return false, powershift.Errorf(powershift.ErrInvalidOption, "format", path, documentHint(path),
+			"documents cannot be rewritten")
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return false, readError(path, err)
+	}
+	defer in.Close()
+
+	var src io.Reader = in
+	if p.skipSecrets {
+		head, reason, err := sniffSecret(path, in)
+		if err != nil {
+			return false, readError(path, err)
+		}
+		if reason != "" {
+			logf("Skipping %s: looks like %s", path, reason)
+			if p.inPlace || p.diff {
+				return true, nil
+			}
+			// Pass the file through untouched
+			if _, err := io.Copy(p.out, io.MultiReader(bytes.NewReader(head), in)); err != nil {
+				return true, writeError("write", "", err)
+			}
+			return true, nil
+		}
+		src = io.MultiReader(bytes.NewReader(head), in)
+	}
+
+	if p.streaming && !p.diff {
+		if !p.inPlace {
+			stats, err := p.formatter.Transform(p.out, src)
+			p.totals.add(stats)
+			return false, err
+		}
+		return p.streamInPlace(path, in, src)
+	}
+
+	// The whole input is in memory from here on; a quick scan tells whether
+	// it can be passed through as it is
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return false, readError(path, err)
+	}
+	if !p.formatter.MayRewrite(data) {
+		p.totals.add(powershift.Stats{BytesRead: int64(len(data)), BytesWritten: int64(len(data))})
+		if p.inPlace || p.diff {
+			return false, nil // Not touched at all, so its mtime is kept
+		}
+		if _, err := p.out.Write(data); err != nil {
+			return false, writeError("write", "", err)
+		}
+		return false, nil
+	}
+	if g := p.dupes.group(path, data); g != nil {
+		return p.processDuplicate(path, in, data, g)
+	}
+	if p.diff {
+		return false, p.writeDiff(p.formatter, path, data)
+	}
+	if !p.inPlace {
+		stats, err := p.formatter.Transform(p.out, bytes.NewReader(data))
+		p.totals.add(stats)
+		return false, err
+	}
+
+	info, strategy, err := p.inPlaceStrategy(path, in)
+	if err != nil {
+		return false, err
+	}
+	if strategy == "" {
+		return true, nil
+	}
+	var buf bytes.Buffer
+	stats, err := p.formatter.Transform(&buf, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	p.totals.add(stats)
+	if !stats.Changed() {
+		return false, nil // Nothing changed, so the file is left alone
+	}
+	in.Close()
+	return false, replaceFile(path, buf.Bytes(), info.Mode().Perm(), strategy)
+}
+
+// processDuplicate formats data, the content of path, which other inputs of
+// the batch share. Only the first of them is formatted; the others reuse its
+// result.
+func (p *processor) processDuplicate(path string, in *os.File, data []byte, g *dupGroup) (skipped bool, err error) {
+	res := g.wait(path)
+	if res == nil {
+		var buf bytes.Buffer
+		stats, err := p.formatter.Transform(&buf, bytes.NewReader(data))
+		if err != nil {
+			return false, err
+		}
+		res = &formatted{output: buf.Bytes(), stats: stats, edits: p.edits, results: p.results}
+		g.publish(res)
+	} else {
+		logf("%s is identical to %s; reusing its result", path, g.first)
+		p.edits, p.results = slices.Clone(res.edits), slices.Clone(res.results)
+		p.totals.Duplicates++
+	}
+	p.totals.add(res.stats)
+
+	switch {
+	case p.diff:
+		if err := writeDiff(p.out, filepath.ToSlash(path), data, res.output); err != nil {
+			return false, writeError("write", "", err)
+		}
+		return false, nil
+	case !p.inPlace:
+		if _, err := p.out.Write(res.output); err != nil {
+			return false, writeError("write", "", err)
+		}
+		return false, nil
+	}
+	info, strategy, err := p.inPlaceStrategy(path, in)
+	if err != nil {
+		return false, err
+	}
+	if strategy == "" {
+		return true, nil
+	}
+	if !res.stats.Changed() {
+		return false, nil // Nothing changed, so the file is left alone
+	}
+	in.Close()
+	return false, replaceFile(path, res.output, info.Mode().Perm(), strategy)
+}
+
+// inPlaceStrategy returns the mode of the input file in and the strategy to
+// rewrite it with, or no strategy if it has to be skipped.
+func (p *processor) inPlaceStrategy(path string, in *os.File) (fs.FileInfo, string, error) {
+	info, err := in.Stat()
+	if err != nil {
+		return nil, "", readError(path, err)
+	}
+	strategy := p.strategy
+	// Renaming over a hard-linked file silently detaches the other links
+	if n := linkCount(info); n > 1 && strategy == writeRename {
+		switch p.links {
+		case linksPreserve:
+			strategy = writeCopy
+		case linksBreak:
+		default:
+			logf("Warning: skipping %s: it has %d hard links and -write-strategy rename would detach them; pass -preserve-links or -break-links", path, n)
+			return info, "", nil
+		}
+	}
+	return info, strategy, nil
+}
+
+// streamInPlace rewrites the file in by streaming src, its content, into a
+// temp file, so that the file is never held in memory.
+func (p *processor) streamInPlace(path string, in *os.File, src io.Reader) (skipped bool, err error) {
+	info, strategy, err := p.inPlaceStrategy(path, in)
+	if err != nil {
+		return false, err
+	}
+	if strategy == "" {
+		return true, nil
+	}
+	var stats powershift.Stats
+	tmp, err := writeTemp(path, info.Mode().Perm(), func(w io.Writer) error {
+		var err error
+		stats, err = p.formatter.Transform(w, src)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	p.totals.add(stats)
+	if !stats.Changed() {
+		os.Remove(tmp) // Nothing changed, so the file is left alone
+		return false, nil
+	}
+	in.Close()
+	return false, installTemp(path, tmp, strategy)
+}
+
+// stdinPath is the input name that stands for standard input.
+const stdinPath = "-"
+
+// stdinIsTerminal reports whether standard input is a terminal rather than a
+// pipe or a file.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err != nil || info.Mode()&os.ModeCharDevice != 0
+}
+
+// stdinHeaderPrefix starts the optional first line of standard input that
+// selects settings for that document, such as "#powershift: lang=go t=1024".
+const stdinHeaderPrefix = "#powershift:"
+
+// processStdin transforms standard input to p.out. A header line is applied
+// and left out of the output.
+func (p *processor) processStdin() error {
+	in := bufio.NewReader(os.Stdin)
+	formatter := p.formatter
+	if head, _ := in.Peek(len(stdinHeaderPrefix)); string(head) == stdinHeaderPrefix {
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return readError("stdin", err)
+		}
+		values, err := parseStdinHeader(strings.TrimSpace(strings.TrimPrefix(line, stdinHeaderPrefix)))
+		if err != nil {
+			return err
+		}
+		if formatter, err = p.reconfigure(values); err != nil {
+			return err
+		}
+	}
+	if p.diff {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return readError("stdin", err)
+		}
+		return p.writeDiff(formatter, "stdin", data)
+	}
+	stats, err := formatter.Transform(p.out, in)
+	p.totals.add(stats)
+	return err
+}
+
+// writeDiff formats data, the content of path, and writes the diff of the
+// result.
+func (p *processor) writeDiff(formatter *powershift.Formatter, path string, data []byte) error {
+	var buf bytes.Buffer
+	stats, err := formatter.Transform(&buf, bytes.NewReader(data))
+	p.totals.add(stats)
+	if err != nil {
+		return err
+	}
+	if err := writeDiff(p.out, filepath.ToSlash(path), data, buf.Bytes()); err != nil {
+		return writeError("write", "", err)
+	}
+	return nil
+}
+
+// stdinHeaderKeys are the config keys a stdin header may set: those that
+// only affect how the document is formatted.
+var stdinHeaderKeys = []string{"threshold", "max", "min_digits", "emit", "expr_style", "lang", "tiers", "ranges", "annotate_ranges", "skip_arithmetic", "continuations", "tag", "shifted_neighbors", "per_line", "fold"}
+
+// parseStdinHeader parses the KEY=VALUE settings of a stdin header. Keys are
+// those of the config file, with "t" accepted for the threshold.
+func parseStdinHeader(s string) ([]configValue, error) {
+	var values []configValue
+	for _, setting := range strings.Fields(s) {
+		key, value, ok := strings.Cut(setting, "=")
+		if key == "t" {
+			key = "threshold"
+		}
+		field, known := lookupConfigField(key)
+		if !ok || !known || !slices.Contains(stdinHeaderKeys, key) {
+			return nil, powershift.Errorf(powershift.ErrInvalidOption, "parse", "stdin header",
+				"settings are KEY=VALUE with KEY one of "+strings.Join(stdinHeaderKeys, ", "), "invalid setting %q", setting)
+		}
+		var raw any = value
+		switch field.Type {
+		case "integer":
+			raw = json.Number(value)
+		case "boolean":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, powershift.Errorf(powershift.ErrInvalidOption, "parse", "stdin header", "", "%s: expected true or false, got %q", key, value)
+			}
+			raw = b
+		}
+		v, err := field.convert(raw)
+		if err != nil {
+			return nil, powershift.NewError(powershift.ErrInvalidOption, "parse", "stdin header", fmt.Errorf("%s: %w", key, err), "")
+		}
+		values = append(values, configValue{Field: field, Value: v})
+	}
+	return values, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// Report formats accepted by -report.
+const (
+	reportJSON    = "json"
+	reportVimgrep = "vimgrep" // file:line:col: message, for quickfix lists
+	reportSARIF   = "sarif"   // For GitHub code scanning and other SARIF consumers
+)
+
+var reportFormats = []string{reportJSON, reportVimgrep, reportSARIF}
+
+// finding is one replacement in a report.
+type finding struct {
+	ID         int    `json:"id"` // 1-based position in the report, used by "apply -ids"
+	File       string `json:"file"`
+	Page       int    `json:"page,omitempty"`      // Set for PDF documents
+	Paragraph  int    `json:"paragraph,omitempty"` // Set for docx documents
+	Line       int    `json:"line"`                // Relative to the page or paragraph, if set
+	Column     int    `json:"column"`
+	Offset     int64  `json:"offset"` // Byte offset in the file, page or paragraph
+	Original   string `json:"original"`
+	Expression string `json:"expression"`
+	Form       string `json:"form,omitempty"`
+	Skipped    string `json:"skipped,omitempty"` // Why a number a form decomposes was kept, with -report-suspicious
+	Context    string `json:"context,omitempty"` // Source line, left out with -redact-context
+
+	// Set with -report-bits
+	Kept      bool   `json:"kept,omitempty"` // The number was left as it was
+	Hex       string `json:"hex,omitempty"`
+	Binary    string `json:"binary,omitempty"`
+	BitLength int    `json:"bit_length,omitempty"`
+	Popcount  int    `json:"popcount,omitempty"`
+
+	// BitPattern is Binary padded to whole bytes in groups of four, such as
+	// 0b0000_1111_1111_1111_1111_1111, so runs of ones stand out
+	BitPattern string `json:"bit_pattern,omitempty"`
+}
+
+// reportDoc is the top-level JSON report.
+type reportDoc struct {
+	Findings []finding `json:"findings"`
+
+	// Suspicious are the numbers a form decomposes but a safeguard kept, with
+	// -report-suspicious
+	Suspicious []finding `json:"suspicious,omitempty"`
+}
+
+// reporter collects findings while files are processed.
+type reporter struct {
+	format        string
+	redactContext bool
+	bits          bool               // Add base conversions and include kept numbers
+	suspicious    bool               // Include kept numbers that have a decomposition, with the reason
+	tmpl          *template.Template // Writes the report in place of format, with -report-template
+	file          string             // File being processed
+	unit          string             // "page" or "paragraph" of a document being analyzed, if any
+	unitN         int
+	findings      []finding
+}
+
+func newReporter(format string, redactContext, bits, suspicious bool) (*reporter, error) {
+	if !slices.Contains(reportFormats, format) {
+		return nil, powershift.Errorf(powershift.ErrInvalidOption, "parse", "-report",
+			"known formats are "+strings.Join(reportFormats, ", "), "unknown report format %q", format)
+	}
+	return &reporter{format: format, redactContext: redactContext, bits: bits, suspicious: suspicious, findings: []finding{}}, nil
+}
+
+// fork returns an empty reporter with the same settings, for a worker to
+// collect the findings of its files in.
+func (r *reporter) fork() *reporter {
+	return &reporter{format: r.format, redactContext: r.redactContext, bits: r.bits, suspicious: r.suspicious, tmpl: r.tmpl, findings: []finding{}}
+}
+
+// newReport builds the reporter of the -report flags, which writes format
+// unless a -report-template is given.
+func (c *cliFlags) newReport(format string) (*reporter, error) {
+	if c.reportTemplate != "" {
+		if c.reportFormat != "" {
+			return nil, powershift.Errorf(powershift.ErrInvalidOption, "check", "-report-template",
+				"drop -report; the template decides the format", "-report-template cannot be combined with -report")
+		}
+		format = reportJSON
+	}
+	r, err := newReporter(format, c.redactContext, c.reportBits, c.reportSuspicious)
+	if err != nil || c.reportTemplate == "" {
+		return r, err
+	}
+	r.tmpl, err = loadReportTemplate(c.reportTemplate)
+	return r, err
+}
+
+// merge appends the findings of a file collected by a fork, numbering them on
+// from the findings already there.
+func (r *reporter) merge(findings []finding) {
+	for _, f := range findings {
+		f.ID = len(r.findings) + 1
+		r.findings = append(r.findings, f)
+	}
+}
+
+// add records a result of the file being processed. Numbers that were kept
+// are only part of the report with -report-bits, or with -report-suspicious
+// if a safeguard kept them.
+func (r *reporter) add(res powershift.Result) {
+	suspicious := r.suspicious && res.Skipped != ""
+	if !res.Replaced && !r.bits && !suspicious {
+		return
+	}
+	f := finding{
+		ID:         len(r.findings) + 1,
+		File:       r.file,
+		Line:       res.Line,
+		Column:     res.Column,
+		Offset:     res.Offset,
+		Original:   res.Text,
+		Expression: res.Output,
+	}
+	switch r.unit {
+	case "page":
+		f.Page = r.unitN
+	case "paragraph":
+		f.Paragraph = r.unitN
+	}
+	if res.Candidate != nil && res.Output == res.Expr {
+		f.Form = string(res.Candidate.Form)
+	}
+	if !r.redactContext {
+		f.Context = res.Context
+	}
+	if r.bits {
+		f.Hex = fmt.Sprintf("0x%x", res.Value)
+		f.Binary = fmt.Sprintf("0b%b", res.Value)
+		f.BitLength = res.Value.BitLen()
+		f.Popcount = popcount(res.Value)
+		f.BitPattern = bitPattern(res.Value)
+	}
+	if !res.Replaced {
+		f.Kept, f.Expression = true, ""
+	}
+	if suspicious {
+		f.Skipped = string(res.Skipped)
+	}
+	r.findings = append(r.findings, f)
+}
+
+// bitPattern renders v in binary with leading zeros up to a whole number of
+// bytes and an underscore between groups of four bits.
+func bitPattern(v *big.Int) string {
+	digits := v.Text(2)
+	if pad := (8 - len(digits)%8) % 8; pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	var sb strings.Builder
+	sb.WriteString("0b")
+	for i := 0; i < len(digits); i += 4 {
+		if i > 0 {
+			sb.WriteByte('_')
+		}
+		sb.WriteString(digits[i : i+4])
+	}
+	return sb.String()
+}
+
+func popcount(v *big.Int) int {
+	n := 0
+	for _, w := range v.Bits() {
+		n += bits.OnesCount(uint(w))
+	}
+	return n
+}
+
+// write emits the report to dest, or to stderr when dest is empty, so that it
+// never mixes with transformed output on stdout.
+func (r *reporter) write(dest string) error {
+	if dest == "" {
+		return r.encode(os.Stderr)
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return writeError("create", dest, err)
+	}
+	if err := r.encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return writeError("write", dest, err)
+	}
+	return nil
+}
+
+// doc returns the findings with those of -report-suspicious in a section of
+// their own.
+func (r *reporter) doc() reportDoc {
+	doc := reportDoc{Findings: []finding{}}
+	for _, f := range r.findings {
+		if f.Skipped != "" {
+			doc.Suspicious = append(doc.Suspicious, f)
+		} else {
+			doc.Findings = append(doc.Findings, f)
+		}
+	}
+	return doc
+}
+
+func (r *reporter) encode(w io.Writer) error {
+	if r.tmpl != nil {
+		return r.encodeTemplate(w)
+	}
+	switch r.format {
+	case reportJSON:
+		return writeJSON(w, r.doc())
+	case reportVimgrep:
+		return r.encodeVimgrep(w)
+	case reportSARIF:
+		return r.encodeSARIF(w)
+	}
+	return fmt.Errorf("unreachable report format %q", r.format)
+}
+
+// encodeVimgrep writes one file:line:col: line per finding, the format of
+// Vim's quickfix list and Emacs' compilation mode.
+func (r *reporter) encodeVimgrep(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.findings {
+		msg := fmt.Sprintf("%s can be written as %s", f.Original, f.Expression)
+		if f.Kept {
+			msg = f.Original + " was kept"
+		}
+		if f.Skipped != "" {
+			msg += " (" + f.Skipped + ")"
+		}
+		if f.BitPattern != "" {
+			msg += " [" + f.BitPattern + "]"
+		}
+		switch {
+		case f.Page != 0:
+			msg += fmt.Sprintf(" (page %d)", f.Page)
+		case f.Paragraph != 0:
+			msg += fmt.Sprintf(" (paragraph %d)", f.Paragraph)
+		}
+		fmt.Fprintf(bw, "%s:%d:%d: %s\n", f.File, f.Line, f.Column, msg)
+	}
+	if err := bw.Flush(); err != nil {
+		return writeError("write", "", err)
+	}
+	return nil
+}
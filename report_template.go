@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// reportTemplateHint lists what a -report-template can refer to.
+const reportTemplateHint = "the template sees .Findings and .Suspicious, whose entries have .ID, .File, .Line, .Column, " +
+	".Original, .Expression, .Form, .Context, .Kept and .Skipped"
+
+// loadReportTemplate parses the -report-template file at path and tries it on
+// a sample report, so that an unknown field stops the run before any file is
+// read.
+func loadReportTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, readError(path, err)
+	}
+	t, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(text))
+	if err == nil {
+		sample := finding{ID: 1, File: "limits.h", Line: 1, Column: 1, Original: "1048575", Expression: "1<<20 - 1", Form: "minus-one"}
+		err = t.Execute(io.Discard, reportDoc{Findings: []finding{sample}, Suspicious: []finding{sample}})
+	}
+	if err != nil {
+		return nil, powershift.NewError(powershift.ErrInvalidOption, "parse", path, err, reportTemplateHint)
+	}
+	return t, nil
+}
+
+// encodeTemplate writes the report through the -report-template.
+func (r *reporter) encodeTemplate(w io.Writer) error {
+	if err := r.tmpl.Execute(w, r.doc()); err != nil {
+		return powershift.NewError(powershift.ErrWriteFailed, "execute", r.tmpl.Name(), err, reportTemplateHint)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sarifRuleID is the rule every SARIF result belongs to.
+const sarifRuleID = "power-shift"
+
+// The subset of SARIF 2.1.0 that -report sarif writes: one run with one
+// result, and a fix replacing the literal, per rewritable number.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool       sarifTool     `json:"tool"`
+		ColumnKind string        `json:"columnKind"`
+		Results    []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+		Properties       struct {
+			Tags []string `json:"tags"`
+		} `json:"properties"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+		Fixes     []sarifFix      `json:"fixes,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           sarifRegion   `json:"region"`
+	}
+	sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int    `json:"startLine,omitempty"`
+		StartColumn int    `json:"startColumn,omitempty"`
+		EndColumn   int    `json:"endColumn,omitempty"`
+		ByteOffset  *int64 `json:"byteOffset,omitempty"`
+		ByteLength  *int   `json:"byteLength,omitempty"`
+	}
+	sarifFix struct {
+		Description     sarifMessage          `json:"description"`
+		ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+	}
+	sarifArtifactChange struct {
+		ArtifactLocation sarifArtifact      `json:"artifactLocation"`
+		Replacements     []sarifReplacement `json:"replacements"`
+	}
+	sarifReplacement struct {
+		DeletedRegion   sarifRegion  `json:"deletedRegion"`
+		InsertedContent sarifMessage `json:"insertedContent"`
+	}
+)
+
+// encodeSARIF writes the findings as a SARIF log, for GitHub code scanning
+// and other SARIF consumers. Numbers that were kept are left out.
+func (r *reporter) encodeSARIF(w io.Writer) error {
+	rule := sarifRule{ID: sarifRuleID,
+		ShortDescription: sarifMessage{Text: "Large literal can be written as a power-of-two expression"}}
+	rule.Properties.Tags = []string{"style", "readability"}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "PowerShiftFormatter",
+			Version:        currentBuildInfo().Version,
+			InformationURI: "https://github.com/doraemonkeys/PowerShiftFormatter",
+			Rules:          []sarifRule{rule},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+	for _, f := range r.findings {
+		if f.Kept {
+			continue
+		}
+		run.Results = append(run.Results, sarifResultOf(f))
+	}
+	return writeJSON(w, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func sarifResultOf(f finding) sarifResult {
+	artifact := sarifArtifact{URI: filepath.ToSlash(f.File)}
+	region := sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+	if f.Column-1 <= len(f.Context) && strings.HasPrefix(f.Context[f.Column-1:], f.Original) {
+		// Columns are bytes, SARIF counts code points. The context is only
+		// known to start the line if the literal is where its column says
+		region.StartColumn = utf8.RuneCountInString(f.Context[:f.Column-1]) + 1
+	}
+	if !strings.Contains(f.Original, "\n") {
+		region.EndColumn = region.StartColumn + utf8.RuneCountInString(f.Original)
+	}
+	res := sarifResult{
+		RuleID:    sarifRuleID,
+		Level:     "note",
+		Message:   sarifMessage{Text: f.Original + " can be written as " + f.Expression},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact, Region: region}}},
+	}
+	if f.Page != 0 || f.Paragraph != 0 {
+		return res // Lines and offsets are those of a page or paragraph, not of the file
+	}
+	offset, length := f.Offset, len(f.Original)
+	res.Fixes = []sarifFix{{
+		Description: sarifMessage{Text: "Write " + f.Original + " as " + f.Expression},
+		ArtifactChanges: []sarifArtifactChange{{
+			ArtifactLocation: artifact,
+			Replacements: []sarifReplacement{{
+				DeletedRegion:   sarifRegion{ByteOffset: &offset, ByteLength: &length},
+				InsertedContent: sarifMessage{Text: f.Expression},
+			}},
+		}},
+	}}
+	return res
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// secretSniffSize is how much of a file -skip-secrets inspects.
+const secretSniffSize = 8 << 10
+
+// secretNames are file names (lower-cased) of common credential stores.
+var secretNames = map[string]string{
+	".netrc":           "a netrc credential file",
+	"_netrc":           "a netrc credential file",
+	".pgpass":          "a PostgreSQL password file",
+	".git-credentials": "a git credential store",
+	".npmrc":           "an npm config with tokens",
+	".pypirc":          "a PyPI credential file",
+	".htpasswd":        "an htpasswd file",
+	"credentials":      "a credential store",
+	"id_rsa":           "a private key",
+	"id_dsa":           "a private key",
+	"id_ecdsa":         "a private key",
+	"id_ed25519":       "a private key",
+}
+
+// secretExts are extensions of key and certificate bundles.
+var secretExts = map[string]string{
+	".pem":  "a PEM key or certificate",
+	".key":  "a private key",
+	".p12":  "a PKCS#12 bundle",
+	".pfx":  "a PKCS#12 bundle",
+	".jks":  "a Java keystore",
+	".kdbx": "a KeePass database",
+}
+
+// secretMarkers are content fragments that only show up in secret material.
+var secretMarkers = []struct {
+	marker string
+	reason string
+}{
+	{"PRIVATE KEY-----", "a private key"},
+	{"-----BEGIN PGP PRIVATE", "a PGP private key"},
+	{"aws_secret_access_key", "AWS credentials"},
+	{"\"private_key_id\":", "a cloud service account key"},
+	{"xoxb-", "a Slack token"},
+	{"ghp_", "a GitHub token"},
+}
+
+// sniffSecret decides whether a file looks like it holds secrets, based on its
+// name and the first secretSniffSize bytes. It returns the bytes consumed from
+// r so the caller can still process the whole file, and a non-empty reason if
+// the file should be left alone.
+func sniffSecret(path string, r io.Reader) (head []byte, reason string, err error) {
+	head, err = io.ReadAll(io.LimitReader(r, secretSniffSize))
+	if err != nil {
+		return nil, "", err
+	}
+
+	base := strings.ToLower(filepath.Base(path))
+	if base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env") {
+		return head, "an .env file", nil
+	}
+	if reason, ok := secretNames[base]; ok {
+		return head, reason, nil
+	}
+	if reason, ok := secretExts[filepath.Ext(base)]; ok {
+		return head, reason, nil
+	}
+	for _, m := range secretMarkers {
+		if bytes.Contains(head, []byte(m.marker)) {
+			return head, m.reason, nil
+		}
+	}
+	return head, "", nil
+}
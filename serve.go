@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// server is the HTTP formatting service started by "serve".
+type server struct {
+	formatter *powershift.Formatter
+	maxBody   int64
+	// maxExpanded caps the combined size of the files in a batch archive.
+	maxExpanded int64
+	// flags are the formatter flags given on the command line; batch requests
+	// start from them.
+	flags []*flag.Flag
+	// root confines the files reachable through the path parameter; nil
+	// disables file access altogether.
+	root *os.Root
+}
+
+// runServe implements the "serve" subcommand. It accepts the formatter flags
+// (-t, -emit, -lang, ...) to configure the shared Formatter.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	rootDir := fs.String("root", "", "Directory that the path parameter is confined to (optional, file access is disabled without it)")
+	maxBody := fs.String("max-body", "10MiB", "Largest accepted request body, and with -github-app-id the largest file or API response read from GitHub")
+	maxExpanded := fs.String("max-expanded", "256MiB", "Largest combined size of the files in a /format/batch archive")
+	githubAppID := fs.Int64("github-app-id", 0, "Run as this GitHub App and review pull requests delivered to /github/webhook (optional, the webhook secret is read from "+githubSecretEnv+")")
+	githubKey := fs.String("github-key", "", "Private key file of the GitHub App")
+	githubAPI := fs.String("github-api", "https://api.github.com", "GitHub API base URL, for GitHub Enterprise Server")
+	cli := defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "serve", err, "")
+	}
+
+	limit, err := parseByteSize(*maxBody)
+	if err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-max-body", err, "use a size such as 10MiB")
+	}
+	expanded, err := parseByteSize(*maxExpanded)
+	if err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "-max-expanded", err, "use a size such as 256MiB")
+	}
+	formatter, err := powershift.New(cli.formatterOptions()...)
+	if err != nil {
+		return err
+	}
+
+	srv := &server{formatter: formatter, maxBody: limit, maxExpanded: expanded}
+	fs.Visit(func(f *flag.Flag) { srv.flags = append(srv.flags, f) })
+	if *rootDir != "" {
+		root, err := os.OpenRoot(*rootDir)
+		if err != nil {
+			return readError(*rootDir, err)
+		}
+		defer root.Close()
+		srv.root = root
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /format", srv.handleFormat)
+	mux.HandleFunc("POST /format/batch", srv.handleBatch)
+	if *githubAppID != 0 {
+		app, err := newGitHubApp(srv, *githubAppID, *githubKey, *githubAPI)
+		if err != nil {
+			return err
+		}
+		mux.HandleFunc("POST /github/webhook", app.handleWebhook)
+	}
+	logf("Listening on %s", *addr)
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: serveHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	return hs.ListenAndServe()
+}
+
+// Timeouts of the connections of "serve", so that slow clients cannot hold
+// them open. Writing allows for formatting a large batch archive.
+const (
+	serveHeaderTimeout = 10 * time.Second
+	serveReadTimeout   = time.Minute
+	serveWriteTimeout  = 5 * time.Minute
+	serveIdleTimeout   = 2 * time.Minute
+)
+
+// handleFormat formats the request body and returns the result, or, with a
+// path parameter, formats that file below the root in place.
+func (s *server) handleFormat(w http.ResponseWriter, r *http.Request) {
+	if path := r.URL.Query().Get("path"); path != "" {
+		s.formatFile(w, path)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, s.maxBody)
+	var out bytes.Buffer
+	if _, err := s.formatter.Transform(&out, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(out.Bytes())
+}
+
+// formatFile rewrites path, which must stay inside the server root. All file
+// access goes through os.Root, so ".." components and symlinks that lead
+// outside the root are rejected at open time rather than by a racy pre-check.
+func (s *server) formatFile(w http.ResponseWriter, path string) {
+	if s.root == nil {
+		http.Error(w, "file access is disabled; start the server with -root", http.StatusForbidden)
+		return
+	}
+	rel := filepath.FromSlash(path)
+	if !filepath.IsLocal(rel) {
+		http.Error(w, "path must be relative to the server root and must not contain ..", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := s.rewriteInRoot(rel)
+	var perr *powershift.Error
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "file not found", http.StatusNotFound)
+	case errors.Is(err, errNotRegular):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, powershift.ErrMatchTimeout):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case err != nil && !errors.As(err, &perr):
+		// Failures of os.Root itself, e.g. a symlink escaping the root
+		logf("Rejected path %q: %v", path, err)
+		http.Error(w, "path is not permitted", http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, map[string]any{"path": path, "matches": stats.Matches, "replaced": stats.Replaced})
+	}
+}
+
+var errNotRegular = errors.New("not a regular file")
+
+// rewriteInRoot formats rel in place using the copy strategy: the result is
+// written to a synced temp file inside the root first and then copied over the
+// original, so the original inode (and anyone watching it) is kept.
+func (s *server) rewriteInRoot(rel string) (powershift.Stats, error) {
+	in, err := s.root.Open(rel)
+	if err != nil {
+		return powershift.Stats{}, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return powershift.Stats{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return powershift.Stats{}, fmt.Errorf("%s: %w", rel, errNotRegular)
+	}
+
+	var buf bytes.Buffer
+	stats, err := s.formatter.Transform(&buf, in)
+	if err != nil {
+		return stats, err
+	}
+	in.Close()
+	if !stats.Changed() {
+		return stats, nil // Nothing changed, leave the file alone
+	}
+
+	// A unique name, so that the copy a failed write leaves behind does not
+	// block later requests for the file
+	tmp := rel + ".powershift-tmp-" + rand.Text()[:8]
+	if err := s.writeInRoot(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm(), buf.Bytes()); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			s.root.Remove(tmp) // Partly written
+		}
+		return stats, writeError("create", tmp, err)
+	}
+	if err := s.writeInRoot(rel, os.O_WRONLY|os.O_TRUNC, 0, buf.Bytes()); err != nil {
+		return stats, powershift.NewError(powershift.ErrWriteFailed, "write", rel, err,
+			fmt.Sprintf("the new content is preserved in %s", tmp))
+	}
+	s.root.Remove(tmp)
+	return stats, nil
+}
+
+func (s *server) writeInRoot(rel string, flag int, perm fs.FileMode, data []byte) error {
+	f, err := s.root.OpenFile(rel, flag, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, bytes.NewReader(data)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
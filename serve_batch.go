@@ -0,0 +1,304 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// batchReportName is the archive entry the report is stored in. An entry of
+// the same name in the uploaded archive is replaced.
+const batchReportName = "powershift-report.json"
+
+// Archive formats accepted by /format/batch; the response uses the same one.
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+var archiveContentTypes = map[string]string{
+	archiveZip:   "application/zip",
+	archiveTar:   "application/x-tar",
+	archiveTarGz: "application/gzip",
+}
+
+// errArchiveTooLarge is returned when the files of an archive expand beyond
+// the server's -max-expanded limit.
+var errArchiveTooLarge = errors.New("archive expands beyond the server limit")
+
+// batch is the state of one /format/batch request.
+type batch struct {
+	formatter   *powershift.Formatter
+	report      *reporter
+	skipSecrets bool
+	remaining   int64 // Expanded bytes still allowed
+}
+
+// handleBatch formats every file of an uploaded zip or tar archive. The
+// multipart request carries the archive in the "archive" field and, optionally,
+// settings in the "options" field as a document in config file format. The
+// response is an archive of the same format holding the formatted files and a
+// JSON report.
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "expected a multipart/form-data request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	archive, err := formPart(r, "archive")
+	if err != nil || archive == nil {
+		http.Error(w, `missing "archive" field`, http.StatusBadRequest)
+		return
+	}
+	options, err := formPart(r, "options")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cli, err := s.requestFlags(options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := &batch{skipSecrets: cli.skipSecrets, remaining: s.maxExpanded}
+	b.report, _ = newReporter(reportJSON, cli.redactContext, cli.reportBits, cli.reportSuspicious)
+	b.formatter, err = powershift.New(append(cli.formatterOptions(), powershift.WithResultFunc(b.report.add))...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := archiveFormat(archive)
+	var out bytes.Buffer
+	switch format {
+	case archiveZip:
+		err = b.zip(&out, archive)
+	case archiveTar:
+		err = b.tar(&out, bytes.NewReader(archive))
+	case archiveTarGz:
+		err = b.tarGz(&out, archive)
+	default:
+		http.Error(w, "the archive must be a zip, tar or gzip-compressed tar file", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case errors.Is(err, errArchiveTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		// Output goes to memory, so failures come from the archive or its files
+		http.Error(w, "cannot format archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", archiveContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="formatted.%s"`, format))
+	w.Write(out.Bytes())
+}
+
+// formPart returns the content of a multipart field, whether it was sent as a
+// file or as a plain value, or nil if it is missing.
+func formPart(r *http.Request, name string) ([]byte, error) {
+	if files := r.MultipartForm.File[name]; len(files) > 0 {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	if values := r.MultipartForm.Value[name]; len(values) > 0 {
+		return []byte(values[0]), nil
+	}
+	return nil, nil
+}
+
+// requestFlags returns the formatter flags the server was started with,
+// overridden by the settings of an options document.
+func (s *server) requestFlags(options []byte) (*cliFlags, error) {
+	if len(bytes.TrimSpace(options)) == 0 {
+		return flagsWith(s.flags, nil)
+	}
+	values, problems := parseConfig(options)
+	if len(problems) > 0 {
+		return nil, powershift.NewError(powershift.ErrConfigInvalid, "parse", "options",
+			errors.New(strings.Join(problems, "; ")), "")
+	}
+	return flagsWith(s.flags, values)
+}
+
+// archiveFormat recognizes an archive by its magic bytes.
+func archiveFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		return archiveTarGz
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return archiveTar
+	}
+	return ""
+}
+
+// file formats the content of one archive entry. Binary files, and with
+// skip_secrets files that look like credentials, are returned unchanged.
+func (b *batch) file(name string, r io.Reader) ([]byte, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("entry %q escapes the archive root", name)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, b.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > b.remaining {
+		return nil, errArchiveTooLarge
+	}
+	b.remaining -= int64(len(data))
+
+	if isBinary(data) {
+		return data, nil
+	}
+	if b.skipSecrets {
+		if _, reason, _ := sniffSecret(name, bytes.NewReader(data)); reason != "" {
+			logf("Skipping %s: looks like %s", name, reason)
+			return data, nil
+		}
+	}
+	b.report.file = name
+	var out bytes.Buffer
+	if _, err := b.formatter.Transform(&out, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// isBinary reports whether data looks like a binary file: it has a NUL byte
+// in its first 8KiB.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8<<10)], 0) >= 0
+}
+
+func (b *batch) reportJSON() []byte {
+	var buf bytes.Buffer
+	b.report.encode(&buf)
+	return buf.Bytes()
+}
+
+func (b *batch) zip(w io.Writer, data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		if f.Name == batchReportName {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			// Directories and symlinks are copied as they are
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		content, err := b.file(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		hdr := f.FileHeader
+		fw, err := zw.CreateHeader(&hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: batchReportName, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(b.reportJSON()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (b *batch) tarGz(w io.Writer, data []byte) error {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(w)
+	if err := b.tar(gw, gr); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (b *batch) tar(w io.Writer, r io.Reader) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Name == batchReportName {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// Directories, links and the like carry no content to format
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := b.file(hdr.Name, tr)
+		if err != nil {
+			return err
+		}
+		hdr.Size = int64(len(content))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	report := b.reportJSON()
+	if err := tw.WriteHeader(&tar.Header{Name: batchReportName, Mode: 0o644, Size: int64(len(report)), Typeflag: tar.TypeReg, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(report); err != nil {
+		return err
+	}
+	return tw.Close()
+}
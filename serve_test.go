@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+func TestRewriteInRootLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("const Size = 1048576\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// What a failed write of an earlier request leaves behind
+	if err := os.WriteFile(filepath.Join(dir, "a.go.powershift-tmp"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	formatter, err := powershift.New(powershift.WithLanguage("go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{formatter: formatter, root: root}
+
+	for range 2 {
+		if _, err := s.rewriteInRoot("a.go"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.go")); string(got) != "const Size = 1 << 20\n" {
+		t.Errorf("the file is %q", got)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "a.go.powershift-tmp-*")); len(matches) > 0 {
+		t.Errorf("temp files are left: %v", matches)
+	}
+}
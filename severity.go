@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// Severities of the numbers -check finds, the levels of SARIF.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityNote    = "note"
+)
+
+// failOnAny is the -fail-on that fails -check on every number it finds.
+const failOnAny = "any"
+
+var severityRanks = map[string]int{severityNote: 0, severityWarning: 1, severityError: 2}
+
+func severityNames() []string { return []string{severityError, severityWarning, severityNote} }
+
+func failOnNames() []string { return []string{severityError, severityWarning, failOnAny} }
+
+// severitiesFlag is the value of -severity, the severity of the numbers each
+// form rewrites.
+type severitiesFlag map[powershift.Form]string
+
+func (s severitiesFlag) String() string {
+	entries := make([]string, 0, len(s))
+	for form, level := range s {
+		entries = append(entries, fmt.Sprintf("%s=%s", form, level))
+	}
+	slices.Sort(entries)
+	return strings.Join(entries, ",")
+}
+
+func (s *severitiesFlag) Set(v string) error {
+	levels := severitiesFlag{}
+	for _, entry := range strings.Split(v, ",") {
+		name, level, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !slices.Contains(severityNames(), level) {
+			return powershift.Errorf(powershift.ErrInvalidOption, "parse", "-severity",
+				fmt.Sprintf("write FORM=LEVEL with a level of %v, e.g. plus-one=note", severityNames()), "bad severity %q", entry)
+		}
+		form, err := powershift.ParseForm(name)
+		if err != nil {
+			return err
+		}
+		levels[form] = level
+	}
+	*s = levels
+	return nil
+}
+
+// severityOf returns the severity of r, a number -check found: that of its
+// form under -severity, or by default error for an exact power of two written
+// raw and warning for the other forms.
+func (c *cliFlags) severityOf(r powershift.Result) string {
+	var form powershift.Form
+	if r.Candidate != nil {
+		form = r.Candidate.Form
+	}
+	if level, ok := c.severities[form]; ok {
+		return level
+	}
+	if form == powershift.FormPower {
+		return severityError
+	}
+	return severityWarning
+}
+
+// severityAware reports whether -check prints and weighs severities.
+func (c *cliFlags) severityAware() bool {
+	return c.failOn != failOnAny || c.severities != nil
+}
+
+// fails reports whether a number of the given severity fails -check under
+// -fail-on.
+func (c *cliFlags) fails(severity string) bool {
+	return c.failOn == failOnAny || severityRanks[severity] >= severityRanks[c.failOn]
+}
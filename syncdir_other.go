@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// syncDir does nothing: directories cannot be synced on this platform, and
+// renames are durable once they return.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// runVerify implements the "verify" subcommand: it reads the edit map an
+// earlier run wrote with -edits, evaluates every expression that run put in
+// the files and reports those that do not equal the literal they replaced. It
+// accepts the formatter flags, which must be those of the run so that the
+// expressions are read in the same language and notation.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: PowerShiftFormatter verify -edits FILE [flags] [OUTPUT]\n")
+		fs.PrintDefaults()
+	}
+	cli := defineFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return powershift.NewError(powershift.ErrInvalidOption, "parse", "verify", err, "")
+	}
+	if cli.editsFile == "" {
+		fs.Usage()
+		return powershift.Errorf(powershift.ErrInvalidOption, "run", "verify",
+			"rewrite with -edits edits.json first, then verify -edits edits.json", "-edits is required")
+	}
+	if cli.reverse {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "-reverse",
+			"drop -reverse; verify checks the expressions a run writes", "verify cannot be combined with -reverse")
+	}
+	maps, err := loadEditMaps(cli.editsFile)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || fs.NArg() == 1 && len(maps) != 1 {
+		return powershift.Errorf(powershift.ErrInvalidOption, "check", "verify",
+			"name the output only for the edit map of a single input, as written with -o", "too many files given")
+	}
+
+	formatter, err := powershift.New(cli.formatterOptions()...)
+	if err != nil {
+		return err
+	}
+	var literal *powershift.Result // The literal the reader last found
+	reader, err := powershift.New(append(cli.formatterOptions(), powershift.WithResultFunc(func(r powershift.Result) {
+		literal = &r
+	}))...)
+	if err != nil {
+		return err
+	}
+	// originalValue returns the value of a literal the run replaced, read
+	// like the run read it so that the literals of parsers are understood
+	originalValue := func(text string) (*big.Int, bool) {
+		literal = nil
+		if _, _, err := reader.String(text); err == nil && literal != nil && literal.Text == text {
+			return literal.Value, true
+		}
+		return formatter.Evaluate(text)
+	}
+
+	checked, mismatches := 0, 0
+	for _, m := range maps {
+		path := m.Input
+		if fs.NArg() == 1 {
+			path = fs.Arg(0)
+		}
+		if path == stdinPath {
+			return powershift.Errorf(powershift.ErrInvalidOption, "run", "verify",
+				"name the file the output was written to", "the run read standard input")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return readError(path, err)
+		}
+		for _, e := range m.Edits {
+			if e.Original == "" {
+				continue // A line comment of notes
+			}
+			checked++
+			end := e.NewOffset + e.NewLength
+			if e.NewOffset < 0 || e.NewOffset > end || end > int64(len(data)) {
+				mismatches++
+				fmt.Printf("%s: %s -> %s at offset %d, length %d is outside the file\n", path, e.Original, e.Replacement, e.NewOffset, e.NewLength)
+				continue
+			}
+			line, col := lineCol(data, e.NewOffset)
+			if !bytes.Equal(data[e.NewOffset:end], []byte(e.Replacement)) {
+				mismatches++
+				fmt.Printf("%s:%d:%d: %s -> %s is no longer there\n", path, line, col, e.Original, e.Replacement)
+				continue
+			}
+			want, ok := originalValue(e.Original)
+			if !ok {
+				mismatches++
+				fmt.Printf("%s:%d:%d: %s cannot be read as a number\n", path, line, col, e.Original)
+				continue
+			}
+			got, ok := formatter.Evaluate(e.Replacement)
+			if ok && got.Cmp(want) == 0 {
+				continue
+			}
+			mismatches++
+			result := "cannot be evaluated"
+			if ok {
+				result = "evaluates to " + got.String()
+			}
+			fmt.Printf("%s:%d:%d: %s -> %s %s, not %s\n", path, line, col, e.Original, e.Replacement, result, want)
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d expressions do not equal the literal they replace", mismatches, checked)
+	}
+	logf("Verified %d expressions in %d files", checked, len(maps))
+	return nil
+}
+
+// loadEditMaps reads a file written by -edits: the edit map of a single input
+// or a list of them.
+func loadEditMaps(path string) ([]editMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, readError(path, err)
+	}
+	var maps []editMap
+	if err := json.Unmarshal(data, &maps); err == nil {
+		return maps, nil
+	}
+	var single editMap
+	if err := json.Unmarshal(data, &single); err != nil {
+		return nil, powershift.NewError(powershift.ErrInvalidOption, "parse", path, err, "pass a file written by -edits")
+	}
+	return []editMap{single}, nil
+}
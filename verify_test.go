@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+func TestVerifyBadOffsets(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.go")
+	if err := os.WriteFile(out, []byte("const Size = 1 << 20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := powershift.Edit{NewOffset: 13, NewLength: 7, Original: "1048576", Replacement: "1 << 20"}
+	bad := []powershift.Edit{
+		{NewOffset: -3, NewLength: 7, Original: "1048576", Replacement: "1 << 20"},
+		{NewOffset: 13, NewLength: -7, Original: "1048576", Replacement: "1 << 20"},
+		{NewOffset: 30, NewLength: 7, Original: "1048576", Replacement: "1 << 20"},
+	}
+	edits := filepath.Join(dir, "edits.json")
+	if err := writeJSONFile(edits, editMap{Input: out, Edits: append([]powershift.Edit{good}, bad...)}); err != nil {
+		t.Fatal(err)
+	}
+	err := runVerify([]string{"-no-config", "-lang", "go", "-edits", edits})
+	if err == nil || !strings.Contains(err.Error(), "3 of 4") {
+		t.Errorf("got %v, want the 3 bad entries counted as mismatches", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3". When it
+// is left empty the module version recorded by the Go toolchain is used.
+var version string
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		if info.Version == "" {
+			info.Version = "unknown"
+		}
+		return info
+	}
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+func printVersion(w io.Writer) {
+	info := currentBuildInfo()
+	fmt.Fprintf(w, "PowerShiftFormatter %s (%s, %s)\n", info.Version, info.GoVersion, info.Platform)
+	if info.Revision != "" {
+		dirty := ""
+		if info.Modified {
+			dirty = ", modified"
+		}
+		fmt.Fprintf(w, "revision %s (%s%s)\n", info.Revision, info.BuildTime, dirty)
+	}
+}
+
+// capabilities is what wrapping tools can feature-detect at runtime.
+type capabilities struct {
+	Build         buildInfo      `json:"build"`
+	Forms         []string       `json:"forms"`
+	EmitModes     []string       `json:"emit_modes"`
+	Languages     []languageInfo `json:"languages"`
+	ReportFormats []string       `json:"report_formats"`
+	Options       []optionSchema `json:"options"`
+}
+
+type languageInfo struct {
+	Name           string `json:"name"`
+	BlockComment   string `json:"block_comment,omitempty"`
+	LineComment    string `json:"line_comment,omitempty"`
+	DigitSeparator string `json:"digit_separator,omitempty"`
+}
+
+// optionSchema describes one command-line flag.
+type optionSchema struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+func collectCapabilities(fs *flag.FlagSet) capabilities {
+	c := capabilities{
+		Build:         currentBuildInfo(),
+		ReportFormats: append([]string{"edits-json"}, reportFormats...),
+	}
+	for _, f := range powershift.FormNames() {
+		c.Forms = append(c.Forms, string(f))
+	}
+	for _, e := range powershift.EmitNames() {
+		c.EmitModes = append(c.EmitModes, string(e))
+	}
+	for _, name := range powershift.ProfileNames() {
+		p, _ := powershift.LookupProfile(name)
+		li := languageInfo{Name: p.Name, LineComment: p.LineComment, DigitSeparator: p.DigitSeparator}
+		if p.BlockComment[0] != "" {
+			li.BlockComment = p.BlockComment[0] + " " + p.BlockComment[1]
+		}
+		c.Languages = append(c.Languages, li)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		typ, usage := flag.UnquoteUsage(f)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			typ = "bool"
+		}
+		c.Options = append(c.Options, optionSchema{Name: f.Name, Type: typ, Default: f.DefValue, Usage: usage})
+	})
+	return c
+}
+
+func printCapabilities(w io.Writer, fs *flag.FlagSet, asJSON bool) error {
+	c := collectCapabilities(fs)
+	if asJSON {
+		return writeJSON(w, c)
+	}
+	fmt.Fprintf(w, "version:        %s\n", c.Build.Version)
+	fmt.Fprintf(w, "forms:          %s\n", strings.Join(c.Forms, ", "))
+	fmt.Fprintf(w, "emit modes:     %s\n", strings.Join(c.EmitModes, ", "))
+	names := make([]string, len(c.Languages))
+	for i, l := range c.Languages {
+		names[i] = l.Name
+	}
+	fmt.Fprintf(w, "languages:      %s\n", strings.Join(names, ", "))
+	fmt.Fprintf(w, "report formats: %s\n", strings.Join(c.ReportFormats, ", "))
+	fmt.Fprintf(w, "options:\n")
+	for _, o := range c.Options {
+		fmt.Fprintf(w, "  -%s %s\n", o.Name, o.Type)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultMaxOpenFiles is the number of files and directories the tool keeps
+// open at once without -max-open-files, well below common ulimits.
+const defaultMaxOpenFiles = 128
+
+// walkers is the number of directories read at once while expanding inputs,
+// which hides the latency of network filesystems.
+const walkers = 16
+
+// openFiles holds a slot for every file or directory the tool has open while
+// walking trees and processing inputs, so that -max-open-files bounds them.
+var openFiles = make(chan struct{}, defaultMaxOpenFiles)
+
+// setMaxOpenFiles implements -max-open-files.
+func setMaxOpenFiles(n int) {
+	openFiles = make(chan struct{}, n)
+}
+
+func acquireFile() { openFiles <- struct{}{} }
+func releaseFile() { <-openFiles }
+
+// treeWalk reads the directories below a root in parallel. Idle walkers take
+// the next directory from a shared stack that every walker pushes the
+// subdirectories it finds onto, so a deep branch does not leave the others
+// idle.
+type treeWalk struct {
+	root string
+	// enter decides whether the directory rel is read, and keep whether the
+	// file rel is one of the results. Both are called concurrently.
+	enter func(rel string) bool
+	keep  func(path, rel string) bool
+
+	mu      sync.Mutex
+	pending []string // Directories waiting to be read
+	active  int      // Directories being read
+	wake    *sync.Cond
+	files   []string
+	err     error
+}
+
+// run walks the tree and returns the files kept, in the order
+// filepath.WalkDir would visit them.
+func (t *treeWalk) run() ([]string, error) {
+	t.wake = sync.NewCond(&t.mu)
+	t.pending = []string{t.root}
+	var wg sync.WaitGroup
+	for range walkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir, ok := t.next(); ok; dir, ok = t.next() {
+				subdirs, files, err := t.read(dir)
+				t.done(subdirs, files, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.err != nil {
+		return nil, t.err
+	}
+	slices.SortFunc(t.files, comparePaths)
+	return t.files, nil
+}
+
+// next waits for a directory to read. It reports false once the walk is over.
+func (t *treeWalk) next() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.pending) == 0 && t.active > 0 && t.err == nil {
+		t.wake.Wait()
+	}
+	if len(t.pending) == 0 || t.err != nil {
+		return "", false
+	}
+	dir := t.pending[len(t.pending)-1]
+	t.pending = t.pending[:len(t.pending)-1]
+	t.active++
+	return dir, true
+}
+
+// done records the outcome of reading a directory.
+func (t *treeWalk) done(subdirs, files []string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	t.pending = append(t.pending, subdirs...)
+	t.files = append(t.files, files...)
+	t.wake.Broadcast()
+}
+
+// read lists dir, returning the subdirectories to enter and the files to keep.
+func (t *treeWalk) read(dir string) (subdirs, files []string, err error) {
+	acquireFile()
+	entries, err := os.ReadDir(dir)
+	releaseFile()
+	if err != nil {
+		return nil, nil, readError(dir, err)
+	}
+	for _, d := range entries {
+		p := filepath.Join(dir, d.Name())
+		rel, _ := filepath.Rel(t.root, p)
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			if t.enter(rel) {
+				subdirs = append(subdirs, p)
+			}
+		case d.Type().IsRegular():
+			if t.keep(p, rel) {
+				files = append(files, p)
+			}
+		}
+	}
+	return subdirs, files, nil
+}
+
+// comparePaths orders paths element by element, as filepath.WalkDir visits
+// them: a/b comes before a.c, unlike in a plain string comparison.
+func comparePaths(a, b string) int {
+	return slices.Compare(strings.Split(a, string(filepath.Separator)), strings.Split(b, string(filepath.Separator)))
+}
+
+// walkInputs returns the files below dir that the filters accept.
+func walkInputs(dir string, include, exclude patternsFlag) ([]string, error) {
+	t := &treeWalk{
+		root: dir,
+		enter: func(rel string) bool {
+			return !hidden(rel) && !exclude.match(rel)
+		},
+		keep: func(p, rel string) bool {
+			return !hidden(rel) && !exclude.match(rel) && accepted(p, rel, include)
+		},
+	}
+	return t.run()
+}
+
+// globInputs returns the files matching pattern, which may hold "**"
+// segments, that the filters accept. Directories it matches are walked.
+func globInputs(pattern string, include, exclude patternsFlag) ([]string, error) {
+	// Walk from the longest leading part without wildcards
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	i := slices.IndexFunc(segments, isGlob)
+	root := filepath.FromSlash(strings.Join(segments[:i], "/"))
+	if i == 1 && segments[0] == "" {
+		root = string(filepath.Separator)
+	}
+	if root == "" {
+		root = "."
+	}
+	rest := strings.Join(segments[i:], "/")
+	deep := slices.Contains(segments[i:], "**")
+	// matched reports whether rel or a directory above it matches the pattern
+	matched := func(rel string) bool {
+		for {
+			if matchPath(rest, rel) {
+				return true
+			}
+			slash := strings.LastIndexByte(rel, '/')
+			if slash < 0 {
+				return false
+			}
+			rel = rel[:slash]
+		}
+	}
+	t := &treeWalk{
+		root: root,
+		enter: func(rel string) bool {
+			if hidden(rel) || exclude.match(rel) {
+				return false
+			}
+			// Deeper than the pattern reaches, unless a directory matched
+			return deep || strings.Count(rel, "/")+1 < len(segments)-i || matched(rel)
+		},
+		keep: func(p, rel string) bool {
+			return !hidden(rel) && !exclude.match(rel) && matched(rel) && accepted(p, rel, include)
+		},
+	}
+	return t.run()
+}
+
+// hidden reports whether the file rel is named like .git or .env.
+func hidden(rel string) bool {
+	return strings.HasPrefix(path.Base(rel), ".")
+}
+
+// accepted reports whether a file found by walking is formatted: include
+// lets it in if set, and binary files and documents never are.
+func accepted(p, rel string, include patternsFlag) bool {
+	if len(include) > 0 && !include.match(rel) {
+		return false
+	}
+	if documentKind(p) != nil {
+		return false
+	}
+	acquireFile()
+	defer releaseFile()
+	f, err := os.Open(p)
+	if err != nil {
+		return true // Reported when it is opened
+	}
+	defer f.Close()
+	head := make([]byte, 8<<10)
+	n, _ := f.Read(head)
+	return !isBinary(head[:n])
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// worker processes inputs with a Formatter of its own, so that the edits and
+// findings its callbacks collect belong to the file it is working on.
+type worker struct {
+	proc           processor
+	rewrites       []powershift.Result // Numbers -check found
+	report         *reporter           // Nil without -report
+	events         *eventStream        // Nil without -events
+	header, footer string              // Delimiter lines around the output of each file
+	file           string              // Input being processed, for warnings
+	buffered       bool                // Hold the output back so files come out in input order
+	check          bool
+}
+
+// fileResult is what processing one input produced.
+type fileResult struct {
+	output   *bytes.Buffer // Output held back by a buffered worker
+	edits    []powershift.Edit
+	rewrites []powershift.Result
+	findings []finding
+	totals   totals
+	skipped  bool
+	err      error
+}
+
+// printFilenameHeader is the -header that -print-filename stands for, as in tail.
+const printFilenameHeader = "==> {file} <=="
+
+// writeDelimiter writes a -header or -footer line for the file at path.
+func writeDelimiter(w io.Writer, template, path string) error {
+	if template == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, strings.ReplaceAll(template, "{file}", path)+"\n")
+	return err
+}
+
+// inputName is the name of the input path in messages and reports.
+func inputName(path string) string {
+	if path == stdinPath {
+		return "stdin"
+	}
+	return path
+}
+
+// process transforms one input and returns everything it produced, telling
+// -events about it as it goes.
+func (w *worker) process(path string) fileResult {
+	name := inputName(path)
+	w.events.emit(event{Event: eventFileStart, File: name})
+	res := w.run(path)
+	w.events.results(name, w.proc.results)
+	w.events.fileDone(name, res)
+	return res
+}
+
+func (w *worker) run(path string) fileResult {
+	w.file = path
+	w.proc.edits = []powershift.Edit{}
+	w.proc.results = nil
+	w.rewrites = nil
+	if w.report != nil {
+		w.report.file = path
+		w.report.findings = []finding{}
+	}
+	w.proc.totals = totals{}
+	var res fileResult
+	if w.buffered {
+		res.output = &bytes.Buffer{}
+		w.proc.out = res.output
+	}
+	if err := writeDelimiter(w.proc.out, w.header, path); err != nil {
+		return fileResult{err: writeError("write", "", err)}
+	}
+	if path != stdinPath {
+		acquireFile()
+		defer releaseFile()
+	}
+	defer w.proc.dupes.done(path)
+	if res.skipped, res.err = w.proc.process(path); res.err == nil {
+		if err := writeDelimiter(w.proc.out, w.footer, path); err != nil {
+			return fileResult{err: writeError("write", "", err)}
+		}
+	}
+	w.collect()
+	res.edits, res.rewrites, res.totals = w.proc.edits, w.rewrites, w.proc.totals
+	if w.report != nil {
+		res.findings = w.report.findings
+	}
+	return res
+}
+
+// collect turns the results the formatter reported for the current input
+// into findings and -check locations.
+func (w *worker) collect() {
+	for _, r := range w.proc.results {
+		if w.report != nil {
+			w.report.add(r)
+		}
+		if w.check && (r.Replaced || r.Annotation != "") {
+			w.rewrites = append(w.rewrites, r)
+		}
+	}
+}
+
+// processAll processes paths with up to jobs workers made by newWorker and
+// calls done with the result of every path, in the order of paths, as soon as
+// it and all before it are finished. Processing stops at the first error done
+// returns.
+func processAll(paths []string, jobs int, newWorker func() (*worker, error), done func(string, fileResult) error) error {
+	jobs = max(1, min(jobs, len(paths)))
+	workers := make([]*worker, jobs)
+	for i := range workers {
+		var err error
+		if workers[i], err = newWorker(); err != nil {
+			return err
+		}
+	}
+	if jobs == 1 {
+		for _, path := range paths {
+			if err := done(path, workers[0].process(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results := make([]chan fileResult, len(paths))
+	for i := range results {
+		results[i] = make(chan fileResult, 1)
+	}
+	next := make(chan int)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] <- w.process(paths[i])
+			}
+		}()
+	}
+	go func() {
+		defer close(next)
+		for i := range paths {
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	// Files already being processed are finished before returning, so none
+	// is left half-written
+	defer wg.Wait()
+	defer close(stop)
+
+	for i, path := range paths {
+		if err := done(path, <-results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/doraemonkeys/PowerShiftFormatter/powershift"
+)
+
+// Write strategies for -w.
+const (
+	// writeRename writes a temp file next to the target and renames it over
+	// the target. Atomic, but the file gets a new inode.
+	writeRename = "rename"
+	// writeCopy writes a temp file, then copies it into the truncated target.
+	// The inode (and with it hard links and file watchers) is kept; the temp
+	// file survives as a backup if the copy is interrupted.
+	writeCopy = "copy"
+	// writeInPlace truncates and rewrites the target directly.
+	writeInPlace = "in-place"
+)
+
+var writeStrategies = []string{writeRename, writeCopy, writeInPlace}
+
+func checkWriteStrategy(s string) error {
+	for _, w := range writeStrategies {
+		if s == w {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", s, strings.Join(writeStrategies, ", "))
+}
+
+// replaceFile writes data to path using the given strategy. perm is applied
+// to newly created files so the result keeps the original permissions.
+func replaceFile(path string, data []byte, perm fs.FileMode, strategy string) error {
+	if strategy == writeInPlace {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return writeError("open", path, err)
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return writeError("write", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return writeError("write", path, err)
+		}
+		return nil
+	}
+	tmp, err := writeTemp(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return installTemp(path, tmp, strategy)
+}
+
+// installTemp replaces path with the temp file tmp made by writeTemp. The
+// in-place strategy cannot apply to a file that is already written, so it
+// copies like writeCopy, which keeps the inode as well.
+func installTemp(path, tmp, strategy string) error {
+	if strategy == writeRename {
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return powershift.NewError(powershift.ErrWriteFailed, "rename", path, err,
+				"renaming is not supported on every network mount; try -write-strategy copy")
+		}
+		// The rename itself is only durable once the directory is synced
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return writeError("sync", filepath.Dir(path), err)
+		}
+		return nil
+	}
+	if err := copyInto(path, tmp); err != nil {
+		return powershift.NewError(powershift.ErrWriteFailed, "copy", path, err,
+			fmt.Sprintf("the new content is preserved in %s", tmp))
+	}
+	os.Remove(tmp)
+	return nil
+}
+
+// writeTemp fills a synced temp file in the directory of path with write, so
+// a later rename stays on the same filesystem. Errors of write that are
+// already classified are returned as they are.
+func writeTemp(path string, perm fs.FileMode, write func(io.Writer) error) (string, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".powershift-*")
+	if err != nil {
+		return "", writeError("create", path, err)
+	}
+	tmp := f.Name()
+	fail := func(op string, err error) (string, error) {
+		f.Close()
+		os.Remove(tmp)
+		var classified *powershift.Error
+		if errors.As(err, &classified) {
+			return "", err
+		}
+		return "", writeError(op, tmp, err)
+	}
+	if err := write(f); err != nil {
+		return fail("write", err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		return fail("chmod", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail("sync", err)
+	}
+	if err := f.Close(); err != nil {
+		return fail("write", err)
+	}
+	return tmp, nil
+}
+
+// copyInto truncates dst and copies src into it, keeping dst's inode.
+func copyInto(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}